@@ -50,6 +50,8 @@ type AeLoop struct {
 	fileEventFd     int
 	timeEventNextId int
 	stop            bool
+	// 每次等待事件之前调用
+	BeforeSleep func(loop *AeLoop)
 }
 
 var fe2ep [3]uint32 = [3]uint32{0, unix.EPOLLIN, unix.POLLOUT}
@@ -253,6 +255,9 @@ func (loop *AeLoop) AeProcess(tes []*AeTimeEvent, fes []*AeFileEvent) {
 
 func (loop *AeLoop) AeMain() {
 	for !loop.stop {
+		if loop.BeforeSleep != nil {
+			loop.BeforeSleep(loop)
+		}
 		tes, fes := loop.AeWait()
 		loop.AeProcess(tes, fes)
 	}
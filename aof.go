@@ -0,0 +1,833 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// AOF持久化，写命令执行成功后以RESP格式追加到文件，启动时通过没有连接的客户端重放。
+// 依赖当前时间或随机结果的命令在写入前转换为确定的形式，例如EXPIRE转换为PEXPIREAT。
+//
+// AOF由appenddirname目录中的多个文件组成：一个base文件（RDB或AOF格式）和之后的incr文件，
+// manifest文件记录它们的顺序。重写开始时写入新的incr文件，完成后新的base文件
+// 替换旧的base和之前的incr文件，旧文件先标记为history，manifest更新后再删除
+
+const (
+	AOF_FSYNC_NO = iota
+	AOF_FSYNC_ALWAYS
+	AOF_FSYNC_EVERYSEC
+)
+
+const (
+	DEFAULT_APPENDFILENAME       = "appendonly.aof"
+	DEFAULT_APPENDDIRNAME        = "appendonlydir"
+	DEFAULT_APPENDFSYNC          = "everysec"
+	DEFAULT_AOF_REWRITE_PERC     = 100
+	DEFAULT_AOF_REWRITE_MIN_SIZE = 64 * 1024 * 1024
+	// 重写时每条命令最多包含的元素个数
+	AOF_REWRITE_ITEMS_PER_CMD = 64
+
+	AOF_MANIFEST_SUFFIX = ".manifest"
+	AOF_BASE_SUFFIX     = ".base"
+	AOF_INCR_SUFFIX     = ".incr"
+	AOF_FORMAT_SUFFIX   = ".aof"
+	RDB_FORMAT_SUFFIX   = ".rdb"
+
+	AOF_FILE_TYPE_BASE = 'b'
+	AOF_FILE_TYPE_HIST = 'h'
+	AOF_FILE_TYPE_INCR = 'i'
+)
+
+var (
+	errAofRewriteInProgress = errors.New("Background append only file rewriting already in progress")
+	errAofManifestInvalid   = errors.New("invalid AOF manifest file format")
+	errAofTruncated         = errors.New("unexpected end of file reading the append only file, " +
+		"set aof-load-truncated to true to load the valid part")
+)
+
+var (
+	// 后台fsync的任务，同一时间最多只有一个
+	aofFsyncJobs       = make(chan *os.File, 1)
+	aofFsyncInProgress int32
+)
+
+func init() {
+	go func() {
+		for f := range aofFsyncJobs {
+			// 切换incr文件后旧文件可能已经关闭
+			if err := f.Sync(); err != nil && !errors.Is(err, os.ErrClosed) {
+				log.Printf("fsync append only file error: %v\n", err)
+			}
+			atomic.StoreInt32(&aofFsyncInProgress, 0)
+		}
+	}()
+}
+
+func parseAppendFsync(policy string) (int, error) {
+	switch policy {
+	case "always":
+		return AOF_FSYNC_ALWAYS, nil
+	case "everysec":
+		return AOF_FSYNC_EVERYSEC, nil
+	case "no":
+		return AOF_FSYNC_NO, nil
+	}
+	return 0, fmt.Errorf("invalid appendfsync %q", policy)
+}
+
+type aofInfo struct {
+	name string
+	seq  int64
+	typ  byte
+}
+
+// 组成AOF的文件，history是已经被新的base替换、等待删除的文件
+type aofManifest struct {
+	base        *aofInfo
+	incrList    []*aofInfo
+	historyList []*aofInfo
+	currBaseSeq int64
+	currIncrSeq int64
+}
+
+// aofInfo创建后不会修改，只需要复制列表
+func (m *aofManifest) dup() *aofManifest {
+	d := *m
+	d.incrList = append([]*aofInfo(nil), m.incrList...)
+	d.historyList = append([]*aofInfo(nil), m.historyList...)
+	return &d
+}
+
+// 每行一个文件: file <name> seq <seq> type <b|h|i>
+func (m *aofManifest) String() string {
+	var sb strings.Builder
+	write := func(info *aofInfo) {
+		fmt.Fprintf(&sb, "file %s seq %d type %c\n", info.name, info.seq, info.typ)
+	}
+	if m.base != nil {
+		write(m.base)
+	}
+	for _, info := range m.historyList {
+		write(info)
+	}
+	for _, info := range m.incrList {
+		write(info)
+	}
+	return sb.String()
+}
+
+// 旧的base文件变为history
+func (m *aofManifest) newBaseFile(rdb bool) string {
+	if m.base != nil {
+		m.historyList = append(m.historyList, &aofInfo{m.base.name, m.base.seq, AOF_FILE_TYPE_HIST})
+	}
+	format := AOF_FORMAT_SUFFIX
+	if rdb {
+		format = RDB_FORMAT_SUFFIX
+	}
+	m.currBaseSeq++
+	name := fmt.Sprintf("%s.%d%s%s", server.aofFilename, m.currBaseSeq, AOF_BASE_SUFFIX, format)
+	m.base = &aofInfo{name, m.currBaseSeq, AOF_FILE_TYPE_BASE}
+	return name
+}
+
+func (m *aofManifest) newIncrFile() string {
+	m.currIncrSeq++
+	name := fmt.Sprintf("%s.%d%s%s", server.aofFilename, m.currIncrSeq, AOF_INCR_SUFFIX, AOF_FORMAT_SUFFIX)
+	m.incrList = append(m.incrList, &aofInfo{name, m.currIncrSeq, AOF_FILE_TYPE_INCR})
+	return name
+}
+
+// 重写开始前的incr文件已经包含在新的base中，keepLast为true时保留重写开始时打开的incr文件
+func (m *aofManifest) markRewrittenIncrAsHistory(keepLast bool) {
+	n := len(m.incrList)
+	if keepLast && n > 0 {
+		n--
+	}
+	for _, info := range m.incrList[:n] {
+		m.historyList = append(m.historyList, &aofInfo{info.name, info.seq, AOF_FILE_TYPE_HIST})
+	}
+	m.incrList = m.incrList[n:]
+}
+
+func parseAofManifest(data string) (*aofManifest, error) {
+	m := &aofManifest{}
+	if data != "" && !strings.HasSuffix(data, "\n") {
+		return nil, errAofManifestInvalid
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(data, "\n"), "\n") {
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields)%2 != 0 {
+			return nil, errAofManifestInvalid
+		}
+		info := &aofInfo{}
+		for i := 0; i < len(fields); i += 2 {
+			switch fields[i] {
+			case "file":
+				info.name = fields[i+1]
+			case "seq":
+				info.seq, _ = strconv.ParseInt(fields[i+1], 10, 64)
+			case "type":
+				if len(fields[i+1]) != 1 {
+					return nil, errAofManifestInvalid
+				}
+				info.typ = fields[i+1][0]
+			}
+			// 忽略不认识的字段，兼容以后增加的信息
+		}
+		if info.name == "" || info.seq <= 0 || strings.ContainsRune(info.name, filepath.Separator) {
+			return nil, errAofManifestInvalid
+		}
+		switch info.typ {
+		case AOF_FILE_TYPE_BASE:
+			if m.base != nil {
+				return nil, errAofManifestInvalid
+			}
+			m.base = info
+			m.currBaseSeq = info.seq
+		case AOF_FILE_TYPE_HIST:
+			m.historyList = append(m.historyList, info)
+		case AOF_FILE_TYPE_INCR:
+			if info.seq <= m.currIncrSeq {
+				return nil, errAofManifestInvalid
+			}
+			m.incrList = append(m.incrList, info)
+			m.currIncrSeq = info.seq
+		default:
+			return nil, errAofManifestInvalid
+		}
+	}
+	return m, nil
+}
+
+func aofFilePath(name string) string {
+	return filepath.Join(server.aofDirname, name)
+}
+
+func aofManifestPath() string {
+	return aofFilePath(server.aofFilename + AOF_MANIFEST_SUFFIX)
+}
+
+// 没有manifest时，如果有旧版本的单个AOF文件，移动到目录中作为base文件
+func loadAofManifest() error {
+	data, err := os.ReadFile(aofManifestPath())
+	if err == nil {
+		m, err := parseAofManifest(string(data))
+		if err != nil {
+			return err
+		}
+		server.aofManifest = m
+		return nil
+	}
+	if !os.IsNotExist(err) {
+		return err
+	}
+	server.aofManifest = &aofManifest{}
+	old := filepath.Join(filepath.Dir(server.aofDirname), server.aofFilename)
+	if _, err = os.Stat(old); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	m := &aofManifest{base: &aofInfo{server.aofFilename, 1, AOF_FILE_TYPE_BASE}, currBaseSeq: 1}
+	if err = os.MkdirAll(server.aofDirname, 0755); err != nil {
+		return err
+	}
+	if err = os.Rename(old, aofFilePath(server.aofFilename)); err != nil {
+		return err
+	}
+	if err = persistAofManifest(m); err != nil {
+		return err
+	}
+	server.aofManifest = m
+	log.Printf("Successfully migrated an old-style AOF %v into the AOF directory\n", old)
+	return nil
+}
+
+// 先写入临时文件，fsync后rename，保证manifest总是完整的
+func persistAofManifest(m *aofManifest) error {
+	if err := os.MkdirAll(server.aofDirname, 0755); err != nil {
+		return err
+	}
+	tmpfile := aofFilePath("temp-" + server.aofFilename + AOF_MANIFEST_SUFFIX)
+	f, err := os.Create(tmpfile)
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteString(m.String())
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmpfile, aofManifestPath())
+	}
+	if err != nil {
+		os.Remove(tmpfile)
+		return err
+	}
+	return fsyncDir(server.aofDirname)
+}
+
+// rename之后fsync目录，保证重启后能看到新的文件名
+func fsyncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	err = d.Sync()
+	if cerr := d.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// 从manifest中移除history文件，manifest更新后再在后台删除
+func aofDelHistoryFiles() {
+	m := server.aofManifest
+	if m == nil || len(m.historyList) == 0 {
+		return
+	}
+	d := m.dup()
+	d.historyList = nil
+	if err := persistAofManifest(d); err != nil {
+		log.Printf("persist AOF manifest error: %v\n", err)
+		return
+	}
+	server.aofManifest = d
+	paths := make([]string, len(m.historyList))
+	for i, info := range m.historyList {
+		paths[i] = aofFilePath(info.name)
+	}
+	go func() {
+		for _, path := range paths {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				log.Printf("remove AOF history file error: %v\n", err)
+			}
+		}
+	}()
+}
+
+// base和incr文件的总大小
+func aofFilesSize(m *aofManifest) int64 {
+	var size int64
+	infos := m.incrList
+	if m.base != nil {
+		infos = append([]*aofInfo{m.base}, infos...)
+	}
+	for _, info := range infos {
+		if fi, err := os.Stat(aofFilePath(info.name)); err == nil {
+			size += fi.Size()
+		}
+	}
+	return size
+}
+
+// 启动时打开最后一个incr文件用于追加，没有时创建新的incr文件。
+// base和incr文件都不存在时，先用当前数据创建base文件
+func openAppendOnlyFile() error {
+	if server.aofManifest == nil {
+		if err := loadAofManifest(); err != nil {
+			return err
+		}
+	}
+	m := server.aofManifest.dup()
+	changed := false
+	if m.base == nil && len(m.incrList) == 0 {
+		name := m.newBaseFile(server.aofUseRdbPreamble)
+		tmpfile := aofRewriteTempFile()
+		snap := createSnapshot()
+		err := os.MkdirAll(server.aofDirname, 0755)
+		if err == nil {
+			err = rewriteAppendOnlyFile(tmpfile, snap, server.aofUseRdbPreamble)
+		}
+		releaseSnapshot(snap)
+		if err == nil {
+			err = os.Rename(tmpfile, aofFilePath(name))
+		}
+		if err != nil {
+			os.Remove(tmpfile)
+			return err
+		}
+		changed = true
+	}
+	if len(m.incrList) == 0 {
+		m.newIncrFile()
+		changed = true
+	}
+	f, err := os.OpenFile(aofFilePath(m.incrList[len(m.incrList)-1].name), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	if changed {
+		if err = persistAofManifest(m); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	server.aofManifest = m
+	server.aofFile = f
+	// 第一条命令之前总是写入SELECT
+	server.aofSelectedDB = -1
+	server.aofLastFsync = time.Now()
+	server.aofCurrentSize = aofFilesSize(m)
+	server.aofRewriteBaseSize = server.aofCurrentSize
+	aofDelHistoryFiles()
+	return nil
+}
+
+// 之后的命令都写入新的incr文件，旧文件在后台fsync后关闭
+func openNewIncrAof() error {
+	m := server.aofManifest.dup()
+	name := m.newIncrFile()
+	f, err := os.OpenFile(aofFilePath(name), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	if err = persistAofManifest(m); err != nil {
+		f.Close()
+		os.Remove(aofFilePath(name))
+		return err
+	}
+	old := server.aofFile
+	go func() {
+		if err := old.Sync(); err != nil {
+			log.Printf("fsync append only file error: %v\n", err)
+		}
+		old.Close()
+	}()
+	server.aofManifest = m
+	server.aofFile = f
+	server.aofSelectedDB = -1
+	server.aofUnsynced = false
+	return nil
+}
+
+func catAppendOnlyCommand(buf []byte, args ...string) []byte {
+	buf = append(buf, '*')
+	buf = strconv.AppendInt(buf, int64(len(args)), 10)
+	buf = append(buf, "\r\n"...)
+	for _, arg := range args {
+		buf = append(buf, '$')
+		buf = strconv.AppendInt(buf, int64(len(arg)), 10)
+		buf = append(buf, "\r\n"...)
+		buf = append(buf, arg...)
+		buf = append(buf, "\r\n"...)
+	}
+	return buf
+}
+
+// 把在dbid中执行的命令追加到缓冲区，在下次进入事件循环等待之前写入文件
+func feedAppendOnlyFile(dbid int, args []*Gobj) {
+	if server.aofFile == nil || server.loading {
+		return
+	}
+	if dbid != server.aofSelectedDB {
+		server.aofBuf = catAppendOnlyCommand(server.aofBuf, "SELECT", strconv.Itoa(dbid))
+		server.aofSelectedDB = dbid
+	}
+	strs := make([]string, len(args))
+	for i, arg := range args {
+		strs[i] = arg.StrVal()
+	}
+	server.aofBuf = catAppendOnlyCommand(server.aofBuf, strs...)
+}
+
+// 过期删除的key以DEL写入AOF
+func propagateExpire(db *GodisDB, key *Gobj) {
+	del := CreateObject(GSTR, "DEL")
+	feedAppendOnlyFile(db.id, []*Gobj{del, key})
+	del.DecrRefCount()
+}
+
+// 替换写入AOF的命令，只能在命令执行的最后调用
+func rewriteClientCommand(c *GodisClient, args ...string) {
+	freeArgs(c)
+	c.args = make([]*Gobj, len(args))
+	for i, arg := range args {
+		c.args[i] = CreateObject(GSTR, arg)
+	}
+}
+
+func rewriteClientCommandArg(c *GodisClient, i int, arg string) {
+	c.args[i].DecrRefCount()
+	c.args[i] = CreateObject(GSTR, arg)
+}
+
+// 写入缓冲区，并按appendfsync执行fsync。回复在之后的事件循环中发送，
+// 所以客户端收到回复时命令已经写入文件
+func flushAppendOnlyFile() {
+	if server.aofFile == nil {
+		return
+	}
+	if len(server.aofBuf) > 0 {
+		n, err := server.aofFile.Write(server.aofBuf)
+		if err != nil {
+			// 没有写入的部分留在缓冲区中，下次重试
+			log.Printf("write append only file error: %v\n", err)
+			server.aofBuf = server.aofBuf[n:]
+			server.aofLastWriteOK = false
+			return
+		}
+		server.aofBuf = server.aofBuf[:0]
+		server.aofCurrentSize += int64(n)
+		server.aofLastWriteOK = true
+		server.aofUnsynced = true
+	}
+	if !server.aofUnsynced {
+		return
+	}
+	switch server.aofFsync {
+	case AOF_FSYNC_ALWAYS:
+		if err := server.aofFile.Sync(); err != nil {
+			log.Printf("fsync append only file error: %v\n", err)
+			return
+		}
+	case AOF_FSYNC_EVERYSEC:
+		// 上一次fsync还没有完成时等待下次再提交
+		if time.Since(server.aofLastFsync) < time.Second ||
+			!atomic.CompareAndSwapInt32(&aofFsyncInProgress, 0, 1) {
+			return
+		}
+		aofFsyncJobs <- server.aofFile
+	default:
+		return
+	}
+	server.aofLastFsync = time.Now()
+	server.aofUnsynced = false
+}
+
+// 已经从查询缓冲区中解析、但还没有执行的命令的长度
+func queryParsedLen(c *GodisClient) int {
+	if c.cmdTy != COMMAND_BULK || c.bulkNum == 0 {
+		return 0
+	}
+	parsed := len(c.args) - c.bulkNum
+	n := len(fmt.Sprintf("*%d\r\n", len(c.args)))
+	for _, arg := range c.args[:parsed] {
+		l := len(arg.StrVal())
+		n += len(fmt.Sprintf("$%d\r\n", l)) + l + 2
+	}
+	if c.bulkLen >= 0 {
+		n += len(fmt.Sprintf("$%d\r\n", c.bulkLen))
+	}
+	return n
+}
+
+// 按manifest的顺序加载base和incr文件，没有任何AOF文件时返回os.ErrNotExist
+func loadAppendOnlyFiles() error {
+	if err := loadAofManifest(); err != nil {
+		return err
+	}
+	m := server.aofManifest
+	infos := m.incrList
+	if m.base != nil {
+		infos = append([]*aofInfo{m.base}, infos...)
+	}
+	if len(infos) == 0 {
+		return os.ErrNotExist
+	}
+	start := time.Now()
+	for i, info := range infos {
+		path := aofFilePath(info.name)
+		if _, err := os.Stat(path); err != nil {
+			return fmt.Errorf("append only file %v listed in the manifest can't be opened: %v", info.name, err)
+		}
+		// 只有最后一个文件的末尾允许不完整
+		if err := loadAppendOnlyFile(path, i == len(infos)-1); err != nil {
+			return err
+		}
+	}
+	server.dirty = 0
+	log.Printf("DB loaded from append only files: %.3f seconds\n", time.Since(start).Seconds())
+	return nil
+}
+
+// 加载一个AOF文件，以REDIS开头的是RDB格式的base文件，其他的通过没有连接的客户端重放。
+// 文件末尾的命令不完整时，last为true且开启aof-load-truncated时截断到最后一条完整的命令
+func loadAppendOnlyFile(filename string, last bool) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	server.loading = true
+	defer func() {
+		server.loading = false
+	}()
+	magic := make([]byte, 5)
+	n, _ := io.ReadFull(f, magic)
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if n == len(magic) && string(magic) == "REDIS" {
+		if err = rdbLoadFrom(f); err != nil {
+			return fmt.Errorf("loading RDB preamble of %v: %v", filename, err)
+		}
+		return nil
+	}
+	client := createFakeClient()
+	buf := make([]byte, GODIS_IO_BUF)
+	var offset int64
+	for {
+		n, err := f.Read(buf)
+		if n > 0 {
+			client.queryBuf = append(client.queryBuf[:client.queryLen], buf[:n]...)
+			client.queryLen += n
+			offset += int64(n)
+			perr := ProcessQueryBuf(client)
+			freeReplyList(client)
+			if perr != nil {
+				return fmt.Errorf("bad file format reading the append only file %v: %v", filename, perr)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if client.queryLen == 0 && client.cmdTy == COMMAND_UNKNOWN {
+		return nil
+	}
+	valid := offset - int64(client.queryLen) - int64(queryParsedLen(client))
+	if client.cmdTy == COMMAND_BULK && client.bulkNum > 0 {
+		for _, arg := range client.args[:len(client.args)-client.bulkNum] {
+			arg.DecrRefCount()
+		}
+	}
+	if !last {
+		return fmt.Errorf("unexpected end of file reading the append only file %v", filename)
+	}
+	if !server.aofLoadTruncated {
+		return errAofTruncated
+	}
+	log.Printf("!!! Warning: short read while loading the AOF file %v, truncating to %d bytes\n", filename, valid)
+	return os.Truncate(filename, valid)
+}
+
+// 元素较多时拆分为多条命令，每个元素占width个参数
+func catRewriteCommands(buf []byte, cmd, key string, items []string, width int) []byte {
+	for len(items) > 0 {
+		n := len(items)
+		if n > AOF_REWRITE_ITEMS_PER_CMD*width {
+			n = AOF_REWRITE_ITEMS_PER_CMD * width
+		}
+		args := append([]string{cmd, key}, items[:n]...)
+		buf = catAppendOnlyCommand(buf, args...)
+		items = items[n:]
+	}
+	return buf
+}
+
+// 用重建value的命令表示一个key，过期时间以PEXPIREAT表示
+func rewriteKeyValuePair(buf []byte, e *rdbEntry) []byte {
+	key := e.key.StrVal()
+	var items []string
+	switch e.val.Type_ {
+	case GSTR:
+		buf = catAppendOnlyCommand(buf, "SET", key, e.val.StrVal())
+	case GLIST:
+		list := e.val.Val_.(*GobjList)
+		for n := list.First(); n != nil; n = n.next {
+			items = append(items, n.Val.StrVal())
+		}
+		buf = catRewriteCommands(buf, "RPUSH", key, items, 1)
+	case GSET, GDICT:
+		// 快照在其他协程中写入，只能使用不修改dict的迭代器
+		iter := e.val.Val_.(*GobjDict).Iterator()
+		for en := iter.Next(); en != nil; en = iter.Next() {
+			items = append(items, en.Key.StrVal())
+			if e.val.Type_ == GDICT {
+				items = append(items, en.Val.StrVal())
+			}
+		}
+		iter.Release()
+		if e.val.Type_ == GSET {
+			buf = catRewriteCommands(buf, "SADD", key, items, 1)
+		} else {
+			buf = catRewriteCommands(buf, "HSET", key, items, 2)
+		}
+	case GZSET:
+		zsl := e.val.Val_.(*ZSet).zsl
+		for n := zsl.First(); n != nil; n = n.Next() {
+			items = append(items, formatFloat(n.Score), n.Member.StrVal())
+		}
+		buf = catRewriteCommands(buf, "ZADD", key, items, 2)
+	}
+	if e.expire != -1 {
+		buf = catAppendOnlyCommand(buf, "PEXPIREAT", key, strconv.FormatInt(e.expire, 10))
+	}
+	return buf
+}
+
+// 把快照以命令的形式写入w
+func rewriteAppendOnlyFileSnapshot(w io.Writer, snap [][]rdbEntry) error {
+	bw := bufio.NewWriter(w)
+	var buf []byte
+	for id, entries := range snap {
+		if len(entries) == 0 {
+			continue
+		}
+		buf = catAppendOnlyCommand(buf[:0], "SELECT", strconv.Itoa(id))
+		for i := range entries {
+			buf = rewriteKeyValuePair(buf, &entries[i])
+			if _, err := bw.Write(buf); err != nil {
+				return err
+			}
+			buf = buf[:0]
+		}
+	}
+	return bw.Flush()
+}
+
+func aofRewriteTempFile() string {
+	return aofFilePath(fmt.Sprintf("temp-rewriteaof-bg-%d.aof", os.Getpid()))
+}
+
+// 把快照写入临时文件作为新的base，rdb为true时使用RDB格式
+func rewriteAppendOnlyFile(tmpfile string, snap [][]rdbEntry, rdb bool) error {
+	f, err := os.Create(tmpfile)
+	if err != nil {
+		return err
+	}
+	if rdb {
+		err = rdbSaveSnapshot(f, snap)
+	} else {
+		err = rewriteAppendOnlyFileSnapshot(f, snap)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// 开启AOF时先切换到新的incr文件，此时的快照正好包含之前所有文件中的数据，
+// 然后在协程中把快照写入新的base，完成后由aofCron处理结果
+func rewriteAppendOnlyFileBackground() error {
+	if server.aofRewriteDone != nil {
+		return errAofRewriteInProgress
+	}
+	if server.aofManifest == nil {
+		if err := loadAofManifest(); err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(server.aofDirname, 0755); err != nil {
+		return err
+	}
+	if server.aofFile != nil {
+		flushAppendOnlyFile()
+		if len(server.aofBuf) > 0 {
+			return errors.New("can't write pending commands to the append only file")
+		}
+		if err := openNewIncrAof(); err != nil {
+			return err
+		}
+	}
+	snap := createSnapshot()
+	done := make(chan error, 1)
+	tmpfile := aofRewriteTempFile()
+	rdb := server.aofUseRdbPreamble
+	go func() {
+		done <- rewriteAppendOnlyFile(tmpfile, snap, rdb)
+	}()
+	server.aofRewriteSnapshot = snap
+	server.aofRewriteDone = done
+	server.aofRewriteRdb = rdb
+	log.Println("Background append only file rewriting started")
+	return nil
+}
+
+// 把临时文件rename为新的base，之前的base和incr文件标记为history，
+// manifest更新成功后才删除history文件
+func finishAofRewrite(tmpfile string) error {
+	m := server.aofManifest.dup()
+	name := m.newBaseFile(server.aofRewriteRdb)
+	m.markRewrittenIncrAsHistory(server.aofFile != nil)
+	path := aofFilePath(name)
+	if err := os.Rename(tmpfile, path); err != nil {
+		return err
+	}
+	if err := persistAofManifest(m); err != nil {
+		os.Remove(path)
+		return err
+	}
+	server.aofManifest = m
+	server.aofCurrentSize = aofFilesSize(m)
+	server.aofRewriteBaseSize = server.aofCurrentSize
+	aofDelHistoryFiles()
+	return nil
+}
+
+func checkAofRewriteDone() bool {
+	select {
+	case err := <-server.aofRewriteDone:
+		releaseSnapshot(server.aofRewriteSnapshot)
+		server.aofRewriteSnapshot = nil
+		server.aofRewriteDone = nil
+		tmpfile := aofRewriteTempFile()
+		if err == nil {
+			err = finishAofRewrite(tmpfile)
+		}
+		if err != nil {
+			// 重写开始时创建的incr文件仍然有效，下次重写时一起替换
+			log.Printf("background AOF rewrite error: %v\n", err)
+			os.Remove(tmpfile)
+			server.aofLastBgrewriteOK = false
+			return true
+		}
+		log.Println("Background AOF rewrite finished successfully")
+		server.aofLastBgrewriteOK = true
+		return true
+	default:
+		return false
+	}
+}
+
+// 检查重写是否完成，或者在文件增长较多时自动重写
+func aofCron() {
+	if server.aofRewriteDone != nil {
+		checkAofRewriteDone()
+		return
+	}
+	if server.aofFile == nil || server.aofRewritePerc == 0 || server.aofCurrentSize <= server.aofRewriteMinSize {
+		return
+	}
+	base := server.aofRewriteBaseSize
+	if base == 0 {
+		base = 1
+	}
+	growth := server.aofCurrentSize*100/base - 100
+	if growth >= int64(server.aofRewritePerc) {
+		log.Printf("Starting automatic rewriting of AOF on %d%% growth\n", growth)
+		rewriteAppendOnlyFileBackground()
+	}
+}
+
+func bgrewriteaofCommand(c *GodisClient) {
+	if err := rewriteAppendOnlyFileBackground(); err != nil {
+		c.AddReplyError(err.Error())
+		return
+	}
+	c.AddReplyStr("+Background append only file rewriting started\r\n")
+}
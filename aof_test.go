@@ -0,0 +1,531 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 创建开启AOF的测试server，aof文件放在临时目录中
+func newAofTestClient(t *testing.T) *GodisClient {
+	client := newTestClient()
+	server.aofDirname = filepath.Join(t.TempDir(), DEFAULT_APPENDDIRNAME)
+	assert.Nil(t, openAppendOnlyFile())
+	t.Cleanup(closeAof)
+	return client
+}
+
+func closeAof() {
+	if server.aofFile != nil {
+		server.aofFile.Close()
+		server.aofFile = nil
+	}
+}
+
+// 读取当前写入的incr文件
+func readAof(t *testing.T) string {
+	flushAppendOnlyFile()
+	m := server.aofManifest
+	data, err := os.ReadFile(aofFilePath(m.incrList[len(m.incrList)-1].name))
+	assert.Nil(t, err)
+	return string(data)
+}
+
+// 重新初始化server并按manifest重放aof文件
+func reloadAof(t *testing.T) *GodisClient {
+	flushAppendOnlyFile()
+	closeAof()
+	dirname := server.aofDirname
+	client := newTestClient()
+	server.aofDirname = dirname
+	assert.Nil(t, loadAppendOnlyFiles())
+	return client
+}
+
+// 等待后台删除history文件
+func waitAofFilesRemoved(t *testing.T, names ...string) {
+	deadline := time.Now().Add(time.Second)
+	for _, name := range names {
+		for {
+			_, err := os.Stat(aofFilePath(name))
+			if os.IsNotExist(err) {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("%v not removed", name)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+}
+
+func aofCommands(cmds ...[]string) string {
+	var buf []byte
+	for _, cmd := range cmds {
+		buf = catAppendOnlyCommand(buf, cmd...)
+	}
+	return string(buf)
+}
+
+func TestAofFeed(t *testing.T) {
+	client := newAofTestClient(t)
+	assert.Equal(t, "+OK\r\n", execCommand(client, "set a 1"))
+	execCommand(client, "get a")
+	execCommand(client, "incr nokey x")
+	execCommand(client, "lpush a x")
+	execCommand(client, "set b 2 EX 100")
+	whenB := strconv.FormatInt(server.dbs[0].getExpire(CreateObject(GSTR, "b")), 10)
+	execCommand(client, "expire a 100 nx")
+	execCommand(client, "select 3")
+	execCommand(client, "incrbyfloat f 1.5")
+	execCommand(client, "hincrbyfloat h f 0.5")
+	execCommand(client, "sadd s x y")
+	spop := execCommand(client, "spop s")
+	execCommand(client, "spop s 5")
+	execCommand(client, "getex b")
+	execCommand(client, "select 0")
+	execCommand(client, "getex b persist")
+
+	whenA := strconv.FormatInt(server.dbs[0].getExpire(CreateObject(GSTR, "a")), 10)
+	popped := strings.Split(spop, "\r\n")[1]
+	other := map[string]string{"x": "y", "y": "x"}[popped]
+	assert.Equal(t, ":-1\r\n", execCommand(client, "pttl b"))
+	assert.Equal(t, aofCommands(
+		[]string{"SELECT", "0"},
+		[]string{"set", "a", "1"},
+		[]string{"set", "b", "2", "PXAT", whenB},
+		[]string{"PEXPIREAT", "a", whenA, "nx"},
+		[]string{"SELECT", "3"},
+		[]string{"SET", "f", "1.5", "KEEPTTL"},
+		[]string{"HSET", "h", "f", "0.5"},
+		[]string{"sadd", "s", "x", "y"},
+		[]string{"SREM", "s", popped},
+		[]string{"SREM", "s", other},
+		[]string{"SELECT", "0"},
+		[]string{"PERSIST", "b"},
+	), readAof(t))
+}
+
+// 没有修改数据的写命令不计入dirty，也不写入AOF
+func TestAofSkipNoop(t *testing.T) {
+	client := newAofTestClient(t)
+	execCommand(client, "set a 1")
+	execCommand(client, "sadd s x")
+	execCommand(client, "hset h f v")
+	execCommand(client, "zadd z 1 m")
+	dirty := server.dirty
+	for _, cmd := range []string{
+		"del nokey", "unlink nokey", "set a 2 nx", "msetnx a 2 b 2",
+		"srem s y", "srem nokey y", "hdel h g", "zrem z n", "getex a", "persist a",
+		"expire nokey 100", "lpop nokey", "zadd z nx 2 m", "sadd s x", "hsetnx h f v",
+		"lrem nokey 0 x", "smove s s2 y", "sdiffstore nokey s s", "incr h",
+	} {
+		execCommand(client, cmd)
+		assert.Equal(t, dirty, server.dirty, cmd)
+	}
+	execCommand(client, "del a nokey")
+	assert.Equal(t, dirty+1, server.dirty)
+	execCommand(client, "sadd s x y z")
+	assert.Equal(t, dirty+3, server.dirty)
+	assert.Equal(t, aofCommands(
+		[]string{"SELECT", "0"},
+		[]string{"set", "a", "1"},
+		[]string{"sadd", "s", "x"},
+		[]string{"hset", "h", "f", "v"},
+		[]string{"zadd", "z", "1", "m"},
+		[]string{"del", "a", "nokey"},
+		[]string{"sadd", "s", "x", "y", "z"},
+	), readAof(t))
+}
+
+func TestAofExpire(t *testing.T) {
+	client := newAofTestClient(t)
+	execCommand(client, "set k v px 1")
+	execCommand(client, "set k2 v")
+	execCommand(client, "getex k2 pxat 1")
+	time.Sleep(2 * time.Millisecond)
+	assert.Equal(t, "$-1\r\n", execCommand(client, "get k"))
+	data := readAof(t)
+	assert.True(t, strings.HasSuffix(data, aofCommands(
+		[]string{"set", "k2", "v"},
+		[]string{"DEL", "k2"},
+		[]string{"DEL", "k"},
+	)))
+}
+
+func TestAofLoad(t *testing.T) {
+	client := newAofTestClient(t)
+	execCommand(client, "set str hello")
+	execCommand(client, "set ttl v ex 100")
+	execCommand(client, "rpush list a b c")
+	execCommand(client, "lpop list")
+	execCommand(client, "hset hash f1 v1 f2 v2")
+	execCommand(client, "sadd set a b c")
+	execCommand(client, "spop set 2")
+	execCommand(client, "zadd zset 1 a 2.5 b")
+	execCommand(client, "incrbyfloat float 0.1")
+	execCommand(client, "incrbyfloat float 0.2")
+	execCommand(client, "set gone v")
+	execCommand(client, "del gone")
+	execCommand(client, "select 2")
+	execCommand(client, "set db2key v")
+	execCommand(client, "move db2key 5")
+	ttl := server.dbs[0].getExpire(CreateObject(GSTR, "ttl"))
+	smembers := execCommand(client, "select 0") + execCommand(client, "smembers set")
+
+	client = reloadAof(t)
+	assert.Equal(t, 0, int(server.dirty))
+	assert.Equal(t, ":7\r\n", execCommand(client, "dbsize"))
+	assert.Equal(t, "$5\r\nhello\r\n", execCommand(client, "get str"))
+	assert.Equal(t, ":"+strconv.FormatInt(ttl, 10)+"\r\n", execCommand(client, "pexpiretime ttl"))
+	assert.Equal(t, "*2\r\n$1\r\nb\r\n$1\r\nc\r\n", execCommand(client, "lrange list 0 -1"))
+	assert.Equal(t, []string{"f1", "f2", "v1", "v2"}, parseBulkArray(execCommand(client, "hgetall hash")))
+	assert.Equal(t, smembers, "+OK\r\n"+execCommand(client, "smembers set"))
+	assert.Equal(t, "*4\r\n$1\r\na\r\n$1\r\n1\r\n$1\r\nb\r\n$3\r\n2.5\r\n", execCommand(client, "zrange zset 0 -1 withscores"))
+	assert.Equal(t, "$19\r\n0.30000000000000004\r\n", execCommand(client, "get float"))
+	execCommand(client, "select 5")
+	assert.Equal(t, "$1\r\nv\r\n", execCommand(client, "get db2key"))
+}
+
+func TestAofEmptyValue(t *testing.T) {
+	client := newAofTestClient(t)
+	execCommand(client, "*3\r\n$3\r\nset\r\n$1\r\ne\r\n$0\r\n")
+	execCommand(client, "*3\r\n$5\r\nlpush\r\n$1\r\nl\r\n$0\r\n")
+	execCommand(client, "set a 1")
+	data := readAof(t)
+	assert.Contains(t, data, aofCommands([]string{"set", "e", ""}))
+
+	client = reloadAof(t)
+	assert.Equal(t, ":3\r\n", execCommand(client, "dbsize"))
+	assert.Equal(t, "$0\r\n\r\n", execCommand(client, "get e"))
+	assert.Equal(t, "*1\r\n$0\r\n\r\n", execCommand(client, "lrange l 0 -1"))
+	assert.Equal(t, "$1\r\n1\r\n", execCommand(client, "get a"))
+	// 加载后文件没有被截断
+	assert.Equal(t, data, readAof(t))
+}
+
+func TestAofTruncated(t *testing.T) {
+	newTestClient()
+	filename := filepath.Join(t.TempDir(), DEFAULT_APPENDFILENAME)
+	cmds := [][]string{
+		{"SELECT", "0"},
+		{"SET", "k1", "v1"},
+		{"RPUSH", "k2", "a", "bb"},
+		{"SET", "k3", strings.Repeat("x", 300)},
+	}
+	var boundaries []int
+	for i := range cmds {
+		boundaries = append(boundaries, len(aofCommands(cmds[:i+1]...)))
+	}
+	content := aofCommands(cmds...)
+
+	server.aofLoadTruncated = false
+	assert.Nil(t, os.WriteFile(filename, []byte(content[:len(content)-1]), 0644))
+	assert.Equal(t, errAofTruncated, loadAppendOnlyFile(filename, true))
+
+	server.aofLoadTruncated = true
+	for l := 0; l <= len(content); l++ {
+		for i := range server.dbs {
+			server.dbs[i] = createDB(i)
+		}
+		assert.Nil(t, os.WriteFile(filename, []byte(content[:l]), 0644))
+		assert.Nil(t, loadAppendOnlyFile(filename, true))
+		complete := 0
+		valid := 0
+		for i, b := range boundaries {
+			if b <= l {
+				complete, valid = i, b
+			}
+		}
+		fi, err := os.Stat(filename)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(valid), fi.Size())
+		assert.Equal(t, int64(complete), server.dbs[0].data.Size())
+	}
+
+	assert.Nil(t, os.WriteFile(filename, []byte(content+"*1\r\n+OK\r\n"), 0644))
+	assert.NotNil(t, loadAppendOnlyFile(filename, true))
+	assert.False(t, server.loading)
+
+	// 只有最后一个文件允许截断
+	assert.Nil(t, os.WriteFile(filename, []byte(content[:len(content)-1]), 0644))
+	assert.NotNil(t, loadAppendOnlyFile(filename, false))
+	fi, err := os.Stat(filename)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(len(content)-1), fi.Size())
+}
+
+func TestAofFsync(t *testing.T) {
+	newAofTestClient(t)
+	server.aofFsync = AOF_FSYNC_ALWAYS
+	feedAppendOnlyFile(0, []*Gobj{CreateObject(GSTR, "DEL"), CreateObject(GSTR, "k")})
+	flushAppendOnlyFile()
+	assert.False(t, server.aofUnsynced)
+
+	server.aofFsync = AOF_FSYNC_EVERYSEC
+	feedAppendOnlyFile(0, []*Gobj{CreateObject(GSTR, "DEL"), CreateObject(GSTR, "k")})
+	flushAppendOnlyFile()
+	// 距离上次fsync不到1秒
+	assert.True(t, server.aofUnsynced)
+	server.aofLastFsync = time.Now().Add(-time.Second)
+	flushAppendOnlyFile()
+	assert.False(t, server.aofUnsynced)
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&aofFsyncInProgress) != 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, int32(0), atomic.LoadInt32(&aofFsyncInProgress))
+	assert.Contains(t, execCommand(newTestClient(), "info persistence"), "aof_last_write_status:ok")
+}
+
+func waitAofRewrite(t *testing.T) {
+	deadline := time.Now().Add(time.Second)
+	for server.aofRewriteDone != nil {
+		if time.Now().After(deadline) {
+			t.Fatal("aof rewrite timeout")
+		}
+		aofCron()
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// 按db和key排序输出所有数据，用于比较重放前后的数据
+func dumpDataset(client *GodisClient) string {
+	var sb strings.Builder
+	for i := range server.dbs {
+		execCommand(client, "select "+strconv.Itoa(i))
+		keys := parseBulkArray(execCommand(client, "keys *"))
+		for _, key := range keys {
+			typ := execCommand(client, "type "+key)
+			sb.WriteString(strconv.Itoa(i) + " " + key + " " + typ + execCommand(client, "pexpiretime "+key))
+			switch typ {
+			case "+string\r\n":
+				sb.WriteString(execCommand(client, "get "+key))
+			case "+list\r\n":
+				sb.WriteString(execCommand(client, "lrange "+key+" 0 -1"))
+			case "+set\r\n":
+				sb.WriteString(strings.Join(parseBulkArray(execCommand(client, "smembers "+key)), ","))
+			case "+hash\r\n":
+				sb.WriteString(strings.Join(parseBulkArray(execCommand(client, "hgetall "+key)), ","))
+			case "+zset\r\n":
+				sb.WriteString(execCommand(client, "zrange "+key+" 0 -1 withscores"))
+			}
+			sb.WriteString("\n")
+		}
+	}
+	execCommand(client, "select 0")
+	return sb.String()
+}
+
+func TestAofRewrite(t *testing.T) {
+	for _, rdb := range []bool{false, true} {
+		testAofRewrite(t, rdb)
+	}
+}
+
+func testAofRewrite(t *testing.T, rdb bool) {
+	client := newAofTestClient(t)
+	server.aofUseRdbPreamble = rdb
+	for i := 0; i < 150; i++ {
+		n := strconv.Itoa(i)
+		execCommand(client, "rpush list "+n)
+		execCommand(client, "sadd set m"+n)
+		execCommand(client, "hset hash f"+n+" v"+n)
+		execCommand(client, "zadd zset "+n+".5 m"+n)
+		execCommand(client, "append big "+strings.Repeat("x", 100))
+		execCommand(client, "incr counter")
+	}
+	execCommand(client, "lpop list")
+	execCommand(client, "zadd zset -inf min")
+	execCommand(client, "set ttl v ex 100")
+	execCommand(client, "select 3")
+	execCommand(client, "set db3 v")
+	execCommand(client, "select 0")
+	before := dumpDataset(client)
+	old := server.aofManifest
+
+	assert.Equal(t, "+Background append only file rewriting started\r\n", execCommand(client, "bgrewriteaof"))
+	assert.Equal(t, "-ERR Background append only file rewriting already in progress\r\n", execCommand(client, "bgrewriteaof"))
+	assert.Contains(t, execCommand(client, "info persistence"), "aof_rewrite_in_progress:1")
+	// 重写期间的修改写入新的incr文件
+	assert.Equal(t, int64(2), server.aofManifest.currIncrSeq)
+	execCommand(client, "select 5")
+	execCommand(client, "set during v")
+	execCommand(client, "select 0")
+	execCommand(client, "rpush list during")
+	waitAofRewrite(t)
+	execCommand(client, "set after v")
+	after := dumpDataset(client)
+	assert.NotEqual(t, before, after)
+
+	m := server.aofManifest
+	suffix := ".2.base.aof"
+	if rdb {
+		suffix = ".2.base.rdb"
+	}
+	assert.Equal(t, "file appendonly.aof"+suffix+" seq 2 type b\n"+
+		"file appendonly.aof.2.incr.aof seq 2 type i\n", m.String())
+	manifest, err := os.ReadFile(aofManifestPath())
+	assert.Nil(t, err)
+	assert.Equal(t, m.String(), string(manifest))
+	waitAofFilesRemoved(t, old.base.name, old.incrList[0].name)
+
+	base, err := os.ReadFile(aofFilePath(m.base.name))
+	assert.Nil(t, err)
+	if rdb {
+		assert.True(t, strings.HasPrefix(string(base), "REDIS"))
+	} else {
+		assert.True(t, strings.HasPrefix(string(base), "*2\r\n$6\r\nSELECT\r\n$1\r\n0\r\n"))
+		assert.NotContains(t, string(base), "incr")
+	}
+	data := readAof(t)
+	assert.Equal(t, aofCommands(
+		[]string{"SELECT", "5"},
+		[]string{"set", "during", "v"},
+		[]string{"SELECT", "0"},
+		[]string{"rpush", "list", "during"},
+		[]string{"set", "after", "v"},
+	), data)
+	assert.Equal(t, int64(len(base)+len(data)), server.aofCurrentSize)
+	assert.Contains(t, execCommand(client, "info persistence"), "aof_last_bgrewrite_status:ok")
+	_, err = os.Stat(aofRewriteTempFile())
+	assert.True(t, os.IsNotExist(err))
+
+	client = reloadAof(t)
+	assert.Equal(t, after, dumpDataset(client))
+	assert.Equal(t, ":15000\r\n", execCommand(client, "strlen big"))
+}
+
+func TestAofRewriteDisabled(t *testing.T) {
+	// 没有开启AOF时重写只生成当前数据的base文件
+	client := newTestClient()
+	server.aofDirname = filepath.Join(t.TempDir(), DEFAULT_APPENDDIRNAME)
+	execCommand(client, "set k v")
+	execCommand(client, "bgrewriteaof")
+	execCommand(client, "set k2 v")
+	waitAofRewrite(t)
+	assert.Nil(t, server.aofFile)
+	assert.Equal(t, "file appendonly.aof.1.base.aof seq 1 type b\n", server.aofManifest.String())
+	data, err := os.ReadFile(aofFilePath(server.aofManifest.base.name))
+	assert.Nil(t, err)
+	assert.Equal(t, aofCommands([]string{"SELECT", "0"}, []string{"SET", "k", "v"}), string(data))
+
+	// 之后开启AOF时在base之后创建incr文件
+	assert.Nil(t, openAppendOnlyFile())
+	t.Cleanup(closeAof)
+	assert.Equal(t, "file appendonly.aof.1.base.aof seq 1 type b\n"+
+		"file appendonly.aof.1.incr.aof seq 1 type i\n", server.aofManifest.String())
+}
+
+func TestAofAutoRewrite(t *testing.T) {
+	client := newAofTestClient(t)
+	server.aofRewritePerc = 100
+	server.aofRewriteMinSize = 100
+	execCommand(client, "set k "+strings.Repeat("x", 50))
+	flushAppendOnlyFile()
+	aofCron()
+	assert.Nil(t, server.aofRewriteDone)
+
+	for i := 0; i < 5; i++ {
+		execCommand(client, "set k "+strings.Repeat("x", 50))
+	}
+	flushAppendOnlyFile()
+	server.aofRewriteBaseSize = server.aofCurrentSize / 2
+	aofCron()
+	assert.NotNil(t, server.aofRewriteDone)
+	waitAofRewrite(t)
+	assert.Equal(t, server.aofCurrentSize, server.aofRewriteBaseSize)
+	base, err := os.ReadFile(aofFilePath(server.aofManifest.base.name))
+	assert.Nil(t, err)
+	assert.Equal(t, aofCommands([]string{"SELECT", "0"}, []string{"SET", "k", strings.Repeat("x", 50)}), string(base))
+	assert.Equal(t, "", readAof(t))
+}
+
+func TestAofManifest(t *testing.T) {
+	newTestClient()
+	data := "file appendonly.aof.3.base.rdb seq 3 type b\n" +
+		"file appendonly.aof.2.base.aof seq 2 type h\n" +
+		"file appendonly.aof.4.incr.aof seq 4 type i\n" +
+		"file appendonly.aof.5.incr.aof seq 5 type i\n"
+	m, err := parseAofManifest(data)
+	assert.Nil(t, err)
+	assert.Equal(t, data, m.String())
+	assert.Equal(t, int64(3), m.currBaseSeq)
+	assert.Equal(t, int64(5), m.currIncrSeq)
+
+	// 忽略注释和不认识的字段
+	m, err = parseAofManifest("# comment\nfile a seq 1 type b size 10\n")
+	assert.Nil(t, err)
+	assert.Equal(t, "file a seq 1 type b\n", m.String())
+
+	m.markRewrittenIncrAsHistory(true)
+	assert.Equal(t, "appendonly.aof.1.incr.aof", m.newIncrFile())
+	assert.Equal(t, "appendonly.aof.2.incr.aof", m.newIncrFile())
+	assert.Equal(t, "appendonly.aof.2.base.rdb", m.newBaseFile(true))
+	m.markRewrittenIncrAsHistory(true)
+	assert.Equal(t, "file appendonly.aof.2.base.rdb seq 2 type b\n"+
+		"file a seq 1 type h\n"+
+		"file appendonly.aof.1.incr.aof seq 1 type h\n"+
+		"file appendonly.aof.2.incr.aof seq 2 type i\n", m.String())
+
+	for _, invalid := range []string{
+		"file a seq 1 type b",
+		"file a seq 1 type\n",
+		"file a seq 0 type b\n",
+		"seq 1 type b\n",
+		"file a/b seq 1 type b\n",
+		"file a seq 1 type x\n",
+		"file a seq 1 type b\nfile b seq 2 type b\n",
+		"file a seq 2 type i\nfile b seq 1 type i\n",
+	} {
+		_, err = parseAofManifest(invalid)
+		assert.Equal(t, errAofManifestInvalid, err, invalid)
+	}
+}
+
+func TestAofLoadManifestFiles(t *testing.T) {
+	client := newTestClient()
+	server.aofDirname = filepath.Join(t.TempDir(), DEFAULT_APPENDDIRNAME)
+	assert.True(t, os.IsNotExist(loadAppendOnlyFiles()))
+
+	// 没有AOF文件时用当前数据创建base
+	execCommand(client, "set k v")
+	assert.Nil(t, openAppendOnlyFile())
+	execCommand(client, "set k2 v")
+	client = reloadAof(t)
+	assert.Equal(t, ":2\r\n", execCommand(client, "dbsize"))
+
+	// manifest中的文件不存在
+	assert.Nil(t, os.Remove(aofFilePath(server.aofManifest.base.name)))
+	client = newTestClient()
+	server.aofDirname = filepath.Dir(aofManifestPath())
+	assert.NotNil(t, loadAppendOnlyFiles())
+}
+
+func TestAofUpgrade(t *testing.T) {
+	client := newTestClient()
+	dir := t.TempDir()
+	server.aofDirname = filepath.Join(dir, DEFAULT_APPENDDIRNAME)
+	old := filepath.Join(dir, DEFAULT_APPENDFILENAME)
+	assert.Nil(t, os.WriteFile(old, []byte(aofCommands([]string{"SELECT", "0"}, []string{"SET", "k", "v"})), 0644))
+
+	assert.Nil(t, loadAppendOnlyFiles())
+	assert.Equal(t, "$1\r\nv\r\n", execCommand(client, "get k"))
+	_, err := os.Stat(old)
+	assert.True(t, os.IsNotExist(err))
+	manifest, err := os.ReadFile(aofManifestPath())
+	assert.Nil(t, err)
+	assert.Equal(t, "file appendonly.aof seq 1 type b\n", string(manifest))
+
+	assert.Nil(t, openAppendOnlyFile())
+	t.Cleanup(closeAof)
+	execCommand(client, "set k2 v")
+	client = reloadAof(t)
+	assert.Equal(t, ":2\r\n", execCommand(client, "dbsize"))
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"errors"
+	"fmt"
 	"log"
 	"strconv"
 	"strings"
@@ -11,14 +12,14 @@ type GodisClient struct {
 	fd      int
 	db      *GodisDB
 	args    []*Gobj
-	reply   *List
+	reply   *GobjList
 	sentLen int
 	// 每次write可能发送不完
 	queryBuf []byte
 	queryLen int
 	cmdTy    CmdType // 命令行类型
 	bulkNum  int     // bulk数组长度
-	bulkLen  int     // bulk数组每个元素的长度
+	bulkLen  int     // bulk数组当前元素的长度，为-1时表示还没有读取长度
 }
 
 type CmdType = byte
@@ -29,6 +30,9 @@ const (
 	COMMAND_BULK    CmdType = 0x02
 )
 
+// 没有连接的客户端使用的fd，例如加载AOF时
+const FAKE_CLIENT_FD = -1
+
 const (
 	GODIS_IO_BUF     int = 1024 * 16
 	GODIS_MAX_BULK   int = 1024 * 4
@@ -38,22 +42,49 @@ const (
 func CreateClient(fd int) *GodisClient {
 	return &GodisClient{
 		fd:       fd,
-		db:       server.db,
+		db:       server.dbs[0],
 		queryBuf: make([]byte, GODIS_IO_BUF),
-		reply:    ListCreate(ListType{EqualFunc: GStrEqual}),
+		bulkLen:  -1,
+		reply:    GobjListCreate(),
 	}
 }
 
+func createFakeClient() *GodisClient {
+	return CreateClient(FAKE_CLIENT_FD)
+}
+
 func (c *GodisClient) AddReplyStr(str string) {
 	o := CreateObject(GSTR, str)
 	c.AddReply(o)
 	o.DecrRefCount()
 }
 
+func (c *GodisClient) AddReplyBulk(o *Gobj) {
+	c.AddReplyBulkStr(o.StrVal())
+}
+
+func (c *GodisClient) AddReplyBulkStr(str string) {
+	c.AddReplyStr(fmt.Sprintf("$%d\r\n%v\r\n", len(str), str))
+}
+
+func (c *GodisClient) AddReplyInt(val int64) {
+	c.AddReplyStr(fmt.Sprintf(":%d\r\n", val))
+}
+
+func (c *GodisClient) AddReplyArrayLen(length int) {
+	c.AddReplyStr(fmt.Sprintf("*%d\r\n", length))
+}
+
+func (c *GodisClient) AddReplyError(msg string) {
+	c.AddReplyStr(fmt.Sprintf("-ERR %v\r\n", msg))
+}
+
 func (c *GodisClient) AddReply(o *Gobj) {
 	c.reply.Append(o)
 	o.IncrRefCount()
-	server.aeLoop.AddFileEvent(c.fd, AE_WRITABLE, SendReplyToClient, c)
+	if c.fd != FAKE_CLIENT_FD {
+		server.aeLoop.AddFileEvent(c.fd, AE_WRITABLE, SendReplyToClient, c)
+	}
 }
 
 func ReadQueryFromClient(loop *AeLoop, fd int, extra interface{}) {
@@ -99,7 +130,6 @@ func SendReplyToClient(loop *AeLoop, fd int, extra interface{}) {
 			log.Printf("send %v bytes to client %v\n", n, client.fd)
 			if client.sentLen == bufLen {
 				client.reply.DelNode(rep)
-				rep.Val.DecrRefCount()
 				client.sentLen = 0
 			} else {
 				// 可写缓冲区满了
@@ -191,7 +221,7 @@ func handleBulkBuf(client *GodisClient) (bool, error) {
 	}
 	// 每个数组元素的长度
 	for client.bulkNum > 0 {
-		if client.bulkLen == 0 {
+		if client.bulkLen < 0 {
 			index, err := client.findLineInQuery()
 			if index < 0 {
 				return false, err
@@ -202,10 +232,15 @@ func handleBulkBuf(client *GodisClient) (bool, error) {
 			}
 
 			blen, err := client.getNumInQuery(1, index)
-			if err != nil || blen == 0 {
+			if err != nil {
 				return false, err
 			}
-			if blen > GODIS_MAX_BULK {
+			// $0表示空字符串，长度不能为负数
+			if blen < 0 {
+				return false, errors.New("invalid bulk length")
+			}
+			// 加载AOF时不限制长度，重写后的字符串可能超过该值
+			if blen > GODIS_MAX_BULK && client.fd != FAKE_CLIENT_FD {
 				return false, errors.New("too big bulk")
 			}
 			client.bulkLen = blen
@@ -221,7 +256,7 @@ func handleBulkBuf(client *GodisClient) (bool, error) {
 		client.args[len(client.args)-client.bulkNum] = CreateObject(GSTR, string(client.queryBuf[:index]))
 		client.queryBuf = client.queryBuf[index+2:]
 		client.queryLen -= index + 2
-		client.bulkLen = 0
+		client.bulkLen = -1
 		client.bulkNum--
 	}
 	return true, nil
@@ -245,13 +280,13 @@ func (client *GodisClient) getNumInQuery(s, e int) (int, error) {
 func resetClient(client *GodisClient) {
 	freeArgs(client)
 	client.cmdTy = COMMAND_UNKNOWN
-	client.bulkLen = 0
+	client.bulkLen = -1
 	client.bulkNum = 0
 }
 
 func freeClient(client *GodisClient) {
 	freeArgs(client)
-	delete(server.clients, client.fd)
+	server.clients.Delete(client.fd)
 	server.aeLoop.RemoveFileEvent(client.fd, AE_READABLE)
 	server.aeLoop.RemoveFileEvent(client.fd, AE_WRITABLE)
 	freeReplyList(client)
@@ -259,11 +294,7 @@ func freeClient(client *GodisClient) {
 }
 
 func freeReplyList(client *GodisClient) {
-	for client.reply.length != 0 {
-		n := client.reply.head
-		client.reply.DelNode(n)
-		n.Val.DecrRefCount()
-	}
+	client.reply.Empty()
 }
 
 func freeArgs(client *GodisClient) {
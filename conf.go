@@ -7,11 +7,33 @@ import (
 )
 
 type Config struct {
-	Port int `josn:"port"`
+	Port       int    `josn:"port"`
+	Databases  int    `json:"databases"`
+	Dir        string `json:"dir"`
+	DbFilename string `json:"dbfilename"`
+	Save       string `json:"save"` // 为空字符串时关闭自动保存
+	// AOF
+	AppendOnly       bool   `json:"appendonly"`
+	AppendFilename   string `json:"appendfilename"`
+	AppendDirname    string `json:"appenddirname"` // dir下保存AOF文件的目录
+	AppendFsync      string `json:"appendfsync"`   // always, everysec或no
+	AofLoadTruncated bool   `json:"aof-load-truncated"`
+	// 重写时base文件使用RDB格式
+	AofUseRdbPreamble bool `json:"aof-use-rdb-preamble"`
+	// AOF文件比上次重写后增长的百分比，以及自动重写的最小文件大小（字节）
+	AutoAofRewritePercentage int   `json:"auto-aof-rewrite-percentage"`
+	AutoAofRewriteMinSize    int64 `json:"auto-aof-rewrite-min-size"`
 }
 
 func LoadConfig(path string) (config *Config, err error) {
-	config = &Config{}
+	config = &Config{
+		Save:                     DEFAULT_SAVE,
+		AppendFsync:              DEFAULT_APPENDFSYNC,
+		AofLoadTruncated:         true,
+		AofUseRdbPreamble:        true,
+		AutoAofRewritePercentage: DEFAULT_AOF_REWRITE_PERC,
+		AutoAofRewriteMinSize:    DEFAULT_AOF_REWRITE_MIN_SIZE,
+	}
 
 	file, err := os.Open(path)
 	if err != nil {
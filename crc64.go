@@ -0,0 +1,29 @@
+package main
+
+// RDB文件校验和使用的CRC-64-Jones，与redis一致：反射多项式，初始值和结果都不取反，
+// 所以不能直接使用hash/crc64（它会对初始值和结果取反）
+
+const CRC64_JONES_POLY uint64 = 0x95ac9329ac4bc9b5
+
+var crc64Table [256]uint64
+
+func init() {
+	for i := range crc64Table {
+		crc := uint64(i)
+		for j := 0; j < 8; j++ {
+			if crc&1 == 1 {
+				crc = crc>>1 ^ CRC64_JONES_POLY
+			} else {
+				crc >>= 1
+			}
+		}
+		crc64Table[i] = crc
+	}
+}
+
+func crc64(crc uint64, p []byte) uint64 {
+	for _, b := range p {
+		crc = crc64Table[byte(crc)^b] ^ crc>>8
+	}
+	return crc
+}
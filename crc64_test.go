@@ -0,0 +1,15 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCrc64(t *testing.T) {
+	assert.Equal(t, uint64(0xe9c6d914c4b8d9ca), crc64(0, []byte("123456789")))
+	// 分段计算结果相同
+	crc := crc64(0, []byte("1234"))
+	assert.Equal(t, uint64(0xe9c6d914c4b8d9ca), crc64(crc, []byte("56789")))
+	assert.Equal(t, uint64(0), crc64(0, nil))
+}
@@ -0,0 +1,539 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// 键空间的操作以及相关的命令实现，每个客户端通过c.db访问当前选择的db
+
+// 覆盖或删除key时，较大的value交给lazyfree协程释放
+var dbDictType = DictType[*Gobj, *Gobj]{
+	HashFunc:      GStrHash,
+	EqualFunc:     GStrEqual,
+	KeyDup:        gobjIncrRef,
+	ValDup:        gobjIncrRef,
+	KeyDestructor: gobjDecrRef,
+	ValDestructor: freeObjectAsync,
+}
+
+func createDB(id int) *GodisDB {
+	return &GodisDB{
+		id:     id,
+		data:   DictCreate(dbDictType),
+		expire: GobjDictCreate(),
+	}
+}
+
+func (db *GodisDB) findKeyRead(key *Gobj) *Gobj {
+	db.expireIfNeeded(key)
+	return db.data.Get(key)
+}
+
+// 会原地修改value的命令通过findKeyWrite查找。value同时被快照持有时，
+// 先复制一份替换到db中，字符串不会被原地修改，不需要复制。
+// 只读取、整体替换或移动value，以及只修改过期时间的命令使用findKeyRead，避免无谓的复制
+func (db *GodisDB) findKeyWrite(key *Gobj) *Gobj {
+	db.expireIfNeeded(key)
+	o := db.data.Get(key)
+	if o != nil && o.Type_ != GSTR && atomic.LoadInt32(&o.refCount) > 1 {
+		o = DupObject(o)
+		db.data.Set(key, o)
+		o.DecrRefCount()
+	}
+	return o
+}
+
+// 覆盖key的value，同时清除过期时间
+func (db *GodisDB) setKey(key, val *Gobj) {
+	db.data.Set(key, val)
+	db.expire.Delete(key)
+}
+
+// when为毫秒时间戳
+func (db *GodisDB) setExpire(key *Gobj, when int64) {
+	expObj := CreateFromInt(when)
+	db.expire.Set(key, expObj)
+	expObj.DecrRefCount()
+}
+
+// 返回key的过期时间，没有过期时间时返回-1
+func (db *GodisDB) getExpire(key *Gobj) int64 {
+	when := db.expire.Get(key)
+	if when == nil {
+		return -1
+	}
+	return when.IntVal()
+}
+
+// 同步删除key，value立即释放
+func (db *GodisDB) deleteKey(key *Gobj) bool {
+	return db.deleteGeneric(key, false)
+}
+
+// async为true时较大的value交给lazyfree协程释放
+func (db *GodisDB) deleteGeneric(key *Gobj, async bool) bool {
+	e := db.data.Unlink(key)
+	if e == nil {
+		return false
+	}
+	// 摘下的entry仍然持有key的引用，key可能只被db持有
+	db.expire.Delete(key)
+	if async {
+		freeObjectAsync(e.Val)
+	} else {
+		e.Val.DecrRefCount()
+	}
+	e.Val = nil
+	db.data.FreeUnlinkedEntry(e)
+	return true
+}
+
+// 只判断是否过期，不会修改db
+func (db *GodisDB) keyIsExpired(key *Gobj) bool {
+	when := db.getExpire(key)
+	return when != -1 && when <= GetMsTime()
+}
+
+func (db *GodisDB) expireIfNeeded(key *Gobj) {
+	if server.loading || !db.keyIsExpired(key) {
+		return
+	}
+	propagateExpire(db, key)
+	db.deleteKey(key)
+	server.statExpiredKeys++
+}
+
+func delCommand(c *GodisClient) {
+	delGenericCommand(c, false)
+}
+
+// 和DEL相同，但较大的value在后台释放
+func unlinkCommand(c *GodisClient) {
+	delGenericCommand(c, true)
+}
+
+func delGenericCommand(c *GodisClient, async bool) {
+	var deleted int64
+	for _, key := range c.args[1:] {
+		c.db.expireIfNeeded(key)
+		if c.db.deleteGeneric(key, async) {
+			deleted++
+		}
+	}
+	server.dirty += deleted
+	c.AddReplyInt(deleted)
+}
+
+// 重复的key会被重复计数
+func existsCommand(c *GodisClient) {
+	var count int64
+	for _, key := range c.args[1:] {
+		if c.db.findKeyRead(key) != nil {
+			count++
+		}
+	}
+	c.AddReplyInt(count)
+}
+
+func typeCommand(c *GodisClient) {
+	o := c.db.findKeyRead(c.args[1])
+	if o == nil {
+		c.AddReplyStr("+none\r\n")
+		return
+	}
+	c.AddReplyStr("+" + typeName(o) + "\r\n")
+}
+
+func renameCommand(c *GodisClient) {
+	renameGenericCommand(c, false)
+}
+
+func renamenxCommand(c *GodisClient) {
+	renameGenericCommand(c, true)
+}
+
+// 将value连同过期时间一起转移到新的key
+func renameGenericCommand(c *GodisClient, nx bool) {
+	src, dst := c.args[1], c.args[2]
+	o := c.db.findKeyRead(src)
+	if o == nil {
+		c.AddReplyStr(shared.noSuchKey)
+		return
+	}
+	if GStrEqual(src, dst) {
+		if nx {
+			c.AddReplyStr(shared.czero)
+		} else {
+			c.AddReplyStr(shared.ok)
+		}
+		return
+	}
+	if nx && c.db.findKeyRead(dst) != nil {
+		c.AddReplyStr(shared.czero)
+		return
+	}
+	when := c.db.getExpire(src)
+	o.IncrRefCount()
+	c.db.deleteKey(src)
+	c.db.setKey(dst, o)
+	o.DecrRefCount()
+	if when != -1 {
+		c.db.setExpire(dst, when)
+	}
+	server.dirty++
+	if nx {
+		c.AddReplyStr(shared.cone)
+	} else {
+		c.AddReplyStr(shared.ok)
+	}
+}
+
+// COPY source destination [DB destination-db] [REPLACE]
+func copyCommand(c *GodisClient) {
+	var replace bool
+	dst := c.db
+	for i := 3; i < len(c.args); i++ {
+		arg := strings.ToLower(c.args[i].StrVal())
+		if arg == "replace" {
+			replace = true
+		} else if arg == "db" && i+1 < len(c.args) {
+			i++
+			var ok bool
+			if dst, ok = getDBOrReply(c, c.args[i]); !ok {
+				return
+			}
+		} else {
+			c.AddReplyStr(shared.syntaxErr)
+			return
+		}
+	}
+	srckey, dstkey := c.args[1], c.args[2]
+	if dst == c.db && GStrEqual(srckey, dstkey) {
+		c.AddReplyError("source and destination objects are the same")
+		return
+	}
+	o := c.db.findKeyRead(srckey)
+	if o == nil {
+		c.AddReplyStr(shared.czero)
+		return
+	}
+	if dst.findKeyRead(dstkey) != nil && !replace {
+		c.AddReplyStr(shared.czero)
+		return
+	}
+	dup := DupObject(o)
+	dst.setKey(dstkey, dup)
+	dup.DecrRefCount()
+	if when := c.db.getExpire(srckey); when != -1 {
+		dst.setExpire(dstkey, when)
+	}
+	server.dirty++
+	c.AddReplyStr(shared.cone)
+}
+
+func touchCommand(c *GodisClient) {
+	existsCommand(c)
+}
+
+// 遍历整个键空间，会阻塞服务，生产环境应该使用SCAN
+func keysCommand(c *GodisClient) {
+	pattern := c.args[1].StrVal()
+	allkeys := pattern == "*"
+	var keys []string
+	// 安全迭代器允许在遍历过程中删除过期的key
+	iter := c.db.data.SafeIterator()
+	for e := iter.Next(); e != nil; e = iter.Next() {
+		key := e.Key
+		if !allkeys && !stringMatch(pattern, key.StrVal(), false) {
+			continue
+		}
+		if c.db.keyIsExpired(key) {
+			key.IncrRefCount()
+			c.db.expireIfNeeded(key)
+			key.DecrRefCount()
+			continue
+		}
+		keys = append(keys, key.StrVal())
+	}
+	iter.Release()
+	c.AddReplyArrayLen(len(keys))
+	for _, key := range keys {
+		c.AddReplyBulkStr(key)
+	}
+}
+
+// 随机返回一个key，抽到已过期的key时删除后重新抽取
+func randomkeyCommand(c *GodisClient) {
+	for {
+		entry := c.db.data.RandomGet()
+		if entry == nil {
+			c.AddReplyStr(shared.nullBulk)
+			return
+		}
+		key := entry.Key
+		if c.db.keyIsExpired(key) {
+			key.IncrRefCount()
+			c.db.expireIfNeeded(key)
+			key.DecrRefCount()
+			continue
+		}
+		c.AddReplyBulk(key)
+		return
+	}
+}
+
+func dbsizeCommand(c *GodisClient) {
+	c.AddReplyInt(c.db.data.Size())
+}
+
+func getDBOrReply(c *GodisClient, o *Gobj) (*GodisDB, bool) {
+	id, ok := getIntOrReply(c, o)
+	if !ok {
+		return nil, false
+	}
+	if id < 0 || id >= int64(len(server.dbs)) {
+		c.AddReplyError("DB index is out of range")
+		return nil, false
+	}
+	return server.dbs[id], true
+}
+
+func selectCommand(c *GodisClient) {
+	db, ok := getDBOrReply(c, c.args[1])
+	if !ok {
+		return
+	}
+	c.db = db
+	c.AddReplyStr(shared.ok)
+}
+
+// 将key连同过期时间移动到另一个db，目标db中已存在时不移动
+func moveCommand(c *GodisClient) {
+	dst, ok := getDBOrReply(c, c.args[2])
+	if !ok {
+		return
+	}
+	if dst == c.db {
+		c.AddReplyError("source and destination objects are the same")
+		return
+	}
+	key := c.args[1]
+	o := c.db.findKeyRead(key)
+	if o == nil || dst.findKeyRead(key) != nil {
+		c.AddReplyStr(shared.czero)
+		return
+	}
+	when := c.db.getExpire(key)
+	dst.setKey(key, o)
+	if when != -1 {
+		dst.setExpire(key, when)
+	}
+	c.db.deleteKey(key)
+	server.dirty++
+	c.AddReplyStr(shared.cone)
+}
+
+// 交换两个db的数据，已经选择这两个db的客户端会看到交换后的数据
+func swapdbCommand(c *GodisClient) {
+	var ids [2]int64
+	for i, name := range []string{"first", "second"} {
+		id, err := strconv.ParseInt(c.args[i+1].StrVal(), 10, 64)
+		if err != nil {
+			c.AddReplyError(fmt.Sprintf("invalid %v DB index", name))
+			return
+		}
+		if id < 0 || id >= int64(len(server.dbs)) {
+			c.AddReplyError("DB index is out of range")
+			return
+		}
+		ids[i] = id
+	}
+	db1, db2 := server.dbs[ids[0]], server.dbs[ids[1]]
+	db1.data, db2.data = db2.data, db1.data
+	db1.expire, db2.expire = db2.expire, db1.expire
+	server.dirty++
+	c.AddReplyStr(shared.ok)
+}
+
+// 解析FLUSHDB和FLUSHALL的ASYNC/SYNC参数
+func getFlushTypeOrReply(c *GodisClient) (bool, bool) {
+	if len(c.args) > 2 {
+		c.AddReplyStr(shared.syntaxErr)
+		return false, false
+	}
+	if len(c.args) == 1 {
+		return false, true
+	}
+	switch strings.ToLower(c.args[1].StrVal()) {
+	case "async":
+		return true, true
+	case "sync":
+		return false, true
+	}
+	c.AddReplyStr(shared.syntaxErr)
+	return false, false
+}
+
+// 换上新的dict，旧的dict同步或在后台释放，返回删除的key数
+func (db *GodisDB) empty(async bool) int64 {
+	data, expire := db.data, db.expire
+	removed := data.Size()
+	db.data, db.expire = DictCreate(dbDictType), GobjDictCreate()
+	if async {
+		freeKeyspaceAsync(data, expire)
+	} else {
+		freeKeyspace(data, expire)
+	}
+	return removed
+}
+
+// FLUSHDB [ASYNC | SYNC]
+func flushdbCommand(c *GodisClient) {
+	async, ok := getFlushTypeOrReply(c)
+	if !ok {
+		return
+	}
+	// 与redis一致，db为空时也写入AOF
+	server.dirty += c.db.empty(async) + 1
+	c.AddReplyStr(shared.ok)
+}
+
+// FLUSHALL [ASYNC | SYNC]
+func flushallCommand(c *GodisClient) {
+	async, ok := getFlushTypeOrReply(c)
+	if !ok {
+		return
+	}
+	for _, db := range server.dbs {
+		server.dirty += db.empty(async)
+	}
+	server.dirty++
+	c.AddReplyStr(shared.ok)
+}
+
+// 解析SCAN命令的cursor参数
+func parseScanCursorOrReply(c *GodisClient, o *Gobj) (uint64, bool) {
+	cursor, err := strconv.ParseUint(o.StrVal(), 10, 64)
+	if err != nil {
+		c.AddReplyError("invalid cursor")
+		return 0, false
+	}
+	return cursor, true
+}
+
+// SCAN/HSCAN/SSCAN/ZSCAN的通用实现，o为nil时遍历整个键空间，
+// optIdx为第一个可选参数的下标
+func scanGenericCommand(c *GodisClient, o *Gobj, cursor uint64, optIdx int) {
+	count := int64(10)
+	var pattern, typ string
+	var hasType, noValues bool
+	for i := optIdx; i < len(c.args); i++ {
+		arg := strings.ToLower(c.args[i].StrVal())
+		hasNext := i+1 < len(c.args)
+		switch {
+		case arg == "count" && hasNext:
+			i++
+			var ok bool
+			if count, ok = getIntOrReply(c, c.args[i]); !ok {
+				return
+			}
+			if count < 1 {
+				c.AddReplyStr(shared.syntaxErr)
+				return
+			}
+		case arg == "match" && hasNext:
+			i++
+			pattern = c.args[i].StrVal()
+		case arg == "type" && hasNext && o == nil:
+			i++
+			typ = strings.ToLower(c.args[i].StrVal())
+			hasType = true
+		case arg == "novalues" && o != nil && o.Type_ == GDICT:
+			noValues = true
+		default:
+			c.AddReplyStr(shared.syntaxErr)
+			return
+		}
+	}
+	var dict *GobjDict
+	if o == nil {
+		dict = c.db.data
+	} else if o.Type_ == GZSET {
+		dict = o.Val_.(*ZSet).dict
+	} else {
+		dict = o.Val_.(*GobjDict)
+	}
+	// 先收集再过滤，过滤时可能会删除过期的key
+	var entries []*GobjEntry
+	collect := func(e *GobjEntry) {
+		e.Key.IncrRefCount()
+		if e.Val != nil {
+			e.Val.IncrRefCount()
+		}
+		entries = append(entries, &GobjEntry{Key: e.Key, Val: e.Val})
+	}
+	// 限制遍历的桶数，避免稀疏的dict阻塞太久
+	maxIterations := count * 10
+	for {
+		cursor = dict.Scan(cursor, collect)
+		maxIterations--
+		if cursor == 0 || maxIterations <= 0 || int64(len(entries)) >= count {
+			break
+		}
+	}
+	var reply []*Gobj
+	for _, e := range entries {
+		keep := pattern == "" || stringMatch(pattern, e.Key.StrVal(), false)
+		if keep && o == nil {
+			val := c.db.findKeyRead(e.Key)
+			keep = val != nil && (!hasType || typeName(val) == typ)
+		}
+		if keep {
+			reply = append(reply, e.Key)
+			if o != nil && o.Type_ != GSET && !noValues {
+				reply = append(reply, e.Val)
+			}
+		}
+	}
+	c.AddReplyArrayLen(2)
+	c.AddReplyBulkStr(strconv.FormatUint(cursor, 10))
+	c.AddReplyArrayLen(len(reply))
+	for _, r := range reply {
+		c.AddReplyBulk(r)
+	}
+	for _, e := range entries {
+		e.Key.DecrRefCount()
+		if e.Val != nil {
+			e.Val.DecrRefCount()
+		}
+	}
+}
+
+// SCAN cursor [MATCH pattern] [COUNT count] [TYPE type]
+func scanCommand(c *GodisClient) {
+	cursor, ok := parseScanCursorOrReply(c, c.args[1])
+	if !ok {
+		return
+	}
+	scanGenericCommand(c, nil, cursor, 2)
+}
+
+// HSCAN/SSCAN/ZSCAN的通用部分，key不存在时返回空的结果
+func scanKeyGenericCommand(c *GodisClient, typ Gtype) {
+	cursor, ok := parseScanCursorOrReply(c, c.args[2])
+	if !ok {
+		return
+	}
+	o := c.db.findKeyRead(c.args[1])
+	if o == nil {
+		c.AddReplyStr("*2\r\n$1\r\n0\r\n" + shared.emptyArray)
+		return
+	}
+	if !checkType(c, o, typ) {
+		return
+	}
+	scanGenericCommand(c, o, cursor, 3)
+}
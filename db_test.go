@@ -0,0 +1,260 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDelExistsType(t *testing.T) {
+	client := newTestClient()
+	execCommand(client, "mset a 1 b 2")
+	execCommand(client, "rpush l x")
+	execCommand(client, "sadd s x")
+	execCommand(client, "zadd z 1 x")
+	execCommand(client, "hset h f v")
+	assert.Equal(t, ":3\r\n", execCommand(client, "exists a a none l"))
+	assert.Equal(t, "+string\r\n", execCommand(client, "type a"))
+	assert.Equal(t, "+list\r\n", execCommand(client, "type l"))
+	assert.Equal(t, "+set\r\n", execCommand(client, "type s"))
+	assert.Equal(t, "+zset\r\n", execCommand(client, "type z"))
+	assert.Equal(t, "+hash\r\n", execCommand(client, "type h"))
+	assert.Equal(t, "+none\r\n", execCommand(client, "type none"))
+	assert.Equal(t, ":2\r\n", execCommand(client, "touch a b c"))
+
+	assert.Equal(t, ":2\r\n", execCommand(client, "del a b none"))
+	assert.Equal(t, ":1\r\n", execCommand(client, "unlink l"))
+	assert.Equal(t, ":0\r\n", execCommand(client, "exists a b l"))
+}
+
+func TestRename(t *testing.T) {
+	client := newTestClient()
+	execCommand(client, "set a 1 ex 100")
+	assert.Equal(t, shared.ok, execCommand(client, "rename a b"))
+	assert.Equal(t, shared.nullBulk, execCommand(client, "get a"))
+	assert.Equal(t, "$1\r\n1\r\n", execCommand(client, "get b"))
+	assert.NotNil(t, server.dbs[0].expire.Get(CreateObject(GSTR, "b")))
+	assert.Nil(t, server.dbs[0].expire.Get(CreateObject(GSTR, "a")))
+	assert.Equal(t, shared.noSuchKey, execCommand(client, "rename a b"))
+	assert.Equal(t, shared.ok, execCommand(client, "rename b b"))
+
+	execCommand(client, "set c 3")
+	assert.Equal(t, shared.czero, execCommand(client, "renamenx b c"))
+	assert.Equal(t, shared.cone, execCommand(client, "renamenx b d"))
+	assert.Equal(t, shared.ok, execCommand(client, "rename d c"))
+	assert.Equal(t, "$1\r\n1\r\n", execCommand(client, "get c"))
+	assert.NotNil(t, server.dbs[0].expire.Get(CreateObject(GSTR, "c")))
+}
+
+func TestCopy(t *testing.T) {
+	client := newTestClient()
+	execCommand(client, "rpush l a b")
+	execCommand(client, "sadd s a b")
+	execCommand(client, "hset h f v")
+	execCommand(client, "zadd z 1 a 2 b")
+	execCommand(client, "set str v px 100000")
+	for _, key := range []string{"l", "s", "h", "z", "str"} {
+		assert.Equal(t, shared.cone, execCommand(client, "copy "+key+" "+key+"2"))
+	}
+	// 修改副本不影响原来的value
+	execCommand(client, "rpush l2 c")
+	execCommand(client, "sadd s2 c")
+	execCommand(client, "hset h2 f v2")
+	execCommand(client, "zadd z2 3 c")
+	assert.Equal(t, ":2\r\n", execCommand(client, "llen l"))
+	assert.Equal(t, ":2\r\n", execCommand(client, "scard s"))
+	assert.Equal(t, "$1\r\nv\r\n", execCommand(client, "hget h f"))
+	assert.Equal(t, ":2\r\n", execCommand(client, "zcard z"))
+	assert.Equal(t, "*2\r\n$1\r\na\r\n$1\r\nb\r\n", execCommand(client, "zrange z2 0 1"))
+	assert.NotNil(t, server.dbs[0].expire.Get(CreateObject(GSTR, "str2")))
+
+	assert.Equal(t, shared.czero, execCommand(client, "copy l s"))
+	assert.Equal(t, shared.cone, execCommand(client, "copy l s replace"))
+	assert.Equal(t, "+list\r\n", execCommand(client, "type s"))
+	assert.Equal(t, shared.czero, execCommand(client, "copy none x"))
+	assert.Equal(t, "-ERR source and destination objects are the same\r\n", execCommand(client, "copy l l"))
+	assert.Equal(t, shared.syntaxErr, execCommand(client, "copy l x foo"))
+
+	assert.Equal(t, shared.cone, execCommand(client, "copy str str db 1"))
+	assert.Equal(t, "v", server.dbs[1].data.Get(CreateObject(GSTR, "str")).StrVal())
+	assert.NotNil(t, server.dbs[1].expire.Get(CreateObject(GSTR, "str")))
+	assert.Equal(t, "-ERR DB index is out of range\r\n", execCommand(client, "copy str str db 16"))
+}
+
+func TestSelectMove(t *testing.T) {
+	client := newTestClient()
+	assert.Equal(t, 16, len(server.dbs))
+	execCommand(client, "set a 1 ex 100")
+	execCommand(client, "set b 2")
+	assert.Equal(t, shared.ok, execCommand(client, "select 1"))
+	assert.Equal(t, shared.nullBulk, execCommand(client, "get a"))
+	execCommand(client, "set b 3")
+	assert.Equal(t, "-ERR DB index is out of range\r\n", execCommand(client, "select 16"))
+	assert.Equal(t, "-ERR DB index is out of range\r\n", execCommand(client, "select -1"))
+	assert.Equal(t, shared.ok, execCommand(client, "select 0"))
+
+	assert.Equal(t, shared.cone, execCommand(client, "move a 1"))
+	assert.Equal(t, shared.czero, execCommand(client, "exists a"))
+	assert.Equal(t, shared.czero, execCommand(client, "move b 1"))
+	assert.Equal(t, shared.czero, execCommand(client, "move none 1"))
+	assert.Equal(t, "-ERR source and destination objects are the same\r\n", execCommand(client, "move b 0"))
+	execCommand(client, "select 1")
+	assert.Equal(t, "$1\r\n1\r\n", execCommand(client, "get a"))
+	assert.Equal(t, ":100\r\n", execCommand(client, "ttl a"))
+	assert.Equal(t, "$1\r\n3\r\n", execCommand(client, "get b"))
+
+	// 另一个客户端有独立的当前db
+	other := CreateClient(server.fd)
+	assert.Equal(t, "$1\r\n2\r\n", execCommand(other, "get b"))
+
+	var conf Config
+	conf.Databases = 4
+	initServer(&conf)
+	assert.Equal(t, 4, len(server.dbs))
+}
+
+// value被快照持有时，只修改过期时间、移动或覆盖value的命令不复制value
+func TestSharedValueNotCopied(t *testing.T) {
+	client := newTestClient()
+	execCommand(client, "hset h f v")
+	execCommand(client, "set s v")
+	key := CreateObject(GSTR, "h")
+	o := server.dbs[0].data.Get(key)
+	o.IncrRefCount()
+	for _, cmd := range []string{"expire h 100", "persist h", "rename h h2", "renamenx h2 h",
+		"msetnx h 1", "copy s h", "set h x nx"} {
+		execCommand(client, cmd)
+		name := "h"
+		if cmd == "rename h h2" {
+			name = "h2"
+		}
+		assert.Same(t, o, server.dbs[0].data.Get(CreateObject(GSTR, name)), cmd)
+	}
+	assert.Equal(t, shared.cone, execCommand(client, "move h 1"))
+	assert.Same(t, o, server.dbs[1].data.Get(key))
+	execCommand(client, "select 1")
+	assert.Equal(t, shared.ok, execCommand(client, "set h v"))
+	assert.Equal(t, int32(1), o.refCount)
+	assert.Equal(t, int64(1), o.Val_.(*GobjDict).Size())
+	o.DecrRefCount()
+}
+
+func TestSwapdbFlush(t *testing.T) {
+	client := newTestClient()
+	other := CreateClient(server.fd)
+	execCommand(client, "set a 0")
+	execCommand(other, "select 2")
+	execCommand(other, "set a 2 ex 100")
+	assert.Equal(t, shared.ok, execCommand(client, "swapdb 0 2"))
+	assert.Equal(t, "$1\r\n2\r\n", execCommand(client, "get a"))
+	assert.Equal(t, ":100\r\n", execCommand(client, "ttl a"))
+	assert.Equal(t, "$1\r\n0\r\n", execCommand(other, "get a"))
+	assert.Equal(t, "-ERR invalid first DB index\r\n", execCommand(client, "swapdb x 0"))
+	assert.Equal(t, "-ERR invalid second DB index\r\n", execCommand(client, "swapdb 0 x"))
+	assert.Equal(t, "-ERR DB index is out of range\r\n", execCommand(client, "swapdb 0 16"))
+
+	assert.Equal(t, shared.ok, execCommand(client, "flushdb"))
+	assert.Equal(t, ":0\r\n", execCommand(client, "dbsize"))
+	assert.Equal(t, 0, int(server.dbs[0].expire.Size()))
+	assert.Equal(t, ":1\r\n", execCommand(other, "dbsize"))
+	assert.Equal(t, shared.syntaxErr, execCommand(client, "flushdb foo"))
+	assert.Equal(t, shared.syntaxErr, execCommand(client, "flushall async sync"))
+
+	for i := 0; i < 100; i++ {
+		execCommand(client, "set k"+strconv.Itoa(i)+" v")
+	}
+	execCommand(client, "rpush l a b c")
+	assert.Equal(t, shared.ok, execCommand(client, "flushall async"))
+	assert.Equal(t, ":0\r\n", execCommand(client, "dbsize"))
+	assert.Equal(t, ":0\r\n", execCommand(other, "dbsize"))
+	execCommand(client, "set k v")
+	assert.Equal(t, shared.ok, execCommand(client, "flushall sync"))
+	assert.Equal(t, ":0\r\n", execCommand(client, "dbsize"))
+}
+
+// 用SCAN遍历直到cursor为0，返回所有结果
+func scanAll(client *GodisClient, cmd string) []string {
+	var result []string
+	cursor := "0"
+	for {
+		reply := execCommand(client, strings.Replace(cmd, "CURSOR", cursor, 1))
+		lines := strings.Split(reply, "\r\n")
+		cursor = lines[2]
+		result = append(result, parseBulkArray(strings.Join(lines[3:], "\r\n"))...)
+		if cursor == "0" {
+			break
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+func TestScan(t *testing.T) {
+	client := newTestClient()
+	var keys []string
+	for i := 0; i < 100; i++ {
+		keys = append(keys, "key:"+strconv.Itoa(i))
+		execCommand(client, "set key:"+strconv.Itoa(i)+" v")
+	}
+	sort.Strings(keys)
+	execCommand(client, "rpush list a")
+	execCommand(client, "sadd set a")
+	assert.Equal(t, keys, scanAll(client, "scan CURSOR match key:*"))
+	assert.Equal(t, keys, scanAll(client, "scan CURSOR count 3 type string"))
+	assert.Equal(t, []string{"list"}, scanAll(client, "scan CURSOR type list"))
+	assert.Equal(t, 102, len(scanAll(client, "scan CURSOR count 1000")))
+	assert.Equal(t, []string{"key:1", "key:10", "key:11"}, scanAll(client, "scan CURSOR match key:1? match key:1*")[:3])
+
+	execCommand(client, "set expired v")
+	server.dbs[0].setExpire(CreateObject(GSTR, "expired"), 1)
+	assert.Equal(t, []string(nil), scanAll(client, "scan CURSOR match expired"))
+
+	assert.Equal(t, "-ERR invalid cursor\r\n", execCommand(client, "scan x"))
+	assert.Equal(t, shared.syntaxErr, execCommand(client, "scan 0 count 0"))
+	assert.Equal(t, shared.syntaxErr, execCommand(client, "scan 0 foo"))
+}
+
+func TestScanCollections(t *testing.T) {
+	client := newTestClient()
+	execCommand(client, "hset h f1 v1 f2 v2 g v3")
+	execCommand(client, "sadd s a b c")
+	execCommand(client, "zadd z 1 a 2.5 b")
+	assert.Equal(t, []string{"f1", "f2", "v1", "v2"}, scanAll(client, "hscan h CURSOR match f*"))
+	assert.Equal(t, []string{"f1", "f2", "g"}, scanAll(client, "hscan h CURSOR novalues"))
+	assert.Equal(t, []string{"a", "b", "c"}, scanAll(client, "sscan s CURSOR count 1"))
+	assert.Equal(t, []string{"1", "2.5", "a", "b"}, scanAll(client, "zscan z CURSOR"))
+	assert.Equal(t, "*2\r\n$1\r\n0\r\n*0\r\n", execCommand(client, "sscan none 0"))
+	assert.Equal(t, shared.wrongType, execCommand(client, "sscan h 0"))
+	assert.Equal(t, shared.syntaxErr, execCommand(client, "sscan s 0 type set"))
+	assert.Equal(t, shared.syntaxErr, execCommand(client, "sscan s 0 novalues"))
+}
+
+func TestKeysRandomkeyDbsize(t *testing.T) {
+	client := newTestClient()
+	assert.Equal(t, shared.nullBulk, execCommand(client, "randomkey"))
+	assert.Equal(t, shared.czero, execCommand(client, "dbsize"))
+	execCommand(client, "mset user:1 a user:2 b user:10 c admin d")
+	execCommand(client, "set expired v")
+	server.dbs[0].setExpire(CreateObject(GSTR, "expired"), 1)
+	// 过期的key在被删除之前仍然计入dbsize
+	assert.Equal(t, ":5\r\n", execCommand(client, "dbsize"))
+	assert.Equal(t, []string{"admin", "user:1", "user:10", "user:2"}, parseBulkArray(execCommand(client, "keys *")))
+	assert.Equal(t, []string{"user:1", "user:2"}, parseBulkArray(execCommand(client, "keys user:?")))
+	assert.Equal(t, []string{"user:1", "user:10"}, parseBulkArray(execCommand(client, "keys user:1*")))
+	assert.Equal(t, []string{"user:2"}, parseBulkArray(execCommand(client, "keys user:[^1]*")))
+	assert.Equal(t, []string{}, parseBulkArray(execCommand(client, "keys none")))
+	// KEYS会删除遍历到的过期key
+	assert.Equal(t, ":4\r\n", execCommand(client, "dbsize"))
+
+	execCommand(client, "set expired v")
+	server.dbs[0].setExpire(CreateObject(GSTR, "expired"), 1)
+	for i := 0; i < 20; i++ {
+		assert.NotEqual(t, "$7\r\nexpired\r\n", execCommand(client, "randomkey"))
+	}
+	execCommand(client, "del user:1 user:2 user:10 admin")
+	assert.Equal(t, shared.nullBulk, execCommand(client, "randomkey"))
+	assert.Equal(t, shared.czero, execCommand(client, "dbsize"))
+}
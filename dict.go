@@ -3,7 +3,9 @@ package main
 import (
 	"errors"
 	"math"
+	"math/bits"
 	"math/rand"
+	"time"
 )
 
 const (
@@ -11,6 +13,8 @@ const (
 	INIT_SIZE    int64 = 8
 	FORCE_RATIO  int64 = 2
 	GROW_RATIO   int64 = 2
+	MIN_FILL     int64 = 10 // 填充率低于该百分比时缩容
+	REHASH_BATCH int   = 100
 )
 
 var (
@@ -19,104 +23,202 @@ var (
 	NK_ERR = errors.New("key doesnt exist error")
 )
 
-type Dict struct {
-	DictType
-	hts       [2]*htable
+type Dict[K, V any] struct {
+	DictType[K, V]
+	hts       [2]*htable[K, V]
 	rehashidx int64
+	iterators int // 存活的安全迭代器个数与PauseRehashing次数之和，不为0时暂停rehash
 }
 
-type DictType struct {
-	HashFunc  func(key *Gobj) int64
-	EqualFunc func(k1, k2 *Gobj) bool
+// KeyDup和ValDup在元素加入时调用，KeyDestructor和ValDestructor在元素移除时调用，都可以为nil
+type DictType[K, V any] struct {
+	HashFunc      func(key K) int64
+	EqualFunc     func(k1, k2 K) bool
+	KeyDup        func(key K) K
+	ValDup        func(val V) V
+	KeyDestructor func(key K)
+	ValDestructor func(val V)
 }
 
-type htable struct {
-	table []*Entry
+type htable[K, V any] struct {
+	table []*Entry[K, V]
 	size  int64
 	mask  int64 // 掩码
 	used  int64
 }
 
-type Entry struct {
-	Key  *Gobj
-	Val  *Gobj
-	next *Entry
+type Entry[K, V any] struct {
+	Key  K
+	Val  V
+	next *Entry[K, V]
 }
 
-func DictCreate(dictType DictType) *Dict {
-	return &Dict{
+func DictCreate[K, V any](dictType DictType[K, V]) *Dict[K, V] {
+	return &Dict[K, V]{
 		DictType:  dictType,
 		rehashidx: -1,
 	}
 }
 
-func (dict *Dict) Get(key *Gobj) *Gobj {
+func (dict *Dict[K, V]) Get(key K) V {
 	entry := dict.Find(key)
 	if entry == nil {
-		return nil
+		var zero V
+		return zero
 	}
 	return entry.Val
 }
 
 // 随机选择，可能是用于删除之类的
-func (dict *Dict) RandomGet() *Entry {
-	if dict.hts[0] == nil {
+func (dict *Dict[K, V]) RandomGet() *Entry[K, V] {
+	if dict.Size() == 0 {
 		return nil
 	}
-	t := 0
 	if dict.isRehashing() {
 		dict.rehashStep()
-		if dict.hts[1] != nil && dict.hts[1].used > dict.hts[1].used {
-			t = 1
-		}
-	}
-	// 获取随机的table结点
-	idx := rand.Int63n(dict.hts[t].size)
-	cnt := 0
-	for dict.hts[t].table[idx] == nil && cnt < 1000 {
-		idx = rand.Int63n(dict.hts[t].size)
-		cnt += 1
 	}
-	if dict.hts[t].table[idx] == nil {
-		return nil
+	// 获取随机的非空table结点，rehash过程中hts[0]里rehashidx之前的结点都是空的
+	var p *Entry[K, V]
+	for p == nil {
+		if dict.isRehashing() {
+			s0 := dict.hts[0].size
+			idx := dict.rehashidx + rand.Int63n(s0+dict.hts[1].size-dict.rehashidx)
+			if idx >= s0 {
+				p = dict.hts[1].table[idx-s0]
+			} else {
+				p = dict.hts[0].table[idx]
+			}
+		} else {
+			p = dict.hts[0].table[rand.Int63n(dict.hts[0].size)]
+		}
 	}
 	// 获取该结点里随机的元素
 	var listLen int64
-	p := dict.hts[t].table[idx]
+	head := p
 	for p != nil {
 		listLen += 1
 		p = p.next
 	}
 	listIdx := rand.Int63n(listLen)
-	p = dict.hts[t].table[idx]
+	p = head
 	for i := int64(0); i < listIdx; i++ {
 		p = p.next
 	}
 	return p
 }
 
-func (dict *Dict) Set(key, val *Gobj) {
+// 随机选择count个不同的元素，count不小于元素个数时返回全部
+func (dict *Dict[K, V]) RandomDistinct(count int64) []*Entry[K, V] {
+	size := dict.Size()
+	if count >= size || count*3 > size {
+		// 要取的元素较多时，直接打乱全部元素
+		entries := make([]*Entry[K, V], 0, size)
+		iter := dict.Iterator()
+		for e := iter.Next(); e != nil; e = iter.Next() {
+			entries = append(entries, e)
+		}
+		iter.Release()
+		rand.Shuffle(len(entries), func(i, j int) {
+			entries[i], entries[j] = entries[j], entries[i]
+		})
+		if count < size {
+			entries = entries[:count]
+		}
+		return entries
+	}
+	entries := make([]*Entry[K, V], 0, count)
+	picked := make(map[*Entry[K, V]]struct{}, count)
+	for int64(len(entries)) < count {
+		e := dict.RandomGet()
+		if _, ok := picked[e]; ok {
+			continue
+		}
+		picked[e] = struct{}{}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+func (dict *Dict[K, V]) Size() int64 {
+	var size int64
+	for _, ht := range dict.hts {
+		if ht != nil {
+			size += ht.used
+		}
+	}
+	return size
+}
+
+// 用安全迭代器遍历所有元素，fn中可以删除当前元素，以及查找dict
+func (dict *Dict[K, V]) forEach(fn func(e *Entry[K, V])) {
+	iter := dict.SafeIterator()
+	defer iter.Release()
+	for e := iter.Next(); e != nil; e = iter.Next() {
+		fn(e)
+	}
+}
+
+// 从cursor开始遍历一个桶（rehash时为两个表中对应的桶），返回下一个cursor，为0时遍历结束。
+// cursor按高位加一的方式递增，保证扩容和rehash过程中已有元素至少被返回一次，fn中不能修改dict
+func (dict *Dict[K, V]) Scan(cursor uint64, fn func(e *Entry[K, V])) uint64 {
+	if dict.Size() == 0 {
+		return 0
+	}
+	emit := func(ht *htable[K, V], idx uint64) {
+		e := ht.table[idx]
+		for e != nil {
+			next := e.next
+			fn(e)
+			e = next
+		}
+	}
+	if !dict.isRehashing() {
+		m0 := uint64(dict.hts[0].mask)
+		emit(dict.hts[0], cursor&m0)
+		cursor |= ^m0
+		cursor = bits.Reverse64(bits.Reverse64(cursor) + 1)
+		return cursor
+	}
+	t0, t1 := dict.hts[0], dict.hts[1]
+	if t0.size > t1.size {
+		t0, t1 = t1, t0
+	}
+	m0, m1 := uint64(t0.mask), uint64(t1.mask)
+	emit(t0, cursor&m0)
+	// 遍历大表中所有可以由小表的桶扩展出来的桶
+	for {
+		emit(t1, cursor&m1)
+		cursor |= ^m1
+		cursor = bits.Reverse64(bits.Reverse64(cursor) + 1)
+		if cursor&(m0^m1) == 0 {
+			break
+		}
+	}
+	return cursor
+}
+
+func (dict *Dict[K, V]) Set(key K, val V) {
 	if err := dict.Add(key, val); err == nil {
 		return
 	}
+	// 先保存新值再释放旧值，新旧值可能是同一个对象
 	entry := dict.Find(key)
-	entry.Val.DecrRefCount()
-	entry.Val = val
-	val.IncrRefCount()
+	old := entry.Val
+	entry.Val = dict.dupVal(val)
+	dict.freeVal(old)
 }
 
-func (dict *Dict) Add(key, val *Gobj) error {
+func (dict *Dict[K, V]) Add(key K, val V) error {
 	entry := dict.AddRaw(key)
 	if entry == nil {
 		return EX_ERR
 	}
-	entry.Val = val
-	val.IncrRefCount()
+	entry.Val = dict.dupVal(val)
 	return nil
 }
 
 // 每次查找，都rehash一步
-func (dict *Dict) Find(key *Gobj) *Entry {
+func (dict *Dict[K, V]) Find(key K) *Entry[K, V] {
 	if dict.hts[0] == nil {
 		return nil
 	}
@@ -141,11 +243,21 @@ func (dict *Dict) Find(key *Gobj) *Entry {
 	return nil
 }
 
-// 每次删除，都rehash一步
-func (dict *Dict) Delete(key *Gobj) error {
-	if dict.hts[0] == nil {
+func (dict *Dict[K, V]) Delete(key K) error {
+	e := dict.Unlink(key)
+	if e == nil {
 		return NK_ERR
 	}
+	dict.FreeUnlinkedEntry(e)
+	return nil
+}
+
+// 从dict中摘除元素但不调用析构回调，调用方用完后通过FreeUnlinkedEntry释放。
+// 每次摘除，都rehash一步
+func (dict *Dict[K, V]) Unlink(key K) *Entry[K, V] {
+	if dict.hts[0] == nil {
+		return nil
+	}
 	if dict.isRehashing() {
 		dict.rehashStep()
 	}
@@ -153,7 +265,7 @@ func (dict *Dict) Delete(key *Gobj) error {
 	for i := 0; i <= 1; i++ {
 		idx := h & dict.hts[i].mask
 		e := dict.hts[i].table[idx]
-		var prev *Entry
+		var prev *Entry[K, V]
 		for e != nil {
 			if dict.EqualFunc(e.Key, key) {
 				if prev == nil {
@@ -161,8 +273,10 @@ func (dict *Dict) Delete(key *Gobj) error {
 				} else {
 					prev.next = e.next
 				}
-				freeEntry(e)
-				return nil
+				dict.hts[i].used -= 1
+				e.next = nil
+				dict.ShrinkIfNeeded()
+				return e
 			}
 			prev = e
 			e = e.next
@@ -171,16 +285,69 @@ func (dict *Dict) Delete(key *Gobj) error {
 			break
 		}
 	}
-	return NK_ERR
+	return nil
 }
 
-func freeEntry(e *Entry) {
-	e.Key.DecrRefCount()
-	e.Val.DecrRefCount()
+func (dict *Dict[K, V]) FreeUnlinkedEntry(e *Entry[K, V]) {
+	dict.freeEntry(e)
+}
+
+// 暂停rehash后，查找等只读操作不会修改dict
+func (dict *Dict[K, V]) PauseRehashing() {
+	dict.iterators++
+}
+
+func (dict *Dict[K, V]) ResumeRehashing() {
+	dict.iterators--
+}
+
+// 删除所有元素，对每个元素调用析构回调
+func (dict *Dict[K, V]) Empty() {
+	for _, ht := range dict.hts {
+		if ht == nil {
+			continue
+		}
+		for _, e := range ht.table {
+			for e != nil {
+				next := e.next
+				dict.freeEntry(e)
+				e = next
+			}
+		}
+	}
+	dict.hts = [2]*htable[K, V]{}
+	dict.rehashidx = -1
+}
+
+func (dict *Dict[K, V]) dupKey(key K) K {
+	if dict.KeyDup != nil {
+		return dict.KeyDup(key)
+	}
+	return key
+}
+
+func (dict *Dict[K, V]) dupVal(val V) V {
+	if dict.ValDup != nil {
+		return dict.ValDup(val)
+	}
+	return val
+}
+
+func (dict *Dict[K, V]) freeVal(val V) {
+	if dict.ValDestructor != nil {
+		dict.ValDestructor(val)
+	}
+}
+
+func (dict *Dict[K, V]) freeEntry(e *Entry[K, V]) {
+	if dict.KeyDestructor != nil {
+		dict.KeyDestructor(e.Key)
+	}
+	dict.freeVal(e.Val)
 }
 
 // 每次AddRaw，都rehash一步
-func (dict *Dict) AddRaw(key *Gobj) *Entry {
+func (dict *Dict[K, V]) AddRaw(key K) *Entry[K, V] {
 	if dict.isRehashing() {
 		dict.rehashStep()
 	}
@@ -189,24 +356,23 @@ func (dict *Dict) AddRaw(key *Gobj) *Entry {
 		return nil
 	}
 
-	var ht *htable
+	var ht *htable[K, V]
 	if dict.isRehashing() {
 		ht = dict.hts[1]
 	} else {
 		ht = dict.hts[0]
 	}
-	e := Entry{
-		Key:  key,
+	e := Entry[K, V]{
+		Key:  dict.dupKey(key),
 		next: ht.table[idx],
 	}
-	key.IncrRefCount()
 	ht.table[idx] = &e
 	ht.used += 1
 	return &e
 }
 
 // 判断是否需要扩容，以及检验key是否存在
-func (dict *Dict) keyIndex(key *Gobj) int64 {
+func (dict *Dict[K, V]) keyIndex(key K) int64 {
 	err := dict.expandIfNeeded()
 	if err != nil {
 		return -1
@@ -231,7 +397,7 @@ func (dict *Dict) keyIndex(key *Gobj) int64 {
 	return idx
 }
 
-func (dict *Dict) expandIfNeeded() error {
+func (dict *Dict[K, V]) expandIfNeeded() error {
 	if dict.isRehashing() {
 		return nil
 	}
@@ -244,13 +410,26 @@ func (dict *Dict) expandIfNeeded() error {
 	return nil
 }
 
-func (dict *Dict) expand(size int64) error {
+// 元素过少时缩容，新的大小为能容纳所有元素的最小2的幂
+func (dict *Dict[K, V]) ShrinkIfNeeded() error {
+	if dict.isRehashing() || dict.hts[0] == nil {
+		return nil
+	}
+	ht := dict.hts[0]
+	if ht.size > INIT_SIZE && ht.used*100/ht.size < MIN_FILL {
+		return dict.expand(ht.used)
+	}
+	return nil
+}
+
+// 创建新的table并开始rehash，size可以比当前小，用于缩容
+func (dict *Dict[K, V]) expand(size int64) error {
 	sz := nextPower(size)
-	if dict.isRehashing() || (dict.hts[0] != nil && dict.hts[0].size >= sz) {
+	if dict.isRehashing() || (dict.hts[0] != nil && dict.hts[0].size == sz) {
 		return EP_ERR
 	}
-	ht := htable{
-		table: make([]*Entry, sz),
+	ht := htable[K, V]{
+		table: make([]*Entry[K, V], sz),
 		size:  sz,
 		mask:  sz - 1,
 		used:  0,
@@ -273,26 +452,27 @@ func nextPower(size int64) int64 {
 	return -1
 }
 
-func (dict *Dict) isRehashing() bool {
+func (dict *Dict[K, V]) isRehashing() bool {
 	return dict.rehashidx != -1
 }
 
-func (dict *Dict) rehashStep() {
-	//TODO: check iterators
-	dict.rehash(DEFAULT_STEP)
+// 有安全迭代器时不进行rehash，否则迭代器可能重复或遗漏元素
+func (dict *Dict[K, V]) rehashStep() {
+	if dict.iterators == 0 {
+		dict.rehash(DEFAULT_STEP)
+	}
 }
 
-func (dict *Dict) rehash(step int) {
-	for step > 0 {
-		if dict.hts[0].used == 0 {
-			dict.hts[0] = dict.hts[1]
-			dict.hts[1] = nil
-			dict.rehashidx = -1
-			return
-		}
-
+// 迁移step个桶，最多访问step*10个空桶，返回是否还需要继续rehash
+func (dict *Dict[K, V]) rehash(step int) bool {
+	emptyVisits := step * 10
+	for step > 0 && dict.hts[0].used != 0 {
 		for dict.hts[0].table[dict.rehashidx] == nil {
 			dict.rehashidx += 1
+			emptyVisits -= 1
+			if emptyVisits == 0 {
+				return true
+			}
 		}
 
 		entry := dict.hts[0].table[dict.rehashidx]
@@ -310,4 +490,122 @@ func (dict *Dict) rehash(step int) {
 		dict.rehashidx += 1
 		step -= 1
 	}
+	if dict.hts[0].used == 0 {
+		dict.hts[0] = dict.hts[1]
+		dict.hts[1] = nil
+		dict.rehashidx = -1
+		return false
+	}
+	return true
+}
+
+// 每次rehash REHASH_BATCH个桶，直到完成或者超过ms毫秒，返回迁移的桶数
+func (dict *Dict[K, V]) RehashMilliseconds(ms int64) int {
+	if dict.iterators > 0 || !dict.isRehashing() {
+		return 0
+	}
+	start := time.Now()
+	var rehashes int
+	for dict.rehash(REHASH_BATCH) {
+		rehashes += REHASH_BATCH
+		if time.Since(start).Milliseconds() >= ms {
+			break
+		}
+	}
+	return rehashes
+}
+
+// 安全迭代器存活期间暂停rehash，可以在遍历过程中修改dict；
+// 非安全迭代器只能读取，Release时校验指纹，dict被修改过则panic
+type DictIterator[K, V any] struct {
+	dict        *Dict[K, V]
+	table       int
+	index       int64
+	safe        bool
+	entry       *Entry[K, V]
+	nextEntry   *Entry[K, V]
+	fingerprint uint64
+}
+
+func (dict *Dict[K, V]) Iterator() *DictIterator[K, V] {
+	return &DictIterator[K, V]{
+		dict:  dict,
+		index: -1,
+	}
+}
+
+func (dict *Dict[K, V]) SafeIterator() *DictIterator[K, V] {
+	iter := dict.Iterator()
+	iter.safe = true
+	return iter
+}
+
+// 返回下一个元素，遍历结束时返回nil
+func (iter *DictIterator[K, V]) Next() *Entry[K, V] {
+	dict := iter.dict
+	for {
+		if iter.entry == nil {
+			if iter.index == -1 && iter.table == 0 {
+				if iter.safe {
+					dict.iterators++
+				} else {
+					iter.fingerprint = dict.fingerprint()
+				}
+			}
+			iter.index++
+			ht := dict.hts[iter.table]
+			if ht == nil || iter.index >= ht.size {
+				if !dict.isRehashing() || iter.table == 1 {
+					return nil
+				}
+				iter.table++
+				iter.index = 0
+				ht = dict.hts[1]
+			}
+			iter.entry = ht.table[iter.index]
+		} else {
+			iter.entry = iter.nextEntry
+		}
+		if iter.entry != nil {
+			// 提前保存next，当前元素可能会被删除
+			iter.nextEntry = iter.entry.next
+			return iter.entry
+		}
+	}
+}
+
+func (iter *DictIterator[K, V]) Release() {
+	if iter.index == -1 && iter.table == 0 {
+		return
+	}
+	if iter.safe {
+		iter.dict.iterators--
+	} else if iter.fingerprint != iter.dict.fingerprint() {
+		panic("dict modified during unsafe iteration")
+	}
+}
+
+// 根据两个table的状态计算指纹，dict被修改后指纹会发生变化
+func (dict *Dict[K, V]) fingerprint() uint64 {
+	var integers [7]int64
+	for i, ht := range dict.hts {
+		if ht != nil {
+			integers[i*3] = ht.size
+			integers[i*3+1] = ht.used
+			integers[i*3+2] = ht.mask
+		}
+	}
+	integers[6] = dict.rehashidx
+	var hash uint64
+	for _, n := range integers {
+		hash += uint64(n)
+		hash = (^hash) + (hash << 21)
+		hash ^= hash >> 24
+		hash = (hash + (hash << 3)) + (hash << 8)
+		hash ^= hash >> 14
+		hash = (hash + (hash << 2)) + (hash << 4)
+		hash ^= hash >> 28
+		hash += hash << 31
+	}
+	return hash
 }
@@ -2,13 +2,14 @@ package main
 
 import (
 	"fmt"
+	"strconv"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 )
 
 func TestDict(t *testing.T) {
-	dict := DictCreate(DictType{HashFunc: GStrHash, EqualFunc: GStrEqual})
+	dict := GobjDictCreate()
 	entry := dict.RandomGet()
 	assert.Nil(t, entry)
 
@@ -20,15 +21,15 @@ func TestDict(t *testing.T) {
 	entry = dict.Find(k1)
 	assert.Equal(t, k1, entry.Key)
 	assert.Equal(t, v1, entry.Val)
-	assert.Equal(t, 2, k1.refCount)
-	assert.Equal(t, 2, v1.refCount)
+	assert.Equal(t, int32(2), k1.refCount)
+	assert.Equal(t, int32(2), v1.refCount)
 
 	e = dict.Delete(k1)
 	assert.Nil(t, e)
 	entry = dict.Find(k1)
 	assert.Nil(t, entry)
-	assert.Equal(t, 1, k1.refCount)
-	assert.Equal(t, 1, v1.refCount)
+	assert.Equal(t, int32(1), k1.refCount)
+	assert.Equal(t, int32(1), v1.refCount)
 
 	e = dict.Add(k1, v1)
 	assert.Nil(t, e)
@@ -38,12 +39,12 @@ func TestDict(t *testing.T) {
 	dict.Set(k1, v2)
 	v = dict.Get(k1)
 	assert.Equal(t, v2, v)
-	assert.Equal(t, 2, v2.refCount)
-	assert.Equal(t, 1, v1.refCount)
+	assert.Equal(t, int32(2), v2.refCount)
+	assert.Equal(t, int32(1), v1.refCount)
 }
 
 func TestRehash(t *testing.T) {
-	dict := DictCreate(DictType{HashFunc: GStrHash, EqualFunc: GStrEqual})
+	dict := GobjDictCreate()
 	entry := dict.RandomGet()
 	assert.Nil(t, entry)
 
@@ -82,3 +83,193 @@ func TestRehash(t *testing.T) {
 		assert.Equal(t, fmt.Sprintf("v%v", i), entry.Val.StrVal())
 	}
 }
+
+func TestDictRandom(t *testing.T) {
+	dict := GobjDictCreate()
+	assert.Equal(t, 0, len(dict.RandomDistinct(3)))
+	for i := 0; i < 100; i++ {
+		dict.Add(CreateObject(GSTR, fmt.Sprintf("k%v", i)), CreateObject(GSTR, fmt.Sprintf("v%v", i)))
+	}
+	assert.Equal(t, int64(100), dict.Size())
+	// rehash过程中也要能取到元素
+	for i := 0; i < 200; i++ {
+		assert.NotNil(t, dict.RandomGet())
+	}
+
+	picked := make(map[string]struct{})
+	for _, e := range dict.RandomDistinct(10) {
+		picked[e.Key.StrVal()] = struct{}{}
+	}
+	assert.Equal(t, 10, len(picked))
+	assert.Equal(t, 50, len(dict.RandomDistinct(50)))
+	assert.Equal(t, 100, len(dict.RandomDistinct(200)))
+}
+
+func TestDictScan(t *testing.T) {
+	dict := GobjDictCreate()
+	for i := 0; i < 100; i++ {
+		k := CreateObject(GSTR, strconv.Itoa(i))
+		dict.Add(k, nil)
+		k.DecrRefCount()
+	}
+	seen := make(map[string]int)
+	collect := func(e *GobjEntry) {
+		seen[e.Key.StrVal()]++
+	}
+	var cursor uint64
+	for {
+		cursor = dict.Scan(cursor, collect)
+		if cursor == 0 {
+			break
+		}
+	}
+	assert.Equal(t, 100, len(seen))
+
+	// 遍历过程中扩容并rehash，已有的元素仍然至少返回一次
+	seen = make(map[string]int)
+	cursor = dict.Scan(0, collect)
+	for i := 100; i < 400; i++ {
+		k := CreateObject(GSTR, strconv.Itoa(i))
+		dict.Add(k, nil)
+		k.DecrRefCount()
+	}
+	for cursor != 0 {
+		cursor = dict.Scan(cursor, collect)
+		if dict.isRehashing() {
+			dict.rehashStep()
+		}
+	}
+	for i := 0; i < 100; i++ {
+		assert.True(t, seen[strconv.Itoa(i)] >= 1)
+	}
+	assert.Equal(t, uint64(0), GobjDictCreate().Scan(0, collect))
+}
+
+func TestDictIterator(t *testing.T) {
+	dict := GobjDictCreate()
+	iter := dict.Iterator()
+	assert.Nil(t, iter.Next())
+	iter.Release()
+	for i := 0; i < 100; i++ {
+		k := CreateObject(GSTR, strconv.Itoa(i))
+		dict.Add(k, nil)
+		k.DecrRefCount()
+	}
+	assert.True(t, dict.isRehashing())
+
+	// 安全迭代器暂停rehash，并允许删除元素
+	seen := make(map[string]bool)
+	iter = dict.SafeIterator()
+	rehashidx := dict.rehashidx
+	for e := iter.Next(); e != nil; e = iter.Next() {
+		assert.False(t, seen[e.Key.StrVal()])
+		seen[e.Key.StrVal()] = true
+		dict.Find(e.Key)
+		if n, _ := strconv.Atoi(e.Key.StrVal()); n%2 == 0 {
+			dict.Delete(e.Key)
+		}
+	}
+	assert.Equal(t, rehashidx, dict.rehashidx)
+	iter.Release()
+	assert.Equal(t, 0, dict.iterators)
+	assert.Equal(t, 100, len(seen))
+	assert.Equal(t, int64(50), dict.Size())
+	dict.Find(CreateObject(GSTR, "1"))
+	assert.NotEqual(t, rehashidx, dict.rehashidx)
+
+	// 非安全迭代器只读时正常，修改dict后Release会panic
+	var count int
+	iter = dict.Iterator()
+	for e := iter.Next(); e != nil; e = iter.Next() {
+		count++
+	}
+	assert.NotPanics(t, iter.Release)
+	assert.Equal(t, 50, count)
+	iter = dict.Iterator()
+	iter.Next()
+	dict.Delete(CreateObject(GSTR, "1"))
+	assert.Panics(t, iter.Release)
+}
+
+func TestDictShrink(t *testing.T) {
+	dict := GobjDictCreate()
+	for i := 0; i < 10000; i++ {
+		k := CreateObject(GSTR, strconv.Itoa(i))
+		dict.Add(k, nil)
+		k.DecrRefCount()
+	}
+	for dict.RehashMilliseconds(1) > 0 {
+	}
+	assert.False(t, dict.isRehashing())
+	size := dict.hts[0].size
+	for i := 0; i < 9990; i++ {
+		dict.Delete(CreateObject(GSTR, strconv.Itoa(i)))
+	}
+	assert.Equal(t, int64(10), dict.Size())
+	// 模拟ServerCron，缩容完成后可能还需要再次缩容
+	for i := 0; i < 10; i++ {
+		dict.ShrinkIfNeeded()
+		for dict.RehashMilliseconds(1) > 0 {
+		}
+	}
+	assert.False(t, dict.isRehashing())
+	assert.True(t, dict.hts[0].size < size)
+	assert.True(t, dict.hts[0].used*100/dict.hts[0].size >= MIN_FILL)
+	for i := 9990; i < 10000; i++ {
+		assert.NotNil(t, dict.Find(CreateObject(GSTR, strconv.Itoa(i))))
+	}
+
+	// 安全迭代器存活时不rehash
+	for i := 0; i < 100; i++ {
+		k := CreateObject(GSTR, strconv.Itoa(i))
+		dict.Add(k, nil)
+		k.DecrRefCount()
+	}
+	assert.True(t, dict.isRehashing())
+	iter := dict.SafeIterator()
+	iter.Next()
+	assert.Equal(t, 0, dict.RehashMilliseconds(1))
+	iter.Release()
+	assert.True(t, dict.RehashMilliseconds(1) > 0 || !dict.isRehashing())
+}
+
+func TestDictGeneric(t *testing.T) {
+	var keyDups, keyFrees, valFrees int
+	dict := DictCreate(DictType[string, int]{
+		HashFunc:  StrHash,
+		EqualFunc: StrEqual,
+		KeyDup: func(key string) string {
+			keyDups++
+			return key
+		},
+		KeyDestructor: func(key string) { keyFrees++ },
+		ValDestructor: func(val int) { valFrees++ },
+	})
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, dict.Add(strconv.Itoa(i), i))
+	}
+	assert.Equal(t, EX_ERR, dict.Add("1", 1))
+	assert.Equal(t, 100, keyDups)
+	assert.Equal(t, 42, dict.Get("42"))
+	assert.Equal(t, 0, dict.Get("none"))
+
+	dict.Set("42", 4200)
+	assert.Equal(t, 4200, dict.Get("42"))
+	assert.Equal(t, 1, valFrees)
+	assert.Nil(t, dict.Delete("42"))
+	assert.Equal(t, NK_ERR, dict.Delete("42"))
+	assert.Equal(t, 1, keyFrees)
+	assert.Equal(t, 2, valFrees)
+	assert.Equal(t, int64(99), dict.Size())
+
+	sum := 0
+	dict.forEach(func(e *Entry[string, int]) {
+		sum += e.Val
+	})
+	assert.Equal(t, 99*100/2-42, sum)
+
+	cmds := DictCreate(DictType[string, int]{HashFunc: StrCaseHash, EqualFunc: StrCaseEqual})
+	cmds.Add("get", 1)
+	assert.Equal(t, 1, cmds.Get("GET"))
+	assert.Equal(t, 1, cmds.Get("gEt"))
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 过期时间相关的命令实现，过期时间以毫秒时间戳保存在db.expire中
+
+const (
+	// 每轮抽样的key数量
+	ACTIVE_EXPIRE_CYCLE_KEYS_PER_LOOP = 20
+	// 一轮中过期key的比例不超过该百分比时结束
+	ACTIVE_EXPIRE_CYCLE_ACCEPTABLE_STALE = 10
+	// 每次最多使用ServerCron周期的百分比
+	ACTIVE_EXPIRE_CYCLE_SLOW_TIME_PERC = 25
+)
+
+// 主动过期每次调用的时间预算，测试中可以调小以获得确定的结果
+var activeExpireCycleTimeLimit = SERVER_CRON_PERIOD * ACTIVE_EXPIRE_CYCLE_SLOW_TIME_PERC / 100 * time.Millisecond
+
+const (
+	EXPIRE_NX = 1 << iota
+	EXPIRE_XX
+	EXPIRE_GT
+	EXPIRE_LT
+)
+
+// EXPIRE key seconds [NX | XX | GT | LT]
+func expireCommand(c *GodisClient) {
+	expireGenericCommand(c, GetMsTime(), true)
+}
+
+func pexpireCommand(c *GodisClient) {
+	expireGenericCommand(c, GetMsTime(), false)
+}
+
+func expireatCommand(c *GodisClient) {
+	expireGenericCommand(c, 0, true)
+}
+
+func pexpireatCommand(c *GodisClient) {
+	expireGenericCommand(c, 0, false)
+}
+
+func parseExpireFlags(c *GodisClient) (int, bool) {
+	var flags int
+	for _, arg := range c.args[3:] {
+		switch strings.ToLower(arg.StrVal()) {
+		case "nx":
+			flags |= EXPIRE_NX
+		case "xx":
+			flags |= EXPIRE_XX
+		case "gt":
+			flags |= EXPIRE_GT
+		case "lt":
+			flags |= EXPIRE_LT
+		default:
+			c.AddReplyError(fmt.Sprintf("Unsupported option %v", arg.StrVal()))
+			return 0, false
+		}
+	}
+	if flags&EXPIRE_NX != 0 && flags&(EXPIRE_XX|EXPIRE_GT|EXPIRE_LT) != 0 {
+		c.AddReplyError("NX and XX, GT or LT options at the same time are not compatible")
+		return 0, false
+	}
+	if flags&EXPIRE_GT != 0 && flags&EXPIRE_LT != 0 {
+		c.AddReplyError("GT and LT options at the same time are not compatible")
+		return 0, false
+	}
+	return flags, true
+}
+
+// basetime为0时参数是绝对时间，seconds表示参数单位为秒
+func expireGenericCommand(c *GodisClient, basetime int64, seconds bool) {
+	when, ok := getIntOrReply(c, c.args[2])
+	if !ok {
+		return
+	}
+	flags, ok := parseExpireFlags(c)
+	if !ok {
+		return
+	}
+	invalid := false
+	if seconds {
+		if when > math.MaxInt64/1000 || when < math.MinInt64/1000 {
+			invalid = true
+		}
+		when *= 1000
+	}
+	if when > math.MaxInt64-basetime {
+		invalid = true
+	}
+	if invalid {
+		c.AddReplyError(fmt.Sprintf("invalid expire time in '%v' command", c.args[0].StrVal()))
+		return
+	}
+	when += basetime
+	// 转换为绝对时间写入AOF，NX等条件保持不变
+	if basetime != 0 || seconds {
+		rewriteClientCommandArg(c, 0, "PEXPIREAT")
+		rewriteClientCommandArg(c, 2, strconv.FormatInt(when, 10))
+	}
+	key := c.args[1]
+	if c.db.findKeyRead(key) == nil {
+		c.AddReplyStr(shared.czero)
+		return
+	}
+	// 没有过期时间相当于过期时间无限大
+	cur := c.db.getExpire(key)
+	if (flags&EXPIRE_NX != 0 && cur != -1) ||
+		(flags&EXPIRE_XX != 0 && cur == -1) ||
+		(flags&EXPIRE_GT != 0 && (cur == -1 || when <= cur)) ||
+		(flags&EXPIRE_LT != 0 && cur != -1 && when >= cur) {
+		c.AddReplyStr(shared.czero)
+		return
+	}
+	// 过期时间已经过去，直接删除
+	if when <= GetMsTime() {
+		c.db.deleteKey(key)
+	} else {
+		c.db.setExpire(key, when)
+	}
+	server.dirty++
+	c.AddReplyStr(shared.cone)
+}
+
+func ttlCommand(c *GodisClient) {
+	ttlGenericCommand(c, false, false)
+}
+
+func pttlCommand(c *GodisClient) {
+	ttlGenericCommand(c, true, false)
+}
+
+func expiretimeCommand(c *GodisClient) {
+	ttlGenericCommand(c, false, true)
+}
+
+func pexpiretimeCommand(c *GodisClient) {
+	ttlGenericCommand(c, true, true)
+}
+
+// key不存在返回-2，没有过期时间返回-1
+func ttlGenericCommand(c *GodisClient, ms bool, abs bool) {
+	key := c.args[1]
+	if c.db.findKeyRead(key) == nil {
+		c.AddReplyInt(-2)
+		return
+	}
+	when := c.db.getExpire(key)
+	if when == -1 {
+		c.AddReplyStr(shared.cnegone)
+		return
+	}
+	if !abs {
+		when -= GetMsTime()
+		if when < 0 {
+			when = 0
+		}
+	}
+	// 与redis一致，TTL和EXPIRETIME都四舍五入到秒
+	if !ms {
+		when = (when + 500) / 1000
+	}
+	c.AddReplyInt(when)
+}
+
+func persistCommand(c *GodisClient) {
+	key := c.args[1]
+	if c.db.findKeyRead(key) != nil && c.db.expire.Delete(key) == nil {
+		server.dirty++
+		c.AddReplyStr(shared.cone)
+	} else {
+		c.AddReplyStr(shared.czero)
+	}
+}
+
+// 主动过期，依次处理每个db，随机抽样带过期时间的key并删除已过期的，
+// 过期比例较高时继续下一轮，直到比例降低或用完时间预算。
+// 每次从上次停下的db的下一个开始，避免一个db用完时间后其他db得不到处理
+func activeExpireCycle() {
+	start := time.Now()
+	timelimit := activeExpireCycleTimeLimit
+	var sampled, expired int64
+	for j := 0; j < len(server.dbs); j++ {
+		// 至少处理一个db，保证每次调用都有进展
+		if j > 0 && time.Since(start) > timelimit {
+			break
+		}
+		db := server.dbs[server.expireCycleDb%len(server.dbs)]
+		server.expireCycleDb++
+		for {
+			num := db.expire.Size()
+			if num == 0 {
+				break
+			}
+			if num > ACTIVE_EXPIRE_CYCLE_KEYS_PER_LOOP {
+				num = ACTIVE_EXPIRE_CYCLE_KEYS_PER_LOOP
+			}
+			now := GetMsTime()
+			var roundExpired int64
+			for i := int64(0); i < num; i++ {
+				entry := db.expire.RandomGet()
+				if entry.Val.IntVal() > now {
+					continue
+				}
+				// entry.Key可能只被expire持有，删除期间需要保持引用
+				key := entry.Key
+				key.IncrRefCount()
+				propagateExpire(db, key)
+				db.deleteKey(key)
+				key.DecrRefCount()
+				roundExpired++
+			}
+			sampled += num
+			expired += roundExpired
+			if roundExpired*100/num <= ACTIVE_EXPIRE_CYCLE_ACCEPTABLE_STALE || time.Since(start) > timelimit {
+				break
+			}
+		}
+	}
+	server.statExpiredKeys += expired
+	server.statExpireCycleTime += time.Since(start)
+	var perc float64
+	if sampled > 0 {
+		perc = float64(expired) / float64(sampled)
+	}
+	// 平滑处理，避免单次抽样的波动
+	server.statExpiredStalePerc = perc*0.05 + server.statExpiredStalePerc*0.95
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTtl(t *testing.T) {
+	client := newTestClient()
+	assert.Equal(t, ":-2\r\n", execCommand(client, "ttl k"))
+	execCommand(client, "set k v")
+	assert.Equal(t, ":-1\r\n", execCommand(client, "ttl k"))
+	assert.Equal(t, ":-1\r\n", execCommand(client, "pexpiretime k"))
+	assert.Equal(t, shared.cone, execCommand(client, "expire k 100"))
+	assert.Equal(t, ":100\r\n", execCommand(client, "ttl k"))
+	pttl, _ := strconv.Atoi(strings.TrimSpace(execCommand(client, "pttl k")[1:]))
+	assert.True(t, pttl > 99000 && pttl <= 100000)
+
+	assert.Equal(t, shared.cone, execCommand(client, "pexpireat k 4102444800000"))
+	assert.Equal(t, ":4102444800\r\n", execCommand(client, "expiretime k"))
+	assert.Equal(t, ":4102444800000\r\n", execCommand(client, "pexpiretime k"))
+	assert.Equal(t, shared.cone, execCommand(client, "expireat k 4102444801"))
+	assert.Equal(t, ":4102444801000\r\n", execCommand(client, "pexpiretime k"))
+	execCommand(client, "pexpireat k 4102444800500")
+	assert.Equal(t, ":4102444801\r\n", execCommand(client, "expiretime k"))
+	execCommand(client, "pexpireat k 4102444800499")
+	assert.Equal(t, ":4102444800\r\n", execCommand(client, "expiretime k"))
+
+	assert.Equal(t, shared.cone, execCommand(client, "persist k"))
+	assert.Equal(t, shared.czero, execCommand(client, "persist k"))
+	assert.Equal(t, ":-1\r\n", execCommand(client, "ttl k"))
+	assert.Equal(t, shared.czero, execCommand(client, "persist none"))
+	assert.Equal(t, shared.czero, execCommand(client, "expire none 10"))
+
+	// 负数或已经过去的时间直接删除key
+	assert.Equal(t, shared.cone, execCommand(client, "pexpire k -1"))
+	assert.Equal(t, ":0\r\n", execCommand(client, "exists k"))
+	execCommand(client, "set k v")
+	assert.Equal(t, shared.cone, execCommand(client, "expireat k 1"))
+	assert.Equal(t, ":0\r\n", execCommand(client, "exists k"))
+}
+
+func TestExpireFlags(t *testing.T) {
+	client := newTestClient()
+	execCommand(client, "set k v")
+	assert.Equal(t, shared.czero, execCommand(client, "expire k 100 xx"))
+	assert.Equal(t, shared.czero, execCommand(client, "expire k 100 gt"))
+	assert.Equal(t, shared.cone, execCommand(client, "expire k 100 lt"))
+	assert.Equal(t, shared.czero, execCommand(client, "expire k 200 nx"))
+	assert.Equal(t, shared.cone, execCommand(client, "expire k 200 gt"))
+	assert.Equal(t, shared.czero, execCommand(client, "expire k 100 gt"))
+	assert.Equal(t, shared.czero, execCommand(client, "expire k 300 lt"))
+	assert.Equal(t, shared.cone, execCommand(client, "expire k 50 xx lt"))
+	assert.Equal(t, ":50\r\n", execCommand(client, "ttl k"))
+
+	assert.Equal(t, "-ERR NX and XX, GT or LT options at the same time are not compatible\r\n", execCommand(client, "expire k 10 nx xx"))
+	assert.Equal(t, "-ERR GT and LT options at the same time are not compatible\r\n", execCommand(client, "expire k 10 gt lt"))
+	assert.Equal(t, "-ERR Unsupported option foo\r\n", execCommand(client, "expire k 10 foo"))
+	assert.Equal(t, "-ERR invalid expire time in 'expire' command\r\n", execCommand(client, "expire k 9223372036854775807"))
+	assert.Equal(t, shared.notInteger, execCommand(client, "expire k x"))
+}
+
+func TestActiveExpireCycle(t *testing.T) {
+	newTestClient()
+	for i := 0; i < 1000; i++ {
+		key := CreateObject(GSTR, "k"+strconv.Itoa(i))
+		val := CreateFromInt(int64(i))
+		server.dbs[0].data.Set(key, val)
+		if i < 900 {
+			server.dbs[0].setExpire(key, 1)
+		} else {
+			server.dbs[0].setExpire(key, GetMsTime()+100000)
+		}
+		key.DecrRefCount()
+		val.DecrRefCount()
+	}
+	activeExpireCycle()
+	// 过期比例低于阈值后才会停止
+	assert.True(t, server.dbs[0].expire.Size() < 200)
+	assert.True(t, server.statExpiredKeys > 800)
+	assert.Equal(t, server.dbs[0].data.Size(), server.dbs[0].expire.Size())
+	assert.True(t, server.statExpiredStalePerc > 0)
+	assert.True(t, server.statExpireCycleTime > 0)
+	for i := 900; i < 1000; i++ {
+		assert.NotNil(t, server.dbs[0].data.Get(CreateObject(GSTR, "k"+strconv.Itoa(i))))
+	}
+}
+
+// db0中过期的key太多，一次处理不完时，下一次从db1开始
+func TestActiveExpireCycleResume(t *testing.T) {
+	newTestClient()
+	fill := func(db *GodisDB, n int) {
+		for i := 0; i < n; i++ {
+			key := CreateObject(GSTR, "k"+strconv.Itoa(i))
+			val := CreateFromInt(int64(i))
+			db.data.Set(key, val)
+			db.setExpire(key, 1)
+			key.DecrRefCount()
+			val.DecrRefCount()
+		}
+	}
+	fill(server.dbs[0], 1000)
+	fill(server.dbs[1], 1000)
+	// 时间预算为0时每次只处理一个db的一轮抽样
+	defer func(limit time.Duration) { activeExpireCycleTimeLimit = limit }(activeExpireCycleTimeLimit)
+	activeExpireCycleTimeLimit = 0
+
+	activeExpireCycle()
+	left := server.dbs[0].expire.Size()
+	assert.True(t, left < 1000)
+	assert.Equal(t, int64(1000), server.dbs[1].expire.Size())
+	assert.Equal(t, 1, server.expireCycleDb)
+
+	activeExpireCycle()
+	assert.True(t, server.dbs[1].expire.Size() < 1000)
+	assert.Equal(t, left, server.dbs[0].expire.Size())
+	assert.Equal(t, 2, server.expireCycleDb)
+}
+
+func TestLazyExpireStat(t *testing.T) {
+	client := newTestClient()
+	execCommand(client, "set k2 v px 1")
+	expired := server.statExpiredKeys
+	time.Sleep(2 * time.Millisecond)
+	assert.Equal(t, "$-1\r\n", execCommand(client, "get k2"))
+	assert.Equal(t, "$-1\r\n", execCommand(client, "get k2"))
+	assert.Equal(t, expired+1, server.statExpiredKeys)
+	assert.Contains(t, execCommand(client, "info stats"), "expired_keys:"+strconv.FormatInt(expired+1, 10))
+}
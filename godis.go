@@ -1,27 +1,188 @@
 package main
 
 import (
+	"encoding/binary"
 	"fmt"
-	"hash/fnv"
 	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 )
 
 type GodisCommand struct {
 	name  string
 	proc  CommandProc
-	arity int
+	arity int // 正数表示参数个数必须相等，负数表示参数个数至少为-arity
+	flags int
 }
 
+const (
+	CMD_WRITE    = 1 << iota // 可能修改数据
+	CMD_READONLY             // 只读取数据
+)
+
 type CommandProc func(c *GodisClient)
 
 var cmdTable []GodisCommand = []GodisCommand{
-	{"get", getCommand, 2},
-	{"set", setCommand, 3},
-	{"expire", expireCommand, 3},
+	{"get", getCommand, 2, CMD_READONLY},
+	{"set", setCommand, -3, CMD_WRITE},
+	{"expire", expireCommand, -3, CMD_WRITE},
+	{"pexpire", pexpireCommand, -3, CMD_WRITE},
+	{"expireat", expireatCommand, -3, CMD_WRITE},
+	{"pexpireat", pexpireatCommand, -3, CMD_WRITE},
+	{"ttl", ttlCommand, 2, CMD_READONLY},
+	{"pttl", pttlCommand, 2, CMD_READONLY},
+	{"expiretime", expiretimeCommand, 2, CMD_READONLY},
+	{"pexpiretime", pexpiretimeCommand, 2, CMD_READONLY},
+	{"persist", persistCommand, 2, CMD_WRITE},
+	{"incr", incrCommand, 2, CMD_WRITE},
+	{"decr", decrCommand, 2, CMD_WRITE},
+	{"incrby", incrbyCommand, 3, CMD_WRITE},
+	{"decrby", decrbyCommand, 3, CMD_WRITE},
+	{"incrbyfloat", incrbyfloatCommand, 3, CMD_WRITE},
+	{"append", appendCommand, 3, CMD_WRITE},
+	{"strlen", strlenCommand, 2, CMD_READONLY},
+	{"getrange", getrangeCommand, 4, CMD_READONLY},
+	{"setrange", setrangeCommand, 4, CMD_WRITE},
+	{"getdel", getdelCommand, 2, CMD_WRITE},
+	{"getex", getexCommand, -2, CMD_WRITE},
+	{"getset", getsetCommand, 3, CMD_WRITE},
+	{"mget", mgetCommand, -2, CMD_READONLY},
+	{"mset", msetCommand, -3, CMD_WRITE},
+	{"msetnx", msetnxCommand, -3, CMD_WRITE},
+	{"lcs", lcsCommand, -3, CMD_READONLY},
+	{"del", delCommand, -2, CMD_WRITE},
+	{"unlink", unlinkCommand, -2, CMD_WRITE},
+	{"exists", existsCommand, -2, CMD_READONLY},
+	{"type", typeCommand, 2, CMD_READONLY},
+	{"rename", renameCommand, 3, CMD_WRITE},
+	{"renamenx", renamenxCommand, 3, CMD_WRITE},
+	{"copy", copyCommand, -3, CMD_WRITE},
+	{"touch", touchCommand, -2, CMD_READONLY},
+	{"scan", scanCommand, -2, CMD_READONLY},
+	{"keys", keysCommand, 2, CMD_READONLY},
+	{"randomkey", randomkeyCommand, 1, CMD_READONLY},
+	{"dbsize", dbsizeCommand, 1, CMD_READONLY},
+	{"select", selectCommand, 2, 0},
+	{"move", moveCommand, 3, CMD_WRITE},
+	{"swapdb", swapdbCommand, 3, CMD_WRITE},
+	{"flushdb", flushdbCommand, -1, CMD_WRITE},
+	{"flushall", flushallCommand, -1, CMD_WRITE},
+	{"info", infoCommand, -1, 0},
+	{"save", saveCommand, 1, 0},
+	{"bgsave", bgsaveCommand, 1, 0},
+	{"lastsave", lastsaveCommand, 1, 0},
+	{"bgrewriteaof", bgrewriteaofCommand, 1, 0},
+	{"lpush", lpushCommand, -3, CMD_WRITE},
+	{"rpush", rpushCommand, -3, CMD_WRITE},
+	{"lpushx", lpushxCommand, -3, CMD_WRITE},
+	{"rpushx", rpushxCommand, -3, CMD_WRITE},
+	{"lpop", lpopCommand, -2, CMD_WRITE},
+	{"rpop", rpopCommand, -2, CMD_WRITE},
+	{"llen", llenCommand, 2, CMD_READONLY},
+	{"lrange", lrangeCommand, 4, CMD_READONLY},
+	{"lindex", lindexCommand, 3, CMD_READONLY},
+	{"lset", lsetCommand, 4, CMD_WRITE},
+	{"linsert", linsertCommand, 5, CMD_WRITE},
+	{"lrem", lremCommand, 4, CMD_WRITE},
+	{"ltrim", ltrimCommand, 4, CMD_WRITE},
+	{"hset", hsetCommand, -4, CMD_WRITE},
+	{"hsetnx", hsetnxCommand, 4, CMD_WRITE},
+	{"hget", hgetCommand, 3, CMD_READONLY},
+	{"hmget", hmgetCommand, -3, CMD_READONLY},
+	{"hdel", hdelCommand, -3, CMD_WRITE},
+	{"hexists", hexistsCommand, 3, CMD_READONLY},
+	{"hlen", hlenCommand, 2, CMD_READONLY},
+	{"hkeys", hkeysCommand, 2, CMD_READONLY},
+	{"hvals", hvalsCommand, 2, CMD_READONLY},
+	{"hgetall", hgetallCommand, 2, CMD_READONLY},
+	{"hincrby", hincrbyCommand, 4, CMD_WRITE},
+	{"hincrbyfloat", hincrbyfloatCommand, 4, CMD_WRITE},
+	{"hstrlen", hstrlenCommand, 3, CMD_READONLY},
+	{"hrandfield", hrandfieldCommand, -2, CMD_READONLY},
+	{"hscan", hscanCommand, -3, CMD_READONLY},
+	{"sadd", saddCommand, -3, CMD_WRITE},
+	{"srem", sremCommand, -3, CMD_WRITE},
+	{"sismember", sismemberCommand, 3, CMD_READONLY},
+	{"smismember", smismemberCommand, -3, CMD_READONLY},
+	{"scard", scardCommand, 2, CMD_READONLY},
+	{"smembers", smembersCommand, 2, CMD_READONLY},
+	{"spop", spopCommand, -2, CMD_WRITE},
+	{"srandmember", srandmemberCommand, -2, CMD_READONLY},
+	{"smove", smoveCommand, 4, CMD_WRITE},
+	{"sinter", sinterCommand, -2, CMD_READONLY},
+	{"sinterstore", sinterstoreCommand, -3, CMD_WRITE},
+	{"sintercard", sintercardCommand, -3, CMD_READONLY},
+	{"sscan", sscanCommand, -3, CMD_READONLY},
+	{"sunion", sunionCommand, -2, CMD_READONLY},
+	{"sunionstore", sunionstoreCommand, -3, CMD_WRITE},
+	{"sdiff", sdiffCommand, -2, CMD_READONLY},
+	{"sdiffstore", sdiffstoreCommand, -3, CMD_WRITE},
+	{"zadd", zaddCommand, -4, CMD_WRITE},
+	{"zincrby", zincrbyCommand, 4, CMD_WRITE},
+	{"zrem", zremCommand, -3, CMD_WRITE},
+	{"zscore", zscoreCommand, 3, CMD_READONLY},
+	{"zmscore", zmscoreCommand, -3, CMD_READONLY},
+	{"zcard", zcardCommand, 2, CMD_READONLY},
+	{"zcount", zcountCommand, 4, CMD_READONLY},
+	{"zrank", zrankCommand, -3, CMD_READONLY},
+	{"zrevrank", zrevrankCommand, -3, CMD_READONLY},
+	{"zrange", zrangeCommand, -4, CMD_READONLY},
+	{"zrangebyscore", zrangebyscoreCommand, -4, CMD_READONLY},
+	{"zremrangebyrank", zremrangebyrankCommand, 4, CMD_WRITE},
+	{"zremrangebyscore", zremrangebyscoreCommand, 4, CMD_WRITE},
+	{"zremrangebylex", zremrangebylexCommand, 4, CMD_WRITE},
+	{"zpopmin", zpopminCommand, -2, CMD_WRITE},
+	{"zpopmax", zpopmaxCommand, -2, CMD_WRITE},
+	{"zrandmember", zrandmemberCommand, -2, CMD_READONLY},
+	{"zscan", zscanCommand, -3, CMD_READONLY},
+	{"zunion", zunionCommand, -3, CMD_READONLY},
+	{"zinter", zinterCommand, -3, CMD_READONLY},
+	{"zdiff", zdiffCommand, -3, CMD_READONLY},
+	{"zunionstore", zunionstoreCommand, -4, CMD_WRITE},
+	{"zinterstore", zinterstoreCommand, -4, CMD_WRITE},
+	{"zdiffstore", zdiffstoreCommand, -4, CMD_WRITE},
+	{"zrangestore", zrangestoreCommand, -5, CMD_WRITE},
 	//todo
 }
 
+// 常用的回复，避免每次重新拼接
+var shared = struct {
+	ok         string
+	czero      string
+	cone       string
+	cnegone    string
+	nullBulk   string
+	nullArray  string
+	emptyBulk  string
+	emptyArray string
+	wrongType  string
+	syntaxErr  string
+	notInteger string
+	notFloat   string
+	noSuchKey  string
+	outOfRange string
+}{
+	ok:         "+OK\r\n",
+	czero:      ":0\r\n",
+	cone:       ":1\r\n",
+	cnegone:    ":-1\r\n",
+	nullBulk:   "$-1\r\n",
+	nullArray:  "*-1\r\n",
+	emptyBulk:  "$0\r\n\r\n",
+	emptyArray: "*0\r\n",
+	wrongType:  "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n",
+	syntaxErr:  "-ERR syntax error\r\n",
+	notInteger: "-ERR value is not an integer or out of range\r\n",
+	notFloat:   "-ERR value is not a valid float\r\n",
+	noSuchKey:  "-ERR no such key\r\n",
+	outOfRange: "-ERR index out of range\r\n",
+}
+
 func main() {
 	path := "config.json"
 	config, err := LoadConfig(path)
@@ -32,20 +193,79 @@ func main() {
 	if err != nil {
 		log.Printf("init server error: %v\n", err)
 	}
+	// 先加载数据，再开始接受连接。开启AOF时只从AOF加载，
+	// 还没有AOF文件时从RDB加载，之后由openAppendOnlyFile创建base文件
+	if server.aofEnabled {
+		err = loadAppendOnlyFiles()
+		if os.IsNotExist(err) {
+			err = rdbLoad(server.rdbFilename)
+			if os.IsNotExist(err) {
+				err = nil
+			}
+		}
+		if err != nil {
+			log.Fatalf("load append only file error: %v\n", err)
+		}
+		if err = openAppendOnlyFile(); err != nil {
+			log.Fatalf("open append only file error: %v\n", err)
+		}
+	} else if err = rdbLoad(server.rdbFilename); err != nil && !os.IsNotExist(err) {
+		log.Fatalf("load rdb error: %v\n", err)
+	}
+	server.aeLoop.BeforeSleep = beforeSleep
 	server.aeLoop.AddFileEvent(server.fd, AE_READABLE, AcceptHandler, nil)
-	server.aeLoop.AddTimeEvent(AE_NORMAL, 100, ServerCron, nil)
+	server.aeLoop.AddTimeEvent(AE_NORMAL, SERVER_CRON_PERIOD, ServerCron, nil)
 	log.Println("godis server is up.")
 	server.aeLoop.AeMain()
 }
 
 func initServer(config *Config) error {
 	server.port = config.Port
-	server.clients = make(map[int]*GodisClient)
-	server.db = &GodisDB{
-		data:   DictCreate(DictType{HashFunc: GStrHash, EqualFunc: GStrEqual}),
-		expire: DictCreate(DictType{HashFunc: GStrHash, EqualFunc: GStrEqual}),
+	server.startTime = time.Now()
+	if config.DbFilename == "" {
+		config.DbFilename = DEFAULT_DBFILENAME
+	}
+	server.rdbFilename = filepath.Join(config.Dir, config.DbFilename)
+	server.lastSave = server.startTime.Unix()
+	server.lastBgsaveOK = true
+	if config.AppendFilename == "" {
+		config.AppendFilename = DEFAULT_APPENDFILENAME
+	}
+	if config.AppendDirname == "" {
+		config.AppendDirname = DEFAULT_APPENDDIRNAME
+	}
+	if config.AppendFsync == "" {
+		config.AppendFsync = DEFAULT_APPENDFSYNC
+	}
+	server.aofEnabled = config.AppendOnly
+	server.aofFilename = config.AppendFilename
+	server.aofDirname = filepath.Join(config.Dir, config.AppendDirname)
+	server.aofManifest = nil
+	server.aofUseRdbPreamble = config.AofUseRdbPreamble
+	server.aofLoadTruncated = config.AofLoadTruncated
+	server.aofLastWriteOK = true
+	server.aofFile = nil
+	server.aofBuf = nil
+	server.aofRewritePerc = config.AutoAofRewritePercentage
+	server.aofRewriteMinSize = config.AutoAofRewriteMinSize
+	server.aofLastBgrewriteOK = true
+	server.clients = DictCreate(DictType[int, *GodisClient]{HashFunc: IntHash, EqualFunc: IntEqual})
+	populateCommandTable()
+	if config.Databases <= 0 {
+		config.Databases = DEFAULT_DBNUM
+	}
+	server.dbs = make([]*GodisDB, config.Databases)
+	for i := range server.dbs {
+		server.dbs[i] = createDB(i)
 	}
+	server.expireCycleDb = 0
 	var err error
+	if server.saveParams, err = parseSaveParams(config.Save); err != nil {
+		return err
+	}
+	if server.aofFsync, err = parseAppendFsync(config.AppendFsync); err != nil {
+		return err
+	}
 	if server.aeLoop, err = AeLoopCreate(); err != nil {
 		return err
 	}
@@ -61,113 +281,351 @@ func AcceptHandler(loop *AeLoop, fd int, extra interface{}) {
 	}
 	client := CreateClient(cfd)
 	//TODO: check max clients limit
-	server.clients[cfd] = client
+	server.clients.Set(cfd, client)
 	server.aeLoop.AddFileEvent(cfd, AE_READABLE, ReadQueryFromClient, client)
 	log.Printf("accept client, fd: %v\n", cfd)
 }
 
-const EXPIRE_CHECK_COUNT int = 100
+const (
+	SERVER_CRON_PERIOD = 100
+	DEFAULT_DBNUM      = 16
+)
+
+// 进入事件循环等待之前，把这一轮执行的写命令写入AOF
+func beforeSleep(loop *AeLoop) {
+	flushAppendOnlyFile()
+}
 
 func ServerCron(loop *AeLoop, id int, extra interface{}) {
-	for i := 0; i < EXPIRE_CHECK_COUNT; i++ {
-		entry := server.db.expire.RandomGet()
-		if entry == nil {
-			break
+	activeExpireCycle()
+	databasesCron()
+	rdbCron()
+	aofCron()
+}
+
+// 空闲时也能完成缩容和rehash，不依赖于请求触发的单步rehash
+func databasesCron() {
+	for _, db := range server.dbs {
+		db.data.ShrinkIfNeeded()
+		db.expire.ShrinkIfNeeded()
+	}
+	// 每次只处理一个dict，最多使用1ms
+	for _, db := range server.dbs {
+		if db.data.isRehashing() {
+			db.data.RehashMilliseconds(1)
+			return
 		}
-		if entry.Val.IntVal() < time.Now().Unix() {
-			server.db.data.Delete(entry.Key)
-			server.db.expire.Delete(entry.Key)
+		if db.expire.isRehashing() {
+			db.expire.RehashMilliseconds(1)
+			return
 		}
 	}
 }
 
+// INFO [section ...]，不指定section时返回所有信息
+func infoCommand(c *GodisClient) {
+	sections := make(map[string]bool)
+	for _, arg := range c.args[1:] {
+		sections[strings.ToLower(arg.StrVal())] = true
+	}
+	all := len(sections) == 0 || sections["all"] || sections["default"] || sections["everything"]
+	var sb strings.Builder
+	addSection := func(name string, gen func(sb *strings.Builder)) {
+		if !all && !sections[strings.ToLower(name)] {
+			return
+		}
+		if sb.Len() > 0 {
+			sb.WriteString("\r\n")
+		}
+		fmt.Fprintf(&sb, "# %v\r\n", name)
+		gen(&sb)
+	}
+	addSection("Server", func(sb *strings.Builder) {
+		fmt.Fprintf(sb, "tcp_port:%d\r\n", server.port)
+		fmt.Fprintf(sb, "uptime_in_seconds:%d\r\n", int64(time.Since(server.startTime).Seconds()))
+		fmt.Fprintf(sb, "hz:%d\r\n", 1000/SERVER_CRON_PERIOD)
+	})
+	addSection("Clients", func(sb *strings.Builder) {
+		fmt.Fprintf(sb, "connected_clients:%d\r\n", server.clients.Size())
+	})
+	addSection("Memory", func(sb *strings.Builder) {
+		fmt.Fprintf(sb, "lazyfree_pending_objects:%d\r\n", atomic.LoadInt64(&lazyfreePendingObjects))
+		fmt.Fprintf(sb, "lazyfreed_objects:%d\r\n", atomic.LoadInt64(&lazyfreedObjects))
+	})
+	addSection("Persistence", func(sb *strings.Builder) {
+		var inProgress int
+		if server.rdbBgsaveDone != nil {
+			inProgress = 1
+		}
+		status := "ok"
+		if !server.lastBgsaveOK {
+			status = "err"
+		}
+		fmt.Fprintf(sb, "rdb_changes_since_last_save:%d\r\n", server.dirty)
+		fmt.Fprintf(sb, "rdb_bgsave_in_progress:%d\r\n", inProgress)
+		fmt.Fprintf(sb, "rdb_last_save_time:%d\r\n", server.lastSave)
+		fmt.Fprintf(sb, "rdb_last_bgsave_status:%v\r\n", status)
+		aofStatus := "ok"
+		if !server.aofLastWriteOK {
+			aofStatus = "err"
+		}
+		rewriteStatus := "ok"
+		if !server.aofLastBgrewriteOK {
+			rewriteStatus = "err"
+		}
+		fmt.Fprintf(sb, "aof_enabled:%d\r\n", b2i(server.aofFile != nil))
+		fmt.Fprintf(sb, "aof_rewrite_in_progress:%d\r\n", b2i(server.aofRewriteDone != nil))
+		fmt.Fprintf(sb, "aof_last_bgrewrite_status:%v\r\n", rewriteStatus)
+		fmt.Fprintf(sb, "aof_last_write_status:%v\r\n", aofStatus)
+		if server.aofFile != nil {
+			fmt.Fprintf(sb, "aof_current_size:%d\r\n", server.aofCurrentSize)
+			fmt.Fprintf(sb, "aof_base_size:%d\r\n", server.aofRewriteBaseSize)
+		}
+	})
+	addSection("Stats", func(sb *strings.Builder) {
+		fmt.Fprintf(sb, "expired_keys:%d\r\n", server.statExpiredKeys)
+		fmt.Fprintf(sb, "expired_stale_perc:%.2f\r\n", server.statExpiredStalePerc*100)
+		fmt.Fprintf(sb, "expire_cycle_cpu_milliseconds:%d\r\n", server.statExpireCycleTime.Milliseconds())
+	})
+	addSection("Keyspace", func(sb *strings.Builder) {
+		for _, db := range server.dbs {
+			if keys := db.data.Size(); keys > 0 {
+				fmt.Fprintf(sb, "db%d:keys=%d,expires=%d\r\n", db.id, keys, db.expire.Size())
+			}
+		}
+	})
+	c.AddReplyBulkStr(sb.String())
+}
+
 func ProcessCommand(c *GodisClient) {
-	cmdStr := c.args[0].StrVal()
+	cmdStr := strings.ToLower(c.args[0].StrVal())
 	log.Printf("process command: %v\n", cmdStr)
 	if cmdStr == "quit" {
 		freeClient(c)
 		return
 	}
-	cmd := lookupCommand(cmdStr)
+	cmd := lookupCommand(c.args[0].StrVal())
 	if cmd == nil {
-		c.AddReplyStr("-ERR: unknow command")
+		c.AddReplyError(fmt.Sprintf("unknown command '%v'", cmdStr))
 		resetClient(c)
 		return
-	} else if cmd.arity != len(c.args) {
-		c.AddReplyStr("-ERR: wrong number of args")
+	} else if (cmd.arity > 0 && cmd.arity != len(c.args)) || len(c.args) < -cmd.arity {
+		c.AddReplyError(fmt.Sprintf("wrong number of arguments for '%v' command", cmdStr))
 		resetClient(c)
 		return
 	}
-	cmd.proc(c)
+	call(c, cmd)
 	resetClient(c)
 }
 
+// 执行命令，命令修改数据时自己增加server.dirty，只有dirty增加了才写入AOF。
+// SAVE等命令会清零dirty，不能只判断是否变化
+func call(c *GodisClient, cmd *GodisCommand) {
+	dirty := server.dirty
+	cmd.proc(c)
+	if server.dirty > dirty {
+		feedAppendOnlyFile(c.db.id, c.args)
+	}
+}
+
 func getCommand(c *GodisClient) {
 	key := c.args[1]
-	val := findKeyRead(key)
+	val := c.db.findKeyRead(key)
 	if val == nil {
-		//TODO: extract shared.strings
-		c.AddReplyStr("$-1\r\n")
-	} else if val.Type_ != GSTR {
-		//TODO: extract shared.strings
-		c.AddReplyStr("$-ERR: wrong type\r\n")
-	} else {
-		str := val.StrVal()
-		c.AddReplyStr(fmt.Sprintf("$%d%v\r\n", len(str), str))
+		c.AddReplyStr(shared.nullBulk)
+	} else if checkType(c, val, GSTR) {
+		c.AddReplyBulk(val)
 	}
 }
 
+// SET key value [NX | XX] [GET] [EX seconds | PX milliseconds | EXAT timestamp | PXAT ms-timestamp | KEEPTTL]
 func setCommand(c *GodisClient) {
+	var nx, xx, get, keepttl bool
+	var unit string
+	var when int64
+	var unitIdx int
+	for i := 3; i < len(c.args); i++ {
+		arg := strings.ToLower(c.args[i].StrVal())
+		switch {
+		case arg == "nx" && !xx:
+			nx = true
+		case arg == "xx" && !nx:
+			xx = true
+		case arg == "get":
+			get = true
+		case arg == "keepttl" && unit == "":
+			keepttl = true
+		case (arg == "ex" || arg == "px" || arg == "exat" || arg == "pxat") &&
+			unit == "" && !keepttl && i+1 < len(c.args):
+			unit = arg
+			unitIdx = i
+			i++
+			var ok bool
+			if when, ok = getExpireTimeOrReply(c, c.args[i], unit); !ok {
+				return
+			}
+		default:
+			c.AddReplyStr(shared.syntaxErr)
+			return
+		}
+	}
+	// 相对时间转换为PXAT写入AOF
+	if unit != "" && unit != "pxat" {
+		rewriteClientCommandArg(c, unitIdx, "PXAT")
+		rewriteClientCommandArg(c, unitIdx+1, strconv.FormatInt(when, 10))
+	}
 	key := c.args[1]
 	val := c.args[2]
-	if val.Type_ != GSTR {
-		//TODO: extract shared.strings
-		c.AddReplyStr("-ERR: wrong type\r\n")
+	old := c.db.findKeyRead(key)
+	if get {
+		if old != nil && !checkType(c, old, GSTR) {
+			return
+		}
+		// 在覆盖之前回复旧值
+		if old == nil {
+			c.AddReplyStr(shared.nullBulk)
+		} else {
+			c.AddReplyBulk(old)
+		}
+	}
+	if (nx && old != nil) || (xx && old == nil) {
+		if !get {
+			c.AddReplyStr(shared.nullBulk)
+		}
+		return
+	}
+	if keepttl {
+		c.db.data.Set(key, val)
+	} else {
+		c.db.setKey(key, val)
+	}
+	if unit != "" {
+		// 过期时间已经过去，直接删除
+		if when <= GetMsTime() {
+			c.db.deleteKey(key)
+		} else {
+			c.db.setExpire(key, when)
+		}
+	}
+	server.dirty++
+	if !get {
+		c.AddReplyStr(shared.ok)
 	}
-	server.db.data.Set(key, val)
-	server.db.expire.Delete(key)
-	c.AddReplyStr("+OK\r\n")
 }
 
-func expireCommand(c *GodisClient) {
-	key := c.args[1]
-	val := c.args[2]
-	if val.Type_ != GSTR {
-		//TODO: extract shared.strings
-		c.AddReplyStr("-ERR: wrong type\r\n")
+// 命令名不区分大小写
+func lookupCommand(name string) *GodisCommand {
+	return server.commands.Get(name)
+}
+
+func populateCommandTable() {
+	server.commands = DictCreate(DictType[string, *GodisCommand]{HashFunc: StrCaseHash, EqualFunc: StrCaseEqual})
+	for i := range cmdTable {
+		server.commands.Add(cmdTable[i].name, &cmdTable[i])
 	}
-	expire := GetMsTime() + (val.IntVal() * 1000)
-	expObj := CreateFromInt(expire)
-	server.db.expire.Set(key, expObj)
-	expObj.DecrRefCount()
-	c.AddReplyStr("+OK\r\n")
 }
 
-func lookupCommand(cmdStr string) *GodisCommand {
-	for _, c := range cmdTable {
-		if c.name == cmdStr {
-			return &c
-		}
+// 类型不匹配时回复WRONGTYPE
+func checkType(c *GodisClient, o *Gobj, typ Gtype) bool {
+	if o.Type_ != typ {
+		c.AddReplyStr(shared.wrongType)
+		return false
 	}
-	return nil
+	return true
 }
 
-func findKeyRead(key *Gobj) *Gobj {
-	expireIfNeeded(key)
-	return server.db.data.Get(key)
+func getIntOrReply(c *GodisClient, o *Gobj) (int64, bool) {
+	val, err := strconv.ParseInt(o.StrVal(), 10, 64)
+	if err != nil {
+		c.AddReplyStr(shared.notInteger)
+		return 0, false
+	}
+	return val, true
 }
 
-func expireIfNeeded(key *Gobj) {
-	entry := server.db.expire.Find(key)
-	if entry == nil {
-		return
+// SRANDMEMBER等命令的count为负数时返回-count个可能重复的元素，
+// 回复在发送前全部保存在内存中，需要限制个数
+const RAND_COUNT_MAX = 1 << 20
+
+// 超出[min, max]时回复与redis相同的错误
+func getRangeIntOrReply(c *GodisClient, o *Gobj, min, max int64) (int64, bool) {
+	val, ok := getIntOrReply(c, o)
+	if !ok {
+		return 0, false
 	}
-	when := entry.Val.IntVal()
-	if when > GetMsTime() {
-		return
+	if val < min || val > max {
+		c.AddReplyError(fmt.Sprintf("value is out of range, value must between %d and %d", min, max))
+		return 0, false
 	}
-	server.db.expire.Delete(key)
-	server.db.data.Delete(key)
+	return val, true
+}
+
+// 判断val + incr是否溢出
+func incrOverflow(val, incr int64) bool {
+	return (incr < 0 && val < 0 && incr < math.MinInt64-val) ||
+		(incr > 0 && val > 0 && incr > math.MaxInt64-val)
+}
+
+func getFloatOrReply(c *GodisClient, o *Gobj) (float64, bool) {
+	val, err := strconv.ParseFloat(o.StrVal(), 64)
+	if err != nil || math.IsNaN(val) {
+		c.AddReplyStr(shared.notFloat)
+		return 0, false
+	}
+	return val, true
+}
+
+// 使用最短的精确表示，数值过大或过小时才使用科学计数法
+func formatFloat(val float64) string {
+	if math.IsInf(val, 1) {
+		return "inf"
+	} else if math.IsInf(val, -1) {
+		return "-inf"
+	}
+	if abs := math.Abs(val); abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		return strconv.FormatFloat(val, 'g', -1, 64)
+	}
+	return strconv.FormatFloat(val, 'f', -1, 64)
+}
+
+// INCRBYFLOAT/HINCRBYFLOAT的回复与redis一致，总是使用定点表示，不带多余的0
+func formatFloatHuman(val float64) string {
+	return strconv.FormatFloat(val, 'f', -1, 64)
+}
+
+func StrEqual(a, b string) bool {
+	return a == b
+}
+
+func StrHash(s string) int64 {
+	return int64(siphash(s))
+}
+
+// 忽略大小写的比较和哈希，两者需要配合使用
+func StrCaseEqual(a, b string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := 0; i < len(a); i++ {
+		if toLower(a[i]) != toLower(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func StrCaseHash(s string) int64 {
+	return int64(siphashNocase(s))
+}
+
+func IntEqual(a, b int) bool {
+	return a == b
+}
+
+func IntHash(k int) int64 {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], uint64(k))
+	return int64(siphash(buf[:]))
 }
 
 func GStrEqual(a, b *Gobj) bool {
@@ -181,7 +639,19 @@ func GStrHash(key *Gobj) int64 {
 	if key.Type_ != GSTR {
 		return 0
 	}
-	hash := fnv.New64()
-	hash.Write([]byte(key.StrVal()))
-	return int64(hash.Sum64())
+	return StrHash(key.StrVal())
+}
+
+func GStrCaseEqual(a, b *Gobj) bool {
+	if a.Type_ != GSTR || b.Type_ != GSTR {
+		return false
+	}
+	return StrCaseEqual(a.StrVal(), b.StrVal())
+}
+
+func GStrCaseHash(key *Gobj) int64 {
+	if key.Type_ != GSTR {
+		return 0
+	}
+	return StrCaseHash(key.StrVal())
 }
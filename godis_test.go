@@ -1,6 +1,8 @@
 package main
 
 import (
+	"sort"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -16,7 +18,7 @@ func TestProcessQueryBuf(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, 3, len(client.args))
 	key := CreateObject(GSTR, "key")
-	val := server.db.data.Get(key)
+	val := server.dbs[0].data.Get(key)
 	assert.Equal(t, "val", val.StrVal())
 
 	ReadQuery(client, "set key val2\r\n")
@@ -24,7 +26,7 @@ func TestProcessQueryBuf(t *testing.T) {
 	assert.Nil(t, err)
 	// 处理querybuf会重新置空args，所以会保留之前的args
 	assert.Equal(t, 3, len(client.args))
-	val2 := server.db.data.Get(key)
+	val2 := server.dbs[0].data.Get(key)
 	assert.Equal(t, "val2", val2.StrVal())
 }
 
@@ -84,8 +86,52 @@ func TestInlineBuf(t *testing.T) {
 }
 
 func ReadQuery(client *GodisClient, query string) {
+	if len(client.queryBuf)-client.queryLen < len(query) {
+		client.queryBuf = append(client.queryBuf, make([]byte, len(query))...)
+	}
 	for _, v := range []byte(query) {
 		client.queryBuf[client.queryLen] = v
 		client.queryLen += 1
 	}
 }
+
+func newTestClient() *GodisClient {
+	var conf Config
+	initServer(&conf)
+	// just need real fd to support AddReply
+	return CreateClient(server.fd)
+}
+
+// 执行一条inline命令，返回拼接后的回复
+func execCommand(client *GodisClient, cmd string) string {
+	ReadQuery(client, cmd+"\r\n")
+	ProcessQueryBuf(client)
+	var sb strings.Builder
+	for client.reply.Length() > 0 {
+		n := client.reply.First()
+		sb.WriteString(n.Val.StrVal())
+		client.reply.DelNode(n)
+	}
+	return sb.String()
+}
+
+// 解析只包含bulk字符串的数组回复，并排序
+func parseBulkArray(reply string) []string {
+	lines := strings.Split(strings.TrimSuffix(reply, "\r\n"), "\r\n")
+	vals := make([]string, 0)
+	for i := 2; i < len(lines); i += 2 {
+		vals = append(vals, lines[i])
+	}
+	sort.Strings(vals)
+	return vals
+}
+
+func TestProcessCommand(t *testing.T) {
+	client := newTestClient()
+	assert.Equal(t, "-ERR unknown command 'foo'\r\n", execCommand(client, "foo"))
+	assert.Equal(t, "-ERR wrong number of arguments for 'get' command\r\n", execCommand(client, "get"))
+	assert.Equal(t, "+OK\r\n", execCommand(client, "SET key val"))
+	assert.Equal(t, "$3\r\nval\r\n", execCommand(client, "get key"))
+	assert.Equal(t, "$3\r\nval\r\n", execCommand(client, "GeT key"))
+	assert.Equal(t, "$-1\r\n", execCommand(client, "get nokey"))
+}
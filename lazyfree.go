@@ -0,0 +1,81 @@
+package main
+
+import "sync/atomic"
+
+// 后台释放较大的value，避免在事件循环中逐个释放大量元素
+
+const (
+	// 元素个数超过该值的value交给lazyfree协程释放
+	LAZYFREE_THRESHOLD = 64
+	LAZYFREE_QUEUE_LEN = 1024
+)
+
+var (
+	lazyfreeJobs = make(chan func(), LAZYFREE_QUEUE_LEN)
+	// 等待释放和已经释放的对象个数
+	lazyfreePendingObjects int64
+	lazyfreedObjects       int64
+)
+
+func init() {
+	go func() {
+		for job := range lazyfreeJobs {
+			job()
+		}
+	}()
+}
+
+// 提交一个释放count个对象的任务，队列满时直接在当前协程释放
+func lazyfreeSubmit(count int64, fn func()) {
+	atomic.AddInt64(&lazyfreePendingObjects, count)
+	job := func() {
+		fn()
+		atomic.AddInt64(&lazyfreePendingObjects, -count)
+		atomic.AddInt64(&lazyfreedObjects, count)
+	}
+	select {
+	case lazyfreeJobs <- job:
+	default:
+		job()
+	}
+}
+
+// 释放value需要处理的元素个数
+func lazyfreeGetFreeEffort(o *Gobj) int64 {
+	switch o.Type_ {
+	case GLIST:
+		return int64(o.Val_.(*GobjList).Length())
+	case GSET, GDICT:
+		return o.Val_.(*GobjDict).Size()
+	case GZSET:
+		return o.Val_.(*ZSet).Length()
+	}
+	return 1
+}
+
+// 释放一个value的引用，只有当前是唯一引用且元素较多时才交给后台释放
+func freeObjectAsync(o *Gobj) {
+	if o == nil {
+		return
+	}
+	if atomic.LoadInt32(&o.refCount) == 1 && lazyfreeGetFreeEffort(o) > LAZYFREE_THRESHOLD {
+		lazyfreeSubmit(1, o.DecrRefCount)
+		return
+	}
+	o.DecrRefCount()
+}
+
+// 释放从db中摘下的整个keyspace，value直接同步释放，不再经过freeObjectAsync
+func freeKeyspace(data, expire *GobjDict) {
+	expire.Empty()
+	data.forEach(func(e *GobjEntry) {
+		e.Key.DecrRefCount()
+		e.Val.DecrRefCount()
+	})
+}
+
+func freeKeyspaceAsync(data, expire *GobjDict) {
+	lazyfreeSubmit(data.Size(), func() {
+		freeKeyspace(data, expire)
+	})
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 等待后台释放完成
+func waitLazyfree(t *testing.T) {
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt64(&lazyfreePendingObjects) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("lazyfree timeout")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func fillSet(client *GodisClient, key string, n int) {
+	var sb strings.Builder
+	sb.WriteString("sadd " + key)
+	for i := 0; i < n; i++ {
+		sb.WriteString(" m" + strconv.Itoa(i))
+	}
+	execCommand(client, sb.String())
+}
+
+func TestLazyfree(t *testing.T) {
+	client := newTestClient()
+	waitLazyfree(t)
+	freed := atomic.LoadInt64(&lazyfreedObjects)
+
+	// 小value同步释放
+	fillSet(client, "small", 10)
+	o := server.dbs[0].data.Get(CreateObject(GSTR, "small"))
+	assert.Equal(t, shared.cone, execCommand(client, "unlink small"))
+	assert.Nil(t, o.Val_)
+
+	fillSet(client, "big", 100)
+	o = server.dbs[0].data.Get(CreateObject(GSTR, "big"))
+	assert.Equal(t, shared.cone, execCommand(client, "unlink big"))
+	waitLazyfree(t)
+	assert.Equal(t, freed+1, atomic.LoadInt64(&lazyfreedObjects))
+	assert.Nil(t, o.Val_)
+
+	// DEL总是同步释放
+	fillSet(client, "big", 100)
+	assert.Equal(t, shared.cone, execCommand(client, "del big"))
+	assert.Equal(t, freed+1, atomic.LoadInt64(&lazyfreedObjects))
+
+	// 覆盖时释放旧value，副本共享的元素不受影响
+	fillSet(client, "big", 100)
+	execCommand(client, "copy big big2")
+	execCommand(client, "set big v")
+	waitLazyfree(t)
+	assert.Equal(t, freed+2, atomic.LoadInt64(&lazyfreedObjects))
+	assert.Equal(t, ":100\r\n", execCommand(client, "scard big2"))
+	assert.Equal(t, shared.cone, execCommand(client, "sismember big2 m99"))
+
+	for i := 0; i < 10; i++ {
+		execCommand(client, "set k"+strconv.Itoa(i)+" v")
+	}
+	assert.Equal(t, shared.ok, execCommand(client, "flushdb async"))
+	waitLazyfree(t)
+	assert.Equal(t, freed+14, atomic.LoadInt64(&lazyfreedObjects))
+	assert.Equal(t, ":0\r\n", execCommand(client, "dbsize"))
+}
+
+func TestFreeObject(t *testing.T) {
+	client := newTestClient()
+	execCommand(client, "rpush l a b")
+	execCommand(client, "zadd z 1 a")
+	l := server.dbs[0].data.Get(CreateObject(GSTR, "l"))
+	member := l.Val_.(*GobjList).First().Val
+	z := server.dbs[0].data.Get(CreateObject(GSTR, "z"))
+	zmember := z.Val_.(*ZSet).zsl.First().Member
+	execCommand(client, "del l z")
+	assert.Nil(t, member.Val_)
+	assert.Nil(t, zmember.Val_)
+}
+
+func TestInfo(t *testing.T) {
+	client := newTestClient()
+	execCommand(client, "set a 1 ex 100")
+	execCommand(client, "select 3")
+	execCommand(client, "set b 1")
+	info := execCommand(client, "info")
+	for _, s := range []string{"# Server\r\n", "# Clients\r\n", "# Memory\r\n", "# Stats\r\n",
+		"lazyfree_pending_objects:", "expired_keys:", "expired_stale_perc:", "expire_cycle_cpu_milliseconds:",
+		"db0:keys=1,expires=1\r\n", "db3:keys=1,expires=0\r\n"} {
+		assert.Contains(t, info, s)
+	}
+	info = execCommand(client, "info memory KEYSPACE")
+	assert.Contains(t, info, "# Memory\r\n")
+	assert.Contains(t, info, "# Keyspace\r\n")
+	assert.NotContains(t, info, "# Server\r\n")
+	assert.Equal(t, shared.emptyBulk, execCommand(client, "info none"))
+}
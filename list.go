@@ -1,41 +1,44 @@
 package main
 
-type Node struct {
-	Val  *Gobj
-	next *Node
-	prev *Node
+type Node[T any] struct {
+	Val  T
+	next *Node[T]
+	prev *Node[T]
 }
 
-type ListType struct {
-	EqualFunc func(a, b *Gobj) bool
+// DupFunc在复制整个列表时调用，FreeFunc在结点被删除或列表被清空时调用，都可以为nil
+type ListType[T any] struct {
+	EqualFunc func(a, b T) bool
+	DupFunc   func(val T) T
+	FreeFunc  func(val T)
 }
 
-type List struct {
-	ListType
-	head   *Node
-	tail   *Node
+type List[T any] struct {
+	ListType[T]
+	head   *Node[T]
+	tail   *Node[T]
 	length int
 }
 
-func ListCreate(ListType ListType) *List {
-	var list List
+func ListCreate[T any](ListType ListType[T]) *List[T] {
+	var list List[T]
 	list.ListType = ListType
 	return &list
 }
 
-func (list *List) Length() int {
+func (list *List[T]) Length() int {
 	return list.length
 }
 
-func (list *List) First() *Node {
+func (list *List[T]) First() *Node[T] {
 	return list.head
 }
 
-func (list *List) Last() *Node {
+func (list *List[T]) Last() *Node[T] {
 	return list.tail
 }
 
-func (list *List) Find(val *Gobj) *Node {
+func (list *List[T]) Find(val T) *Node[T] {
 	p := list.head
 	for p != nil {
 		if list.EqualFunc(p.Val, val) {
@@ -47,9 +50,9 @@ func (list *List) Find(val *Gobj) *Node {
 	return p
 }
 
-func (list *List) Append(val *Gobj) {
+func (list *List[T]) Append(val T) {
 	// 尾插法
-	var n Node
+	var n Node[T]
 	n.Val = val
 	// list为空
 	if list.head == nil {
@@ -63,9 +66,9 @@ func (list *List) Append(val *Gobj) {
 	list.length++
 }
 
-func (list *List) LPush(val *Gobj) {
+func (list *List[T]) LPush(val T) {
 	// 头插法
-	var n Node
+	var n Node[T]
 	n.Val = val
 	// list为空
 	if list.head == nil {
@@ -79,7 +82,52 @@ func (list *List) LPush(val *Gobj) {
 	list.length++
 }
 
-func (list *List) DelNode(n *Node) {
+// 支持负数下标，-1表示最后一个结点，越界返回nil
+func (list *List[T]) Index(idx int) *Node[T] {
+	var n *Node[T]
+	if idx < 0 {
+		idx = -idx - 1
+		n = list.tail
+		for n != nil && idx > 0 {
+			n = n.prev
+			idx--
+		}
+	} else {
+		n = list.head
+		for n != nil && idx > 0 {
+			n = n.next
+			idx--
+		}
+	}
+	return n
+}
+
+// 在old结点的前面或后面插入
+func (list *List[T]) InsertNode(old *Node[T], val T, after bool) {
+	n := &Node[T]{Val: val}
+	if after {
+		n.prev = old
+		n.next = old.next
+		if list.tail == old {
+			list.tail = n
+		}
+	} else {
+		n.next = old
+		n.prev = old.prev
+		if list.head == old {
+			list.head = n
+		}
+	}
+	if n.prev != nil {
+		n.prev.next = n
+	}
+	if n.next != nil {
+		n.next.prev = n
+	}
+	list.length++
+}
+
+func (list *List[T]) DelNode(n *Node[T]) {
 	if n == nil {
 		return
 	}
@@ -89,6 +137,10 @@ func (list *List) DelNode(n *Node) {
 			n.next.prev = nil
 		}
 		list.head = n.next
+		// 只有一个结点时，tail也要置空
+		if list.tail == n {
+			list.tail = nil
+		}
 		n.next = nil
 	} else if list.tail == n {
 		if n.prev != nil {
@@ -107,8 +159,45 @@ func (list *List) DelNode(n *Node) {
 		n.next = nil
 	}
 	list.length--
+	list.freeVal(n.Val)
+}
+
+// 替换结点的值，旧值通过FreeFunc释放
+func (list *List[T]) SetNodeVal(n *Node[T], val T) {
+	old := n.Val
+	n.Val = val
+	list.freeVal(old)
+}
+
+// 删除所有结点，对每个结点的值调用FreeFunc
+func (list *List[T]) Empty() {
+	for n := list.head; n != nil; n = n.next {
+		list.freeVal(n.Val)
+	}
+	list.head = nil
+	list.tail = nil
+	list.length = 0
+}
+
+// 复制列表，结点的值通过DupFunc复制，DupFunc为nil时直接共享
+func (list *List[T]) Dup() *List[T] {
+	dup := ListCreate(list.ListType)
+	for n := list.head; n != nil; n = n.next {
+		val := n.Val
+		if list.DupFunc != nil {
+			val = list.DupFunc(val)
+		}
+		dup.Append(val)
+	}
+	return dup
+}
+
+func (list *List[T]) freeVal(val T) {
+	if list.FreeFunc != nil {
+		list.FreeFunc(val)
+	}
 }
 
-func (list *List) Delete(val *Gobj) {
+func (list *List[T]) Delete(val T) {
 	list.DelNode(list.Find(val))
 }
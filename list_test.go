@@ -7,7 +7,7 @@ import (
 )
 
 func TestList(t *testing.T) {
-	list := ListCreate(ListType{EqualFunc: GStrEqual})
+	list := ListCreate(ListType[*Gobj]{EqualFunc: GStrEqual})
 	assert.Equal(t, list.Length(), 0)
 
 	list.Append(CreateObject(GSTR, "4"))
@@ -54,3 +54,70 @@ func TestList(t *testing.T) {
 	assert.Equal(t, list.Length(), 2)
 	assert.Equal(t, list.Last().Val.Val_.(string), "2")
 }
+
+func TestListIndexInsert(t *testing.T) {
+	list := ListCreate(ListType[*Gobj]{EqualFunc: GStrEqual})
+	assert.Nil(t, list.Index(0))
+	assert.Nil(t, list.Index(-1))
+
+	list.Append(CreateObject(GSTR, "1"))
+	list.Append(CreateObject(GSTR, "3"))
+	list.InsertNode(list.First(), CreateObject(GSTR, "2"), true)
+	list.InsertNode(list.First(), CreateObject(GSTR, "0"), false)
+	list.InsertNode(list.Last(), CreateObject(GSTR, "4"), true)
+	// 0 1 2 3 4
+	assert.Equal(t, 5, list.Length())
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, string(rune('0'+i)), list.Index(i).Val.StrVal())
+		assert.Equal(t, string(rune('0'+i)), list.Index(i-5).Val.StrVal())
+	}
+	assert.Nil(t, list.Index(5))
+	assert.Nil(t, list.Index(-6))
+	assert.Equal(t, "4", list.Last().Val.StrVal())
+
+	for list.Length() > 0 {
+		list.DelNode(list.First())
+	}
+	assert.Nil(t, list.First())
+	assert.Nil(t, list.Last())
+}
+
+func TestListGeneric(t *testing.T) {
+	list := ListCreate(ListType[int]{EqualFunc: func(a, b int) bool { return a == b }})
+	for i := 1; i <= 3; i++ {
+		list.Append(i)
+	}
+	list.LPush(0)
+	assert.Equal(t, 4, list.Length())
+	assert.Equal(t, 0, list.First().Val)
+	assert.Equal(t, 3, list.Last().Val)
+	assert.Equal(t, 2, list.Index(-2).Val)
+	list.Delete(2)
+	assert.Nil(t, list.Find(2))
+	assert.Equal(t, 3, list.Index(2).Val)
+}
+
+func TestListDupFree(t *testing.T) {
+	freed := map[int]int{}
+	list := ListCreate(ListType[int]{
+		EqualFunc: func(a, b int) bool { return a == b },
+		DupFunc:   func(val int) int { return val * 10 },
+		FreeFunc:  func(val int) { freed[val]++ },
+	})
+	for i := 1; i <= 3; i++ {
+		list.Append(i)
+	}
+	dup := list.Dup()
+	assert.Equal(t, 3, dup.Length())
+	assert.Equal(t, 10, dup.First().Val)
+	assert.Equal(t, 30, dup.Last().Val)
+
+	list.Delete(2)
+	assert.Equal(t, map[int]int{2: 1}, freed)
+	list.SetNodeVal(list.First(), 4)
+	assert.Equal(t, map[int]int{1: 1, 2: 1}, freed)
+	list.Empty()
+	assert.Equal(t, 0, list.Length())
+	assert.Nil(t, list.First())
+	assert.Equal(t, map[int]int{1: 1, 2: 1, 3: 1, 4: 1}, freed)
+}
@@ -0,0 +1,176 @@
+package main
+
+import "errors"
+
+// LZF压缩，移植自redis使用的liblzf，用于RDB中字符串的压缩
+
+const (
+	LZF_HLOG    = 16
+	LZF_HSIZE   = 1 << LZF_HLOG
+	LZF_MAX_LIT = 1 << 5
+	LZF_MAX_OFF = 1 << 13
+	LZF_MAX_REF = (1 << 8) + (1 << 3)
+)
+
+var errLzfCorrupted = errors.New("invalid LZF compressed data")
+
+func lzfIdx(h uint32) uint32 {
+	return ((h >> (3*8 - LZF_HLOG)) - h*5) & (LZF_HSIZE - 1)
+}
+
+// 压缩后的长度不超过outLen时返回压缩结果，否则返回nil
+func lzfCompress(in []byte, outLen int) []byte {
+	inLen := len(in)
+	if inLen == 0 || outLen == 0 {
+		return nil
+	}
+	// htab保存位置加一，0表示空
+	htab := make([]int, LZF_HSIZE)
+	out := make([]byte, outLen+1)
+	ip, op, lit := 0, 1, 0
+	var hval uint32
+	if inLen >= 2 {
+		hval = uint32(in[0])<<8 | uint32(in[1])
+	}
+	for ip < inLen-2 {
+		hval = hval<<8 | uint32(in[ip+2])
+		slot := lzfIdx(hval)
+		ref := htab[slot] - 1
+		htab[slot] = ip + 1
+		if off := ip - ref - 1; ref > 0 && off < LZF_MAX_OFF &&
+			in[ref+2] == in[ip+2] && in[ref] == in[ip] && in[ref+1] == in[ip+1] {
+			// 匹配长度至少为3
+			l := 2
+			maxlen := inLen - ip - l
+			if maxlen > LZF_MAX_REF {
+				maxlen = LZF_MAX_REF
+			}
+			if op+3+1 >= outLen && op-b2i(lit == 0)+3+1 >= outLen {
+				return nil
+			}
+			out[op-lit-1] = byte(lit - 1)
+			op -= b2i(lit == 0)
+			// 与liblzf的展开循环保持一致，保证压缩结果相同
+			mismatch := false
+			if maxlen > 16 {
+				for i := 0; i < 16 && !mismatch; i++ {
+					l++
+					mismatch = in[ref+l] != in[ip+l]
+				}
+			}
+			for !mismatch {
+				l++
+				mismatch = l >= maxlen || in[ref+l] != in[ip+l]
+			}
+			l -= 2
+			ip++
+			if l < 7 {
+				out[op] = byte(off>>8 + l<<5)
+				op++
+			} else {
+				out[op] = byte(off>>8 + 7<<5)
+				out[op+1] = byte(l - 7)
+				op += 2
+			}
+			out[op] = byte(off)
+			op++
+			lit = 0
+			op++
+			ip += l + 1
+			if ip >= inLen-2 {
+				break
+			}
+			// 把匹配结尾的两个位置也加入hash表
+			ip -= 2
+			hval = uint32(in[ip])<<8 | uint32(in[ip+1])
+			for i := 0; i < 2; i++ {
+				hval = hval<<8 | uint32(in[ip+2])
+				htab[lzfIdx(hval)] = ip + 1
+				ip++
+			}
+		} else {
+			if op >= outLen {
+				return nil
+			}
+			lit++
+			out[op] = in[ip]
+			op++
+			ip++
+			if lit == LZF_MAX_LIT {
+				out[op-lit-1] = byte(lit - 1)
+				lit = 0
+				op++
+			}
+		}
+	}
+	if op+3 > outLen {
+		return nil
+	}
+	for ip < inLen {
+		lit++
+		out[op] = in[ip]
+		op++
+		ip++
+		if lit == LZF_MAX_LIT {
+			out[op-lit-1] = byte(lit - 1)
+			lit = 0
+			op++
+		}
+	}
+	out[op-lit-1] = byte(lit - 1)
+	op -= b2i(lit == 0)
+	return out[:op]
+}
+
+func b2i(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// 解压为outLen字节，数据不完整或长度不符时返回错误
+func lzfDecompress(in []byte, outLen int) ([]byte, error) {
+	out := make([]byte, 0, outLen)
+	ip := 0
+	for ip < len(in) {
+		ctrl := int(in[ip])
+		ip++
+		if ctrl < 1<<5 {
+			// 字面量
+			ctrl++
+			if len(out)+ctrl > outLen || ip+ctrl > len(in) {
+				return nil, errLzfCorrupted
+			}
+			out = append(out, in[ip:ip+ctrl]...)
+			ip += ctrl
+			continue
+		}
+		// 回溯引用
+		l := ctrl >> 5
+		ref := len(out) - (ctrl&0x1f)<<8 - 1
+		if ip >= len(in) {
+			return nil, errLzfCorrupted
+		}
+		if l == 7 {
+			l += int(in[ip])
+			ip++
+			if ip >= len(in) {
+				return nil, errLzfCorrupted
+			}
+		}
+		ref -= int(in[ip])
+		ip++
+		if len(out)+l+2 > outLen || ref < 0 {
+			return nil, errLzfCorrupted
+		}
+		// 引用的区域可能和输出重叠，逐字节复制
+		for i := 0; i < l+2; i++ {
+			out = append(out, out[ref+i])
+		}
+	}
+	if len(out) != outLen {
+		return nil, errLzfCorrupted
+	}
+	return out, nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLzf(t *testing.T) {
+	// 按liblzf的算法手工推导的结果
+	in := []byte(strings.Repeat("a", 100))
+	comp := lzfCompress(in, len(in)-4)
+	assert.Equal(t, []byte("\x01aa\xe0\x57\x00\x01aa"), comp)
+	out, err := lzfDecompress(comp, len(in))
+	assert.Nil(t, err)
+	assert.Equal(t, in, out)
+
+	// 无法压缩时返回nil
+	assert.Nil(t, lzfCompress([]byte("abcdefghijklmnopqrstuvwxyz"), 22))
+
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 200; i++ {
+		buf := make([]byte, r.Intn(20000)+1)
+		alphabet := r.Intn(20) + 1
+		for j := range buf {
+			buf[j] = byte('a' + r.Intn(alphabet))
+		}
+		comp := lzfCompress(buf, len(buf)+len(buf)/16+64)
+		assert.NotNil(t, comp)
+		out, err := lzfDecompress(comp, len(buf))
+		assert.Nil(t, err)
+		assert.Equal(t, buf, out)
+	}
+
+	_, err = lzfDecompress(comp[:len(comp)-1], len(in))
+	assert.NotNil(t, err)
+	_, err = lzfDecompress([]byte{0x20, 0x05}, 10)
+	assert.NotNil(t, err)
+	_, err = lzfDecompress(comp, len(in)-1)
+	assert.NotNil(t, err)
+}
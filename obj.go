@@ -1,6 +1,9 @@
 package main
 
-import "strconv"
+import (
+	"strconv"
+	"sync/atomic"
+)
 
 type Gtype uint8
 
@@ -14,10 +17,57 @@ const (
 
 type Gval interface{}
 
+// 以Gobj为元素的容器类型，dict通过回调持有key和val的引用
+type (
+	GobjDict  = Dict[*Gobj, *Gobj]
+	GobjEntry = Entry[*Gobj, *Gobj]
+	GobjList  = List[*Gobj]
+	GobjNode  = Node[*Gobj]
+)
+
+var gobjDictType = DictType[*Gobj, *Gobj]{
+	HashFunc:      GStrHash,
+	EqualFunc:     GStrEqual,
+	KeyDup:        gobjIncrRef,
+	ValDup:        gobjIncrRef,
+	KeyDestructor: gobjDecrRef,
+	ValDestructor: gobjDecrRef,
+}
+
+func GobjDictCreate() *GobjDict {
+	return DictCreate(gobjDictType)
+}
+
+// 列表结点被删除时释放元素的引用，加入结点时由调用方增加引用
+var gobjListType = ListType[*Gobj]{
+	EqualFunc: GStrEqual,
+	DupFunc:   gobjIncrRef,
+	FreeFunc:  gobjDecrRef,
+}
+
+func GobjListCreate() *GobjList {
+	return ListCreate(gobjListType)
+}
+
+// 集合类型的val为nil
+func gobjIncrRef(o *Gobj) *Gobj {
+	if o != nil {
+		o.IncrRefCount()
+	}
+	return o
+}
+
+func gobjDecrRef(o *Gobj) {
+	if o != nil {
+		o.DecrRefCount()
+	}
+}
+
+// refCount可能被lazyfree协程并发修改，需要原子操作
 type Gobj struct {
 	Type_    Gtype
 	Val_     Gval
-	refCount int
+	refCount int32
 }
 
 func (o *Gobj) IntVal() int64 {
@@ -28,6 +78,14 @@ func (o *Gobj) IntVal() int64 {
 	return val
 }
 
+func (o *Gobj) FloatVal() float64 {
+	if o.Type_ != GSTR {
+		return 0
+	}
+	val, _ := strconv.ParseFloat(o.Val_.(string), 64)
+	return val
+}
+
 func (o *Gobj) StrVal() string {
 	if o.Type_ != GSTR {
 		return ""
@@ -52,12 +110,75 @@ func CreateObject(typ Gtype, ptr interface{}) *Gobj {
 }
 
 func (o *Gobj) IncrRefCount() {
-	o.refCount++
+	atomic.AddInt32(&o.refCount, 1)
 }
 
 func (o *Gobj) DecrRefCount() {
-	o.refCount--
-	if o.refCount == 0 {
-		o.Val_ = nil
+	if atomic.AddInt32(&o.refCount, -1) == 0 {
+		freeObject(o)
+	}
+}
+
+// 引用计数归零时释放集合持有的元素引用
+func freeObject(o *Gobj) {
+	switch o.Type_ {
+	case GLIST:
+		o.Val_.(*GobjList).Empty()
+	case GSET, GDICT:
+		o.Val_.(*GobjDict).Empty()
+	case GZSET:
+		zs := o.Val_.(*ZSet)
+		zs.dict.Empty()
+		for n := zs.zsl.First(); n != nil; n = n.Next() {
+			n.Member.DecrRefCount()
+		}
+	}
+	o.Val_ = nil
+}
+
+// 深拷贝一个value，集合内的元素都是不可变的字符串，直接共享
+func DupObject(o *Gobj) *Gobj {
+	switch o.Type_ {
+	case GSTR:
+		return CreateObject(GSTR, o.StrVal())
+	case GLIST:
+		return CreateObject(GLIST, o.Val_.(*GobjList).Dup())
+	case GSET, GDICT:
+		var dup *Gobj
+		if o.Type_ == GSET {
+			dup = createSetObject()
+		} else {
+			dup = createHashObject()
+		}
+		dict := dup.Val_.(*GobjDict)
+		o.Val_.(*GobjDict).forEach(func(e *GobjEntry) {
+			dict.Add(e.Key, e.Val)
+		})
+		return dup
+	case GZSET:
+		dup := createZsetObject()
+		zs := dup.Val_.(*ZSet)
+		for n := o.Val_.(*ZSet).zsl.First(); n != nil; n = n.Next() {
+			zs.Add(n.Score, n.Member, 0)
+		}
+		return dup
+	}
+	return nil
+}
+
+// 类型名称，用于TYPE命令
+func typeName(o *Gobj) string {
+	switch o.Type_ {
+	case GSTR:
+		return "string"
+	case GLIST:
+		return "list"
+	case GSET:
+		return "set"
+	case GZSET:
+		return "zset"
+	case GDICT:
+		return "hash"
 	}
+	return "unknown"
 }
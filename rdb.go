@@ -0,0 +1,952 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RDB快照文件，按照redis的RDB v9格式：
+// "REDIS0009" | AUX... | SELECTDB id RESIZEDB size expires [EXPIRETIME_MS ms] type key value ... | EOF | crc64
+// 保存时只使用基本类型，加载时还能解码RDB v12及以前的ziplist/listpack/intset等紧凑编码
+
+const (
+	RDB_VERSION = 9
+	// 能够加载的最高版本
+	RDB_MAX_LOAD_VERSION = 12
+
+	RDB_TYPE_STRING           = 0
+	RDB_TYPE_LIST             = 1
+	RDB_TYPE_SET              = 2
+	RDB_TYPE_ZSET             = 3 // score以字符串保存
+	RDB_TYPE_HASH             = 4
+	RDB_TYPE_ZSET_2           = 5 // score以二进制double保存
+	RDB_TYPE_LIST_ZIPLIST     = 10
+	RDB_TYPE_SET_INTSET       = 11
+	RDB_TYPE_ZSET_ZIPLIST     = 12
+	RDB_TYPE_HASH_ZIPLIST     = 13
+	RDB_TYPE_LIST_QUICKLIST   = 14
+	RDB_TYPE_HASH_LISTPACK    = 16
+	RDB_TYPE_ZSET_LISTPACK    = 17
+	RDB_TYPE_LIST_QUICKLIST_2 = 18
+	RDB_TYPE_SET_LISTPACK     = 20
+
+	// quicklist 2中每个结点的类型
+	QUICKLIST_NODE_CONTAINER_PLAIN  = 1
+	QUICKLIST_NODE_CONTAINER_PACKED = 2
+
+	RDB_OPCODE_SLOT_INFO       = 244
+	RDB_OPCODE_FUNCTION2       = 245
+	RDB_OPCODE_FUNCTION_PRE_GA = 246
+	RDB_OPCODE_MODULE_AUX      = 247
+	RDB_OPCODE_IDLE            = 248
+	RDB_OPCODE_FREQ            = 249
+	RDB_OPCODE_AUX             = 250
+	RDB_OPCODE_RESIZEDB        = 251
+	RDB_OPCODE_EXPIRETIME_MS   = 252
+	RDB_OPCODE_EXPIRETIME      = 253
+	RDB_OPCODE_SELECTDB        = 254
+	RDB_OPCODE_EOF             = 255
+
+	// 长度编码，由第一个字节的高两位决定
+	RDB_6BITLEN  = 0
+	RDB_14BITLEN = 1
+	RDB_32BITLEN = 0x80
+	RDB_64BITLEN = 0x81
+	RDB_ENCVAL   = 3
+
+	// 长度编码为RDB_ENCVAL时字符串的编码方式
+	RDB_ENC_INT8  = 0
+	RDB_ENC_INT16 = 1
+	RDB_ENC_INT32 = 2
+	RDB_ENC_LZF   = 3
+)
+
+const (
+	DEFAULT_DBFILENAME = "dump.rdb"
+	DEFAULT_SAVE       = "3600 1 300 100 60 10000"
+	// BGSAVE失败后，save规则至少间隔该秒数才会再次触发
+	CONFIG_BGSAVE_RETRY_DELAY = 5
+)
+
+var errBgsaveInProgress = errors.New("Background save already in progress")
+
+// 距离上次保存超过seconds秒，且至少有changes次修改时自动BGSAVE
+type saveParam struct {
+	seconds int64
+	changes int64
+}
+
+// 解析"seconds changes [seconds changes ...]"格式的save配置
+func parseSaveParams(conf string) ([]saveParam, error) {
+	args := strings.Fields(conf)
+	if len(args)%2 != 0 {
+		return nil, fmt.Errorf("invalid save config '%v'", conf)
+	}
+	params := make([]saveParam, 0, len(args)/2)
+	for i := 0; i < len(args); i += 2 {
+		seconds, err1 := strconv.ParseInt(args[i], 10, 64)
+		changes, err2 := strconv.ParseInt(args[i+1], 10, 64)
+		if err1 != nil || err2 != nil || seconds < 1 || changes < 0 {
+			return nil, fmt.Errorf("invalid save config '%v'", conf)
+		}
+		params = append(params, saveParam{seconds, changes})
+	}
+	return params, nil
+}
+
+// 快照中的一个key，持有key和value的引用
+type rdbEntry struct {
+	key    *Gobj
+	val    *Gobj
+	expire int64
+}
+
+// 被快照持有的value不会再被原地修改，写命令通过findKeyWrite得到一份复制。
+// 集合内部的dict暂停rehash，保证读命令也不会修改它们
+func rehashDictOf(o *Gobj) *GobjDict {
+	switch o.Type_ {
+	case GSET, GDICT:
+		return o.Val_.(*GobjDict)
+	case GZSET:
+		return o.Val_.(*ZSet).dict
+	}
+	return nil
+}
+
+// 复制所有db的key和value的引用，只需要遍历keyspace，不复制value本身
+func createSnapshot() [][]rdbEntry {
+	snap := make([][]rdbEntry, len(server.dbs))
+	for i, db := range server.dbs {
+		entries := make([]rdbEntry, 0, db.data.Size())
+		db.data.forEach(func(e *GobjEntry) {
+			e.Key.IncrRefCount()
+			e.Val.IncrRefCount()
+			if d := rehashDictOf(e.Val); d != nil {
+				d.PauseRehashing()
+			}
+			entries = append(entries, rdbEntry{e.Key, e.Val, db.getExpire(e.Key)})
+		})
+		snap[i] = entries
+	}
+	return snap
+}
+
+// 恢复rehash，引用交给lazyfree协程释放
+func releaseSnapshot(snap [][]rdbEntry) {
+	var count int64
+	for _, entries := range snap {
+		for _, e := range entries {
+			if d := rehashDictOf(e.val); d != nil {
+				d.ResumeRehashing()
+			}
+		}
+		count += int64(len(entries))
+	}
+	lazyfreeSubmit(count, func() {
+		for _, entries := range snap {
+			for _, e := range entries {
+				e.key.DecrRefCount()
+				e.val.DecrRefCount()
+			}
+		}
+	})
+}
+
+// 写入时同时计算校验和，出错后的写入都被忽略，由flush返回错误
+type rdbWriter struct {
+	w   *bufio.Writer
+	crc uint64
+	err error
+}
+
+func (rdb *rdbWriter) write(p []byte) {
+	if rdb.err != nil {
+		return
+	}
+	rdb.crc = crc64(rdb.crc, p)
+	_, rdb.err = rdb.w.Write(p)
+}
+
+func (rdb *rdbWriter) saveType(typ byte) {
+	rdb.write([]byte{typ})
+}
+
+func (rdb *rdbWriter) saveLen(l uint64) {
+	var buf [9]byte
+	switch {
+	case l < 1<<6:
+		rdb.write([]byte{byte(l) | RDB_6BITLEN<<6})
+	case l < 1<<14:
+		rdb.write([]byte{byte(l>>8) | RDB_14BITLEN<<6, byte(l)})
+	case l <= math.MaxUint32:
+		buf[0] = RDB_32BITLEN
+		binary.BigEndian.PutUint32(buf[1:], uint32(l))
+		rdb.write(buf[:5])
+	default:
+		buf[0] = RDB_64BITLEN
+		binary.BigEndian.PutUint64(buf[1:], l)
+		rdb.write(buf[:])
+	}
+}
+
+// 按照redis的规则：较短的整数字符串按整数编码，长度超过20的字符串尝试LZF压缩
+func (rdb *rdbWriter) saveString(s string) {
+	if len(s) <= 11 {
+		if enc := rdbEncodeInteger(s); enc != nil {
+			rdb.write(enc)
+			return
+		}
+	}
+	// 压缩后至少节省4个字节才使用压缩结果
+	if len(s) > 20 {
+		if comp := lzfCompress([]byte(s), len(s)-4); comp != nil {
+			rdb.saveType(RDB_ENCVAL<<6 | RDB_ENC_LZF)
+			rdb.saveLen(uint64(len(comp)))
+			rdb.saveLen(uint64(len(s)))
+			rdb.write(comp)
+			return
+		}
+	}
+	rdb.saveLen(uint64(len(s)))
+	rdb.write([]byte(s))
+}
+
+// s是32位整数的规范表示时返回编码结果，否则返回nil
+func rdbEncodeInteger(s string) []byte {
+	val, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || strconv.FormatInt(val, 10) != s {
+		return nil
+	}
+	switch {
+	case val >= math.MinInt8 && val <= math.MaxInt8:
+		return []byte{RDB_ENCVAL<<6 | RDB_ENC_INT8, byte(val)}
+	case val >= math.MinInt16 && val <= math.MaxInt16:
+		return []byte{RDB_ENCVAL<<6 | RDB_ENC_INT16, byte(val), byte(val >> 8)}
+	case val >= math.MinInt32 && val <= math.MaxInt32:
+		return []byte{RDB_ENCVAL<<6 | RDB_ENC_INT32, byte(val), byte(val >> 8), byte(val >> 16), byte(val >> 24)}
+	}
+	return nil
+}
+
+func (rdb *rdbWriter) saveMillis(ms int64) {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], uint64(ms))
+	rdb.write(buf[:])
+}
+
+func (rdb *rdbWriter) saveBinaryDouble(val float64) {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], math.Float64bits(val))
+	rdb.write(buf[:])
+}
+
+func (rdb *rdbWriter) saveAux(key, val string) {
+	rdb.saveType(RDB_OPCODE_AUX)
+	rdb.saveString(key)
+	rdb.saveString(val)
+}
+
+func rdbObjectType(o *Gobj) byte {
+	switch o.Type_ {
+	case GLIST:
+		return RDB_TYPE_LIST
+	case GSET:
+		return RDB_TYPE_SET
+	case GDICT:
+		return RDB_TYPE_HASH
+	case GZSET:
+		return RDB_TYPE_ZSET_2
+	}
+	return RDB_TYPE_STRING
+}
+
+func (rdb *rdbWriter) saveObject(o *Gobj) {
+	switch o.Type_ {
+	case GSTR:
+		rdb.saveString(o.StrVal())
+	case GLIST:
+		list := o.Val_.(*GobjList)
+		rdb.saveLen(uint64(list.Length()))
+		for n := list.First(); n != nil; n = n.next {
+			rdb.saveString(n.Val.StrVal())
+		}
+	case GSET, GDICT:
+		dict := o.Val_.(*GobjDict)
+		rdb.saveLen(uint64(dict.Size()))
+		// 快照可能在其他协程中保存，只能使用不修改dict的迭代器
+		iter := dict.Iterator()
+		for e := iter.Next(); e != nil; e = iter.Next() {
+			rdb.saveString(e.Key.StrVal())
+			if o.Type_ == GDICT {
+				rdb.saveString(e.Val.StrVal())
+			}
+		}
+		iter.Release()
+	case GZSET:
+		// 与redis的保存顺序一致，从score最大的元素开始
+		zsl := o.Val_.(*ZSet).zsl
+		rdb.saveLen(uint64(zsl.Length()))
+		for n := zsl.Last(); n != nil; n = n.Prev() {
+			rdb.saveString(n.Member.StrVal())
+			rdb.saveBinaryDouble(n.Score)
+		}
+	}
+}
+
+func (rdb *rdbWriter) saveKeyValuePair(e *rdbEntry) {
+	if e.expire != -1 {
+		rdb.saveType(RDB_OPCODE_EXPIRETIME_MS)
+		rdb.saveMillis(e.expire)
+	}
+	rdb.saveType(rdbObjectType(e.val))
+	rdb.saveString(e.key.StrVal())
+	rdb.saveObject(e.val)
+}
+
+// 把快照按RDB格式写入w
+func rdbSaveSnapshot(w io.Writer, snap [][]rdbEntry) error {
+	rdb := &rdbWriter{w: bufio.NewWriter(w)}
+	rdb.write([]byte(fmt.Sprintf("REDIS%04d", RDB_VERSION)))
+	rdb.saveAux("redis-bits", "64")
+	rdb.saveAux("ctime", strconv.FormatInt(time.Now().Unix(), 10))
+	for id, entries := range snap {
+		if len(entries) == 0 {
+			continue
+		}
+		var expires uint64
+		for i := range entries {
+			if entries[i].expire != -1 {
+				expires++
+			}
+		}
+		rdb.saveType(RDB_OPCODE_SELECTDB)
+		rdb.saveLen(uint64(id))
+		rdb.saveType(RDB_OPCODE_RESIZEDB)
+		rdb.saveLen(uint64(len(entries)))
+		rdb.saveLen(expires)
+		for i := range entries {
+			rdb.saveKeyValuePair(&entries[i])
+		}
+	}
+	rdb.saveType(RDB_OPCODE_EOF)
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], rdb.crc)
+	rdb.write(buf[:])
+	if rdb.err != nil {
+		return rdb.err
+	}
+	return rdb.w.Flush()
+}
+
+// 先写入临时文件，成功后再原子地rename为filename
+func rdbSaveFile(filename string, snap [][]rdbEntry) error {
+	tmpfile := filepath.Join(filepath.Dir(filename), fmt.Sprintf("temp-%d.rdb", os.Getpid()))
+	f, err := os.Create(tmpfile)
+	if err != nil {
+		return err
+	}
+	err = rdbSaveSnapshot(f, snap)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmpfile, filename)
+	}
+	if err != nil {
+		os.Remove(tmpfile)
+	}
+	return err
+}
+
+// 在事件循环中同步保存
+func rdbSave() error {
+	if server.rdbBgsaveDone != nil {
+		return errBgsaveInProgress
+	}
+	snap := createSnapshot()
+	err := rdbSaveFile(server.rdbFilename, snap)
+	releaseSnapshot(snap)
+	if err != nil {
+		log.Printf("save rdb error: %v\n", err)
+		return err
+	}
+	log.Println("DB saved on disk")
+	server.dirty = 0
+	server.lastSave = time.Now().Unix()
+	server.lastBgsaveOK = true
+	return nil
+}
+
+// 创建快照后在协程中写入文件，完成后由rdbCron处理结果
+func rdbSaveBackground() error {
+	if server.rdbBgsaveDone != nil {
+		return errBgsaveInProgress
+	}
+	server.dirtyBeforeBgsave = server.dirty
+	server.lastBgsaveTry = time.Now().Unix()
+	snap := createSnapshot()
+	done := make(chan error, 1)
+	filename := server.rdbFilename
+	go func() {
+		done <- rdbSaveFile(filename, snap)
+	}()
+	server.rdbSnapshot = snap
+	server.rdbBgsaveDone = done
+	log.Println("Background saving started")
+	return nil
+}
+
+// BGSAVE完成时释放快照并更新状态，返回是否完成
+func checkBgsaveDone() bool {
+	select {
+	case err := <-server.rdbBgsaveDone:
+		releaseSnapshot(server.rdbSnapshot)
+		server.rdbSnapshot = nil
+		server.rdbBgsaveDone = nil
+		if err != nil {
+			log.Printf("background saving error: %v\n", err)
+			server.lastBgsaveOK = false
+			return true
+		}
+		log.Println("Background saving terminated with success")
+		server.dirty -= server.dirtyBeforeBgsave
+		server.lastSave = time.Now().Unix()
+		server.lastBgsaveOK = true
+		return true
+	default:
+		return false
+	}
+}
+
+// 检查BGSAVE是否完成，或者按save规则触发BGSAVE
+func rdbCron() {
+	if server.rdbBgsaveDone != nil {
+		checkBgsaveDone()
+		return
+	}
+	now := time.Now().Unix()
+	for _, sp := range server.saveParams {
+		if server.dirty >= sp.changes && now-server.lastSave > sp.seconds &&
+			(server.lastBgsaveOK || now-server.lastBgsaveTry > CONFIG_BGSAVE_RETRY_DELAY) {
+			log.Printf("%d changes in %d seconds. Saving...\n", sp.changes, sp.seconds)
+			rdbSaveBackground()
+			return
+		}
+	}
+}
+
+func saveCommand(c *GodisClient) {
+	if err := rdbSave(); err != nil {
+		c.AddReplyError(err.Error())
+		return
+	}
+	c.AddReplyStr(shared.ok)
+}
+
+func bgsaveCommand(c *GodisClient) {
+	if err := rdbSaveBackground(); err != nil {
+		c.AddReplyError(err.Error())
+		return
+	}
+	c.AddReplyStr("+Background saving started\r\n")
+}
+
+func lastsaveCommand(c *GodisClient) {
+	c.AddReplyInt(server.lastSave)
+}
+
+// 读取时同时计算校验和
+type rdbReader struct {
+	r   *bufio.Reader
+	crc uint64
+}
+
+func (rdb *rdbReader) read(n int) ([]byte, error) {
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(rdb.r, buf); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	rdb.crc = crc64(rdb.crc, buf)
+	return buf, nil
+}
+
+func (rdb *rdbReader) loadType() (byte, error) {
+	buf, err := rdb.read(1)
+	if err != nil {
+		return 0, err
+	}
+	return buf[0], nil
+}
+
+// 返回长度，以及是否为特殊编码的字符串，特殊编码时长度表示编码类型
+func (rdb *rdbReader) loadLenWithEncoding() (uint64, bool, error) {
+	buf, err := rdb.read(1)
+	if err != nil {
+		return 0, false, err
+	}
+	switch typ := buf[0] >> 6; {
+	case typ == RDB_ENCVAL:
+		return uint64(buf[0] & 0x3f), true, nil
+	case typ == RDB_6BITLEN:
+		return uint64(buf[0] & 0x3f), false, nil
+	case typ == RDB_14BITLEN:
+		next, err := rdb.read(1)
+		if err != nil {
+			return 0, false, err
+		}
+		return uint64(buf[0]&0x3f)<<8 | uint64(next[0]), false, nil
+	case buf[0] == RDB_32BITLEN:
+		next, err := rdb.read(4)
+		if err != nil {
+			return 0, false, err
+		}
+		return uint64(binary.BigEndian.Uint32(next)), false, nil
+	case buf[0] == RDB_64BITLEN:
+		next, err := rdb.read(8)
+		if err != nil {
+			return 0, false, err
+		}
+		return binary.BigEndian.Uint64(next), false, nil
+	}
+	return 0, false, fmt.Errorf("unknown length encoding %d", buf[0])
+}
+
+func (rdb *rdbReader) loadLen() (uint64, error) {
+	l, encoded, err := rdb.loadLenWithEncoding()
+	if err == nil && encoded {
+		err = fmt.Errorf("unexpected string encoding %d", l)
+	}
+	return l, err
+}
+
+func (rdb *rdbReader) loadString() (string, error) {
+	l, encoded, err := rdb.loadLenWithEncoding()
+	if err != nil {
+		return "", err
+	}
+	if !encoded {
+		buf, err := rdb.read(int(l))
+		if err != nil {
+			return "", err
+		}
+		return string(buf), nil
+	}
+	switch l {
+	case RDB_ENC_INT8, RDB_ENC_INT16, RDB_ENC_INT32:
+		buf, err := rdb.read(1 << l)
+		if err != nil {
+			return "", err
+		}
+		return strconv.FormatInt(leInt(buf), 10), nil
+	case RDB_ENC_LZF:
+		clen, err := rdb.loadLen()
+		if err != nil {
+			return "", err
+		}
+		ulen, err := rdb.loadLen()
+		if err != nil {
+			return "", err
+		}
+		buf, err := rdb.read(int(clen))
+		if err != nil {
+			return "", err
+		}
+		val, err := lzfDecompress(buf, int(ulen))
+		if err != nil {
+			return "", err
+		}
+		return string(val), nil
+	}
+	return "", fmt.Errorf("unknown string encoding %d", l)
+}
+
+// RDB_TYPE_ZSET中的score，长度253到255分别表示nan、inf和-inf
+func (rdb *rdbReader) loadDoubleValue() (float64, error) {
+	buf, err := rdb.read(1)
+	if err != nil {
+		return 0, err
+	}
+	switch buf[0] {
+	case 253:
+		return math.NaN(), nil
+	case 254:
+		return math.Inf(1), nil
+	case 255:
+		return math.Inf(-1), nil
+	}
+	if buf, err = rdb.read(int(buf[0])); err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(string(buf), 64)
+}
+
+func (rdb *rdbReader) loadStringObject() (*Gobj, error) {
+	s, err := rdb.loadString()
+	if err != nil {
+		return nil, err
+	}
+	return CreateObject(GSTR, s), nil
+}
+
+func (rdb *rdbReader) loadMillis() (int64, error) {
+	buf, err := rdb.read(8)
+	if err != nil {
+		return 0, err
+	}
+	return int64(binary.LittleEndian.Uint64(buf)), nil
+}
+
+func (rdb *rdbReader) loadBinaryDouble() (float64, error) {
+	buf, err := rdb.read(8)
+	if err != nil {
+		return 0, err
+	}
+	return math.Float64frombits(binary.LittleEndian.Uint64(buf)), nil
+}
+
+// 读取value，集合为空时返回nil
+func (rdb *rdbReader) loadObject(typ byte) (*Gobj, error) {
+	switch typ {
+	case RDB_TYPE_STRING:
+		return rdb.loadStringObject()
+	case RDB_TYPE_LIST_ZIPLIST, RDB_TYPE_SET_INTSET, RDB_TYPE_ZSET_ZIPLIST, RDB_TYPE_HASH_ZIPLIST,
+		RDB_TYPE_HASH_LISTPACK, RDB_TYPE_ZSET_LISTPACK, RDB_TYPE_SET_LISTPACK:
+		return rdb.loadEncodedObject(typ)
+	case RDB_TYPE_LIST_QUICKLIST, RDB_TYPE_LIST_QUICKLIST_2:
+		return rdb.loadQuicklist(typ)
+	}
+	l, err := rdb.loadLen()
+	if err != nil {
+		return nil, err
+	}
+	var o *Gobj
+	switch typ {
+	case RDB_TYPE_LIST:
+		o = createListObject()
+		list := o.Val_.(*GobjList)
+		for i := uint64(0); i < l; i++ {
+			ele, err := rdb.loadStringObject()
+			if err != nil {
+				return nil, err
+			}
+			list.Append(ele)
+		}
+	case RDB_TYPE_SET, RDB_TYPE_HASH:
+		if typ == RDB_TYPE_SET {
+			o = createSetObject()
+		} else {
+			o = createHashObject()
+		}
+		dict := o.Val_.(*GobjDict)
+		for i := uint64(0); i < l; i++ {
+			field, err := rdb.loadStringObject()
+			if err != nil {
+				return nil, err
+			}
+			var val *Gobj
+			if typ == RDB_TYPE_HASH {
+				if val, err = rdb.loadStringObject(); err != nil {
+					return nil, err
+				}
+			}
+			dict.Set(field, val)
+			field.DecrRefCount()
+			gobjDecrRef(val)
+		}
+	case RDB_TYPE_ZSET, RDB_TYPE_ZSET_2:
+		o = createZsetObject()
+		zs := o.Val_.(*ZSet)
+		for i := uint64(0); i < l; i++ {
+			member, err := rdb.loadStringObject()
+			if err != nil {
+				return nil, err
+			}
+			var score float64
+			if typ == RDB_TYPE_ZSET {
+				score, err = rdb.loadDoubleValue()
+			} else {
+				score, err = rdb.loadBinaryDouble()
+			}
+			if err != nil {
+				return nil, err
+			}
+			if math.IsNaN(score) {
+				return nil, errors.New("zset score is NaN")
+			}
+			zs.Add(score, member, 0)
+			member.DecrRefCount()
+		}
+	default:
+		return nil, fmt.Errorf("unknown object type %d", typ)
+	}
+	if l == 0 {
+		return nil, nil
+	}
+	return o, nil
+}
+
+// 紧凑编码的value整体保存为一个字符串
+func (rdb *rdbReader) loadEncodedObject(typ byte) (*Gobj, error) {
+	blob, err := rdb.loadString()
+	if err != nil {
+		return nil, err
+	}
+	var entries []string
+	switch typ {
+	case RDB_TYPE_SET_INTSET:
+		entries, err = intsetEntries([]byte(blob))
+	case RDB_TYPE_LIST_ZIPLIST, RDB_TYPE_ZSET_ZIPLIST, RDB_TYPE_HASH_ZIPLIST:
+		entries, err = ziplistEntries([]byte(blob))
+	default:
+		entries, err = listpackEntries([]byte(blob))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	switch typ {
+	case RDB_TYPE_LIST_ZIPLIST:
+		o := createListObject()
+		appendListEntries(o, entries)
+		return o, nil
+	case RDB_TYPE_SET_INTSET, RDB_TYPE_SET_LISTPACK:
+		o := createSetObject()
+		set := o.Val_.(*GobjDict)
+		for _, e := range entries {
+			member := CreateObject(GSTR, e)
+			set.Set(member, nil)
+			member.DecrRefCount()
+		}
+		return o, nil
+	}
+	// 哈希和有序集合中field和value交替保存
+	if len(entries)%2 != 0 {
+		return nil, errBadEncoding
+	}
+	if typ == RDB_TYPE_HASH_ZIPLIST || typ == RDB_TYPE_HASH_LISTPACK {
+		o := createHashObject()
+		hash := o.Val_.(*GobjDict)
+		for i := 0; i < len(entries); i += 2 {
+			field, val := CreateObject(GSTR, entries[i]), CreateObject(GSTR, entries[i+1])
+			hash.Set(field, val)
+			field.DecrRefCount()
+			val.DecrRefCount()
+		}
+		return o, nil
+	}
+	o := createZsetObject()
+	zs := o.Val_.(*ZSet)
+	for i := 0; i < len(entries); i += 2 {
+		score, err := strconv.ParseFloat(entries[i+1], 64)
+		if err != nil || math.IsNaN(score) {
+			return nil, errBadEncoding
+		}
+		member := CreateObject(GSTR, entries[i])
+		zs.Add(score, member, 0)
+		member.DecrRefCount()
+	}
+	return o, nil
+}
+
+func appendListEntries(o *Gobj, entries []string) {
+	list := o.Val_.(*GobjList)
+	for _, e := range entries {
+		list.Append(CreateObject(GSTR, e))
+	}
+}
+
+// quicklist由多个ziplist结点组成，quicklist 2的结点是listpack或者单个元素
+func (rdb *rdbReader) loadQuicklist(typ byte) (*Gobj, error) {
+	n, err := rdb.loadLen()
+	if err != nil {
+		return nil, err
+	}
+	o := createListObject()
+	for i := uint64(0); i < n; i++ {
+		container := uint64(QUICKLIST_NODE_CONTAINER_PACKED)
+		if typ == RDB_TYPE_LIST_QUICKLIST_2 {
+			if container, err = rdb.loadLen(); err != nil {
+				return nil, err
+			}
+		}
+		blob, err := rdb.loadString()
+		if err != nil {
+			return nil, err
+		}
+		var entries []string
+		switch {
+		case container == QUICKLIST_NODE_CONTAINER_PLAIN:
+			entries = []string{blob}
+		case container != QUICKLIST_NODE_CONTAINER_PACKED:
+			return nil, fmt.Errorf("unknown quicklist container %d", container)
+		case typ == RDB_TYPE_LIST_QUICKLIST:
+			entries, err = ziplistEntries([]byte(blob))
+		default:
+			entries, err = listpackEntries([]byte(blob))
+		}
+		if err != nil {
+			return nil, err
+		}
+		appendListEntries(o, entries)
+	}
+	if o.Val_.(*GobjList).Length() == 0 {
+		return nil, nil
+	}
+	return o, nil
+}
+
+// 加载RDB文件到server.dbs中，已经过期的key被丢弃
+func rdbLoad(filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	start := time.Now()
+	if err = rdbLoadFrom(f); err != nil {
+		return err
+	}
+	log.Printf("DB loaded from disk: %.3f seconds\n", time.Since(start).Seconds())
+	return nil
+}
+
+func rdbLoadFrom(r io.Reader) error {
+	rdb := &rdbReader{r: bufio.NewReader(r)}
+	magic, err := rdb.read(9)
+	if err != nil {
+		return err
+	}
+	if string(magic[:5]) != "REDIS" {
+		return errors.New("wrong signature trying to load DB from file")
+	}
+	ver, err := strconv.Atoi(string(magic[5:]))
+	if err != nil || ver < 1 || ver > RDB_MAX_LOAD_VERSION {
+		return fmt.Errorf("can't handle RDB format version %v", string(magic[5:]))
+	}
+	db := server.dbs[0]
+	now := GetMsTime()
+	var expire int64 = -1
+	for {
+		typ, err := rdb.loadType()
+		if err != nil {
+			return err
+		}
+		switch typ {
+		case RDB_OPCODE_EXPIRETIME_MS:
+			if expire, err = rdb.loadMillis(); err != nil {
+				return err
+			}
+			continue
+		case RDB_OPCODE_EXPIRETIME:
+			buf, err := rdb.read(4)
+			if err != nil {
+				return err
+			}
+			expire = int64(binary.LittleEndian.Uint32(buf)) * 1000
+			continue
+		case RDB_OPCODE_SELECTDB:
+			id, err := rdb.loadLen()
+			if err != nil {
+				return err
+			}
+			if id >= uint64(len(server.dbs)) {
+				return fmt.Errorf("data file was created with a server configured to handle more than %d databases", len(server.dbs))
+			}
+			db = server.dbs[id]
+			continue
+		case RDB_OPCODE_RESIZEDB:
+			if _, err = rdb.loadLen(); err == nil {
+				_, err = rdb.loadLen()
+			}
+			if err != nil {
+				return err
+			}
+			continue
+		case RDB_OPCODE_AUX:
+			if _, err = rdb.loadString(); err == nil {
+				_, err = rdb.loadString()
+			}
+			if err != nil {
+				return err
+			}
+			continue
+		case RDB_OPCODE_IDLE:
+			if _, err = rdb.loadLen(); err != nil {
+				return err
+			}
+			continue
+		case RDB_OPCODE_FREQ:
+			if _, err = rdb.read(1); err != nil {
+				return err
+			}
+			continue
+		case RDB_OPCODE_FUNCTION2:
+			// 不支持函数，跳过函数库的代码
+			if _, err = rdb.loadString(); err != nil {
+				return err
+			}
+			continue
+		case RDB_OPCODE_SLOT_INFO:
+			for i := 0; i < 3 && err == nil; i++ {
+				_, err = rdb.loadLen()
+			}
+			if err != nil {
+				return err
+			}
+			continue
+		case RDB_OPCODE_MODULE_AUX, RDB_OPCODE_FUNCTION_PRE_GA:
+			return fmt.Errorf("unsupported RDB opcode %d", typ)
+		}
+		if typ == RDB_OPCODE_EOF {
+			break
+		}
+		key, err := rdb.loadStringObject()
+		if err != nil {
+			return err
+		}
+		val, err := rdb.loadObject(typ)
+		if err != nil {
+			return err
+		}
+		// 空集合和已经过期的key不加载
+		if val != nil && (expire == -1 || expire > now) {
+			db.setKey(key, val)
+			if expire != -1 {
+				db.setExpire(key, expire)
+			}
+		}
+		key.DecrRefCount()
+		gobjDecrRef(val)
+		expire = -1
+	}
+	// 校验和为0表示保存时没有计算
+	if ver >= 5 {
+		expected := rdb.crc
+		buf, err := rdb.read(8)
+		if err != nil {
+			return err
+		}
+		if sum := binary.LittleEndian.Uint64(buf); sum != 0 && sum != expected {
+			return errors.New("wrong RDB checksum")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,417 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 创建测试用的server，rdb文件放在临时目录中
+func newRdbTestClient(t *testing.T) *GodisClient {
+	client := newTestClient()
+	server.rdbFilename = filepath.Join(t.TempDir(), DEFAULT_DBFILENAME)
+	return client
+}
+
+// 重新初始化server并加载rdb文件
+func reloadRdb(t *testing.T) *GodisClient {
+	filename := server.rdbFilename
+	client := newTestClient()
+	server.rdbFilename = filename
+	assert.Nil(t, rdbLoad(filename))
+	return client
+}
+
+func waitBgsave(t *testing.T) {
+	deadline := time.Now().Add(time.Second)
+	for server.rdbBgsaveDone != nil {
+		if time.Now().After(deadline) {
+			t.Fatal("bgsave timeout")
+		}
+		rdbCron()
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestRdbSaveLoad(t *testing.T) {
+	client := newRdbTestClient(t)
+	execCommand(client, "set str hello")
+	execCommand(client, "set bin a\x00b")
+	execCommand(client, "set ttl v px 100000")
+	execCommand(client, "rpush list a b c")
+	execCommand(client, "sadd set x y")
+	execCommand(client, "hset hash f1 v1 f2 v2")
+	execCommand(client, "zadd zset 1.5 a -2 b inf c")
+	execCommand(client, "select 5")
+	execCommand(client, "set other 1")
+	server.dbs[5].setExpire(CreateObject(GSTR, "other"), GetMsTime()+50)
+	execCommand(client, "set big "+strings.Repeat("x", 20000))
+
+	lastSave := server.lastSave
+	assert.Equal(t, shared.ok, execCommand(client, "save"))
+	assert.Equal(t, int64(0), server.dirty)
+	assert.True(t, server.lastSave >= lastSave)
+	assert.Equal(t, ":"+strconv.FormatInt(server.lastSave, 10)+"\r\n", execCommand(client, "lastsave"))
+	time.Sleep(60 * time.Millisecond)
+
+	client = reloadRdb(t)
+	assert.Equal(t, "$5\r\nhello\r\n", execCommand(client, "get str"))
+	assert.Equal(t, "$3\r\na\x00b\r\n", execCommand(client, "get bin"))
+	assert.Equal(t, ":100\r\n", execCommand(client, "ttl ttl"))
+	assert.Equal(t, "*3\r\n$1\r\na\r\n$1\r\nb\r\n$1\r\nc\r\n", execCommand(client, "lrange list 0 -1"))
+	assert.Equal(t, []string{"x", "y"}, parseBulkArray(execCommand(client, "smembers set")))
+	assert.Equal(t, []string{"f1", "f2", "v1", "v2"}, parseBulkArray(execCommand(client, "hgetall hash")))
+	assert.Equal(t, "*6\r\n$1\r\nb\r\n$2\r\n-2\r\n$1\r\na\r\n$3\r\n1.5\r\n$1\r\nc\r\n$3\r\ninf\r\n",
+		execCommand(client, "zrange zset 0 -1 withscores"))
+	assert.Equal(t, ":7\r\n", execCommand(client, "dbsize"))
+	execCommand(client, "select 5")
+	// 加载时丢弃已经过期的key
+	assert.Equal(t, ":1\r\n", execCommand(client, "dbsize"))
+	assert.Equal(t, ":20000\r\n", execCommand(client, "strlen big"))
+}
+
+func TestRdbCorrupted(t *testing.T) {
+	client := newRdbTestClient(t)
+	execCommand(client, "rpush list a b c")
+	execCommand(client, "save")
+	data, err := os.ReadFile(server.rdbFilename)
+	assert.Nil(t, err)
+	assert.Equal(t, "REDIS0009", string(data[:9]))
+
+	newTestClient()
+	// 修改一个字节后校验和不匹配
+	bad := append([]byte{}, data...)
+	bad[len(bad)-12] ^= 0xff
+	assert.NotNil(t, rdbLoadFrom(bytes.NewReader(bad)))
+	assert.NotNil(t, rdbLoadFrom(bytes.NewReader(data[:len(data)-3])))
+	assert.NotNil(t, rdbLoadFrom(bytes.NewReader([]byte("REDIS0099"))))
+	// 校验和为0时不检查
+	nocrc := append([]byte{}, data[:len(data)-8]...)
+	nocrc = append(nocrc, make([]byte, 8)...)
+	assert.Nil(t, rdbLoadFrom(bytes.NewReader(nocrc)))
+
+	_, err = os.Stat(filepath.Join(filepath.Dir(server.rdbFilename), "temp-"+strconv.Itoa(os.Getpid())+".rdb"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestBgsave(t *testing.T) {
+	client := newRdbTestClient(t)
+	for i := 0; i < 100; i++ {
+		execCommand(client, "sadd set m"+strconv.Itoa(i))
+	}
+	execCommand(client, "rpush list a")
+	execCommand(client, "set str v")
+	assert.Equal(t, "+Background saving started\r\n", execCommand(client, "bgsave"))
+	assert.Equal(t, "-ERR Background save already in progress\r\n", execCommand(client, "bgsave"))
+	assert.Equal(t, "-ERR Background save already in progress\r\n", execCommand(client, "save"))
+
+	// 快照持有的集合在写入前被复制
+	old := server.dbs[0].data.Get(CreateObject(GSTR, "set"))
+	execCommand(client, "sadd set new")
+	cur := server.dbs[0].data.Get(CreateObject(GSTR, "set"))
+	assert.NotSame(t, old, cur)
+	assert.Equal(t, int64(100), old.Val_.(*GobjDict).Size())
+	assert.Equal(t, ":101\r\n", execCommand(client, "scard set"))
+	execCommand(client, "rpush list b")
+	execCommand(client, "set str v2")
+	execCommand(client, "del set")
+	assert.Contains(t, execCommand(client, "info persistence"), "rdb_bgsave_in_progress:1\r\n")
+
+	waitBgsave(t)
+	assert.True(t, server.lastBgsaveOK)
+	// 只剩下BGSAVE开始后的修改
+	assert.Equal(t, int64(4), server.dirty)
+	waitLazyfree(t)
+	assert.Nil(t, old.Val_)
+
+	client = reloadRdb(t)
+	assert.Equal(t, ":100\r\n", execCommand(client, "scard set"))
+	assert.Equal(t, ":1\r\n", execCommand(client, "llen list"))
+	assert.Equal(t, "$1\r\nv\r\n", execCommand(client, "get str"))
+}
+
+func TestSaveParams(t *testing.T) {
+	params, err := parseSaveParams(DEFAULT_SAVE)
+	assert.Nil(t, err)
+	assert.Equal(t, []saveParam{{3600, 1}, {300, 100}, {60, 10000}}, params)
+	params, err = parseSaveParams("")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(params))
+	_, err = parseSaveParams("60")
+	assert.NotNil(t, err)
+	_, err = parseSaveParams("0 1")
+	assert.NotNil(t, err)
+
+	client := newRdbTestClient(t)
+	server.saveParams = []saveParam{{10, 2}}
+	dirty := server.dirty
+	execCommand(client, "set a 1")
+	execCommand(client, "get a")
+	execCommand(client, "rpush a x")
+	execCommand(client, "incr none x")
+	assert.Equal(t, dirty+1, server.dirty)
+	execCommand(client, "set b 1")
+	server.lastSave = time.Now().Unix() - 5
+	rdbCron()
+	assert.Nil(t, server.rdbBgsaveDone)
+	server.lastSave = time.Now().Unix() - 11
+	rdbCron()
+	assert.NotNil(t, server.rdbBgsaveDone)
+	waitBgsave(t)
+	_, err = os.Stat(server.rdbFilename)
+	assert.Nil(t, err)
+}
+
+// rdb_v*.rdb由gen_fixtures.py构造，不是redis-server保存的，只用来覆盖各种编码的解码
+func loadFixture(t *testing.T, name string) *GodisClient {
+	client := newTestClient()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	assert.Nil(t, err)
+	assert.Nil(t, rdbLoadFrom(bytes.NewReader(data)))
+	return client
+}
+
+func TestRdbV11Fixture(t *testing.T) {
+	client := loadFixture(t, "rdb_v11_encodings.rdb")
+	assert.Equal(t, ":13\r\n", execCommand(client, "dbsize"))
+	assert.Equal(t, "$5\r\nhello\r\n", execCommand(client, "get str"))
+	assert.Equal(t, ":4102444800000\r\n", execCommand(client, "pexpiretime str"))
+	assert.Equal(t, "$5\r\n12345\r\n", execCommand(client, "get num"))
+	assert.Equal(t, "$2\r\n-1\r\n", execCommand(client, "get neg"))
+	assert.Equal(t, "$6\r\n100000\r\n", execCommand(client, "get int32"))
+	assert.Equal(t, "$100\r\n"+strings.Repeat("a", 100)+"\r\n", execCommand(client, "get lzf"))
+	assert.Equal(t, ":0\r\n", execCommand(client, "exists expired"))
+	assert.Equal(t, "*4\r\n$5\r\nhello\r\n$4\r\n1024\r\n$2\r\n-5\r\n$13\r\nplain-element\r\n",
+		execCommand(client, "lrange list 0 -1"))
+	reply := execCommand(client, "lrange lpints 0 -1")
+	assert.True(t, strings.HasPrefix(reply, "*7\r\n$5\r\n30000\r\n$8\r\n-1000000\r\n$9\r\n100000000\r\n$11\r\n10000000000\r\n$100\r\n"))
+	assert.True(t, strings.HasSuffix(reply, "\r\n$5\r\n-4096\r\n$3\r\n127\r\n"))
+	assert.Equal(t, []string{"2", "f1", "f2", "v1"}, parseBulkArray(execCommand(client, "hgetall hash")))
+	assert.Equal(t, []string{"-3", "1", "2"}, parseBulkArray(execCommand(client, "smembers intset")))
+	assert.Equal(t, []string{"-1099511627776", "1099511627776"}, parseBulkArray(execCommand(client, "smembers intset64")))
+	assert.Equal(t, []string{"a", "b"}, parseBulkArray(execCommand(client, "smembers lpset")))
+	assert.Equal(t, "*4\r\n$1\r\na\r\n$1\r\n1\r\n$1\r\nb\r\n$3\r\n2.5\r\n", execCommand(client, "zrange zset 0 -1 withscores"))
+	assert.Equal(t, "*4\r\n$1\r\ny\r\n$4\r\n-1.5\r\n$1\r\nx\r\n$1\r\n3\r\n", execCommand(client, "zrange zset2 0 -1 withscores"))
+	execCommand(client, "select 2")
+	assert.Equal(t, "$1\r\nv\r\n", execCommand(client, "get db2key"))
+}
+
+func TestRdbV9Fixture(t *testing.T) {
+	client := loadFixture(t, "rdb_v9_ziplist.rdb")
+	assert.Equal(t, ":8\r\n", execCommand(client, "dbsize"))
+	assert.Equal(t, ":4102444800\r\n", execCommand(client, "expiretime sec"))
+	reply := execCommand(client, "lrange list 0 -1")
+	assert.True(t, strings.HasPrefix(reply, "*9\r\n$1\r\na\r\n$3\r\n100\r\n$3\r\nxyz\r\n$6\r\n-20000\r\n$300\r\n"))
+	assert.True(t, strings.HasSuffix(reply, "\r\n$1\r\n7\r\n$7\r\n1048576\r\n$10\r\n1073741824\r\n$13\r\n1099511627776\r\n"))
+	assert.Equal(t, []string{"7", "f", "g", "hello"}, parseBulkArray(execCommand(client, "hgetall hash")))
+	assert.Equal(t, "*4\r\n$2\r\nm1\r\n$1\r\n1\r\n$2\r\nm2\r\n$3\r\n2.5\r\n", execCommand(client, "zrange zset 0 -1 withscores"))
+	assert.Equal(t, "*4\r\n$1\r\nz\r\n$3\r\n3.5\r\n$1\r\ni\r\n$3\r\ninf\r\n", execCommand(client, "zrange oldzset 0 -1 withscores"))
+	assert.Equal(t, "*2\r\n$1\r\np\r\n$1\r\nq\r\n", execCommand(client, "lrange oldlist 0 -1"))
+	assert.Equal(t, []string{"x", "y"}, parseBulkArray(execCommand(client, "smembers set")))
+	assert.Equal(t, "$1\r\nv\r\n", execCommand(client, "hget plainhash k"))
+}
+
+// testdata/redis<主版本号>.rdb由redis_fixtures.sh用真实的redis-server保存，文件不存在时跳过
+// 缺少真实redis的文件或工具时跳过，设置了GODIS_REDIS_TESTS(CI中)时直接失败
+func skipWithoutRedis(t *testing.T, format string, args ...any) {
+	t.Helper()
+	if os.Getenv("GODIS_REDIS_TESTS") != "" {
+		t.Fatalf(format, args...)
+	}
+	t.Skipf(format, args...)
+}
+
+func TestRdbRedisDump(t *testing.T) {
+	for _, f := range []struct{ name, magic string }{
+		{"redis5.rdb", "REDIS0009"},
+		{"redis7.rdb", "REDIS001"}, // 7.0为v10，7.2为v11
+	} {
+		t.Run(f.name, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("testdata", f.name))
+			if os.IsNotExist(err) {
+				skipWithoutRedis(t, "testdata/%v not found, run testdata/redis_fixtures.sh", f.name)
+			}
+			assert.True(t, bytes.HasPrefix(data, []byte(f.magic)))
+			client := newTestClient()
+			assert.Nil(t, rdbLoadFrom(bytes.NewReader(data)))
+			assert.Equal(t, ":16\r\n", execCommand(client, "dbsize"))
+			assert.Equal(t, "$5\r\nhello\r\n", execCommand(client, "get str"))
+			assert.Equal(t, "$5\r\n12345\r\n", execCommand(client, "get num"))
+			assert.Equal(t, "$2\r\n-1\r\n", execCommand(client, "get neg"))
+			assert.Equal(t, "$6\r\n100000\r\n", execCommand(client, "get int32"))
+			assert.Equal(t, "$100\r\n"+strings.Repeat("a", 100)+"\r\n", execCommand(client, "get lzf"))
+			assert.Equal(t, ":4102444800000\r\n", execCommand(client, "pexpiretime ttl"))
+			assert.Equal(t, "*4\r\n$5\r\nhello\r\n$4\r\n1024\r\n$2\r\n-5\r\n$11\r\n10000000000\r\n",
+				execCommand(client, "lrange list 0 -1"))
+			assert.Equal(t, ":600\r\n", execCommand(client, "llen biglist"))
+			assert.Equal(t, "$28\r\nelement-00000000000000000000\r\n", execCommand(client, "lindex biglist 0"))
+			assert.Equal(t, "$28\r\nelement-00000000000000000599\r\n", execCommand(client, "lindex biglist -1"))
+			assert.Equal(t, []string{"2", "f1", "f2", "v1"}, parseBulkArray(execCommand(client, "hgetall hash")))
+			assert.Equal(t, ":200\r\n", execCommand(client, "hlen bighash"))
+			assert.Equal(t, "$8\r\nvalue123\r\n", execCommand(client, "hget bighash field123"))
+			assert.Equal(t, []string{"-3", "1", "2"}, parseBulkArray(execCommand(client, "smembers intset")))
+			assert.Equal(t, []string{"-1099511627776", "1099511627776"}, parseBulkArray(execCommand(client, "smembers intset64")))
+			assert.Equal(t, []string{"a", "b"}, parseBulkArray(execCommand(client, "smembers set")))
+			assert.Equal(t, ":200\r\n", execCommand(client, "scard bigset"))
+			assert.Equal(t, ":1\r\n", execCommand(client, "sismember bigset member77"))
+			assert.Equal(t, "*6\r\n$1\r\nc\r\n$4\r\n-1.5\r\n$1\r\na\r\n$1\r\n1\r\n$1\r\nb\r\n$3\r\n2.5\r\n",
+				execCommand(client, "zrange zset 0 -1 withscores"))
+			assert.Equal(t, ":200\r\n", execCommand(client, "zcard bigzset"))
+			assert.Equal(t, "$3\r\n150\r\n", execCommand(client, "zscore bigzset member150"))
+			execCommand(client, "select 2")
+			assert.Equal(t, "$1\r\nv\r\n", execCommand(client, "get db2key"))
+		})
+	}
+}
+
+// 用redis自带的redis-check-rdb校验godis保存的文件，没有安装redis时跳过
+func TestRdbCheckedByRedis(t *testing.T) {
+	checker, err := exec.LookPath("redis-check-rdb")
+	if err != nil {
+		skipWithoutRedis(t, "redis-check-rdb not found in PATH")
+	}
+	client := newRdbTestClient(t)
+	execCommand(client, "set str hello")
+	execCommand(client, "set num 12345")
+	execCommand(client, "set lzf "+strings.Repeat("a", 100))
+	execCommand(client, "set ttl v px 100000")
+	execCommand(client, "rpush list a b c")
+	execCommand(client, "sadd set x y")
+	execCommand(client, "hset hash f1 v1 f2 v2")
+	execCommand(client, "zadd zset 1.5 a -2 b inf c")
+	execCommand(client, "select 5")
+	execCommand(client, "set other 1")
+	assert.Equal(t, shared.ok, execCommand(client, "save"))
+	out, err := exec.Command(checker, server.rdbFilename).CombinedOutput()
+	assert.Nil(t, err, string(out))
+	assert.Contains(t, string(out), "RDB looks OK")
+}
+
+func TestRdbStringEncoding(t *testing.T) {
+	client := newRdbTestClient(t)
+	execCommand(client, "set num 12345")
+	execCommand(client, "set neg -1")
+	execCommand(client, "set int32 100000")
+	// 不是规范表示或超出32位的整数按字符串保存
+	execCommand(client, "set lead 012")
+	execCommand(client, "set int64 10000000000")
+	execCommand(client, "set lzf "+strings.Repeat("a", 100))
+	execCommand(client, "zadd z 1 a 2 b")
+	execCommand(client, "save")
+	data, err := os.ReadFile(server.rdbFilename)
+	assert.Nil(t, err)
+	for _, enc := range []string{
+		"\xfa\x0aredis-bits\xc0\x40",
+		"\x00\x03num\xc1\x39\x30",
+		"\x00\x03neg\xc0\xff",
+		"\x00\x05int32\xc2\xa0\x86\x01\x00",
+		"\x00\x04lead\x03012",
+		"\x00\x05int64\x0b10000000000",
+		"\x00\x03lzf\xc3\x09\x40\x64\x01aa\xe0\x57\x00\x01aa",
+		"\x05\x01z\x02\x01b" + "\x00\x00\x00\x00\x00\x00\x00\x40" + "\x01a",
+	} {
+		assert.Contains(t, string(data), enc)
+	}
+
+	client = reloadRdb(t)
+	assert.Equal(t, "$3\r\n012\r\n", execCommand(client, "get lead"))
+	assert.Equal(t, "$2\r\n-1\r\n", execCommand(client, "get neg"))
+	assert.Equal(t, ":100\r\n", execCommand(client, "strlen lzf"))
+}
+
+func TestRdbFixtureBlobs(t *testing.T) {
+	// fixture中长度超过20的字符串都按原始字符串保存，检查它们确实无法被LZF压缩
+	for _, name := range []string{"rdb_v11_encodings.rdb", "rdb_v9_ziplist.rdb"} {
+		data, err := os.ReadFile(filepath.Join("testdata", name))
+		assert.Nil(t, err)
+		rdb := &rdbReader{r: bufio.NewReader(bytes.NewReader(data[9:]))}
+		for {
+			typ, err := rdb.loadType()
+			assert.Nil(t, err)
+			if typ == RDB_OPCODE_EOF {
+				break
+			}
+			switch typ {
+			case RDB_OPCODE_AUX:
+				rdb.loadString()
+				rdb.loadString()
+				continue
+			case RDB_OPCODE_SELECTDB:
+				rdb.loadLen()
+				continue
+			case RDB_OPCODE_RESIZEDB:
+				rdb.loadLen()
+				rdb.loadLen()
+				continue
+			case RDB_OPCODE_EXPIRETIME_MS:
+				rdb.read(8)
+				continue
+			case RDB_OPCODE_EXPIRETIME:
+				rdb.read(4)
+				continue
+			}
+			rdb.loadString()
+			var blobs []string
+			switch typ {
+			case RDB_TYPE_LIST_QUICKLIST, RDB_TYPE_LIST_QUICKLIST_2:
+				n, _ := rdb.loadLen()
+				for i := uint64(0); i < n; i++ {
+					if typ == RDB_TYPE_LIST_QUICKLIST_2 {
+						rdb.loadLen()
+					}
+					blob, _ := rdb.loadString()
+					blobs = append(blobs, blob)
+				}
+			case RDB_TYPE_STRING, RDB_TYPE_LIST_ZIPLIST, RDB_TYPE_SET_INTSET, RDB_TYPE_ZSET_ZIPLIST,
+				RDB_TYPE_HASH_ZIPLIST, RDB_TYPE_HASH_LISTPACK, RDB_TYPE_ZSET_LISTPACK, RDB_TYPE_SET_LISTPACK:
+				blob, _ := rdb.loadString()
+				blobs = append(blobs, blob)
+			default:
+				o, err := rdb.loadObject(typ)
+				assert.Nil(t, err)
+				assert.NotNil(t, o)
+			}
+			for _, blob := range blobs {
+				if len(blob) > 20 && blob != strings.Repeat("a", 100) {
+					assert.Nil(t, lzfCompress([]byte(blob), len(blob)-4))
+				}
+			}
+		}
+	}
+}
+
+func TestRdbBadEncoding(t *testing.T) {
+	lp := []byte("\x14\x00\x00\x00\x03\x00\x85hello\x06\xc4\x00\x02\xdf\xfb\x02\xff")
+	entries, err := listpackEntries(lp)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"hello", "1024", "-5"}, entries)
+	zl := []byte("\x1a\x00\x00\x00\x15\x00\x00\x00\x04\x00\x00\x01a\x03\xfe\x64\x03\x03xyz\x05\xc0\xe0\xb1\xff")
+	entries, err = ziplistEntries(zl)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "100", "xyz", "-20000"}, entries)
+	// 截断或长度不符时返回错误而不是panic
+	for i := 0; i < len(lp); i++ {
+		_, err = listpackEntries(lp[:i])
+		assert.NotNil(t, err)
+	}
+	for i := 0; i < len(zl); i++ {
+		_, err = ziplistEntries(zl[:i])
+		assert.NotNil(t, err)
+	}
+	bad := append([]byte{}, lp...)
+	bad[6] = 0xbf
+	_, err = listpackEntries(bad)
+	assert.NotNil(t, err)
+	_, err = intsetEntries([]byte("\x03\x00\x00\x00\x01\x00\x00\x00\x01\x00\x00"))
+	assert.NotNil(t, err)
+	_, err = intsetEntries([]byte("\x02\x00\x00\x00\x02\x00\x00\x00\x01\x00"))
+	assert.NotNil(t, err)
+}
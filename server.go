@@ -1,16 +1,65 @@
 package main
 
+import (
+	"os"
+	"time"
+)
+
 type GodisServer struct {
 	fd      int
 	port    int
-	db      *GodisDB
-	clients map[int]*GodisClient
-	aeLoop  *AeLoop
+	dbs     []*GodisDB
+	clients *Dict[int, *GodisClient]
+	// 命令名到命令的映射，不区分大小写
+	commands  *Dict[string, *GodisCommand]
+	aeLoop    *AeLoop
+	startTime time.Time
+	// activeExpireCycle下次开始处理的db
+	expireCycleDb int
+	// 统计信息
+	statExpiredKeys      int64
+	statExpiredStalePerc float64
+	statExpireCycleTime  time.Duration
+	// RDB持久化
+	rdbFilename       string
+	saveParams        []saveParam
+	dirty             int64 // 上次保存后的修改次数
+	dirtyBeforeBgsave int64
+	lastSave          int64 // 上次保存成功的时间，单位秒
+	lastBgsaveTry     int64
+	lastBgsaveOK      bool
+	rdbSnapshot       [][]rdbEntry
+	rdbBgsaveDone     chan error // 不为nil时表示BGSAVE正在进行
+	// AOF持久化
+	aofEnabled        bool
+	aofFilename       string // base和incr文件名的前缀
+	aofDirname        string
+	aofManifest       *aofManifest
+	aofUseRdbPreamble bool
+	aofFsync          int
+	aofLoadTruncated  bool
+	aofFile           *os.File
+	aofBuf            []byte // 等待写入文件的命令
+	aofSelectedDB     int    // 文件中最后一条SELECT选择的db
+	aofLastFsync      time.Time
+	aofUnsynced       bool // 有写入的数据还没有fsync
+	aofLastWriteOK    bool
+	aofCurrentSize    int64
+	// AOF重写
+	aofRewritePerc     int   // 文件比上次重写后增长的百分比超过该值时自动重写，为0时关闭
+	aofRewriteMinSize  int64 // 文件小于该大小时不自动重写
+	aofRewriteBaseSize int64 // 上次重写或启动时的文件大小
+	aofRewriteSnapshot [][]rdbEntry
+	aofRewriteDone     chan error // 不为nil时表示重写正在进行
+	aofRewriteRdb      bool       // 正在写入的base是否为RDB格式
+	aofLastBgrewriteOK bool
+	loading            bool // 正在加载数据，不写入AOF，也不删除过期的key
 }
 
 type GodisDB struct {
-	data   *Dict
-	expire *Dict
+	id     int
+	data   *GobjDict
+	expire *GobjDict
 }
 
 // 全局变量
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"math/bits"
+)
+
+// 进程启动时随机生成的哈希种子，防止客户端构造大量冲突的key
+var hashSeed [2]uint64
+
+func init() {
+	var buf [16]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		panic(err)
+	}
+	SetHashSeed(buf)
+}
+
+func SetHashSeed(seed [16]byte) {
+	hashSeed[0] = binary.LittleEndian.Uint64(seed[:8])
+	hashSeed[1] = binary.LittleEndian.Uint64(seed[8:])
+}
+
+// 输入可以是string或[]byte，string不需要先转换为[]byte，避免每次哈希都拷贝一次
+type sipInput interface {
+	string | []byte
+}
+
+// 与redis一致使用SipHash-1-3，比2-4更快，对哈希表来说强度足够
+func siphash[T sipInput](in T) uint64 {
+	return sipHash13(hashSeed[0], hashSeed[1], in, false)
+}
+
+// 忽略ASCII大小写的版本，用于命令名之类的查找
+func siphashNocase[T sipInput](in T) uint64 {
+	return sipHash13(hashSeed[0], hashSeed[1], in, true)
+}
+
+// 按小端序读取in[i:i+8]
+func load64[T sipInput](in T, i int) uint64 {
+	_ = in[i+7]
+	return uint64(in[i]) | uint64(in[i+1])<<8 | uint64(in[i+2])<<16 | uint64(in[i+3])<<24 |
+		uint64(in[i+4])<<32 | uint64(in[i+5])<<40 | uint64(in[i+6])<<48 | uint64(in[i+7])<<56
+}
+
+// 将8个字节中的大写ASCII字母同时转换为小写
+func lowerWord(m uint64) uint64 {
+	heptets := m & 0x7f7f7f7f7f7f7f7f
+	ge := heptets + 0x3f3f3f3f3f3f3f3f // 字节不小于'A'时最高位为1
+	gt := heptets + 0x2525252525252525 // 字节大于'Z'时最高位为1
+	upper := ge &^ gt &^ m & 0x8080808080808080
+	return m | upper>>2
+}
+
+func sipRound(v0, v1, v2, v3 uint64) (uint64, uint64, uint64, uint64) {
+	v0 += v1
+	v1 = bits.RotateLeft64(v1, 13)
+	v1 ^= v0
+	v0 = bits.RotateLeft64(v0, 32)
+	v2 += v3
+	v3 = bits.RotateLeft64(v3, 16)
+	v3 ^= v2
+	v0 += v3
+	v3 = bits.RotateLeft64(v3, 21)
+	v3 ^= v0
+	v2 += v1
+	v1 = bits.RotateLeft64(v1, 17)
+	v1 ^= v2
+	v2 = bits.RotateLeft64(v2, 32)
+	return v0, v1, v2, v3
+}
+
+// 固定为1轮压缩、3轮结束的SipHash，展开轮数循环，哈希是Dict查找的关键路径
+func sipHash13[T sipInput](k0, k1 uint64, in T, nocase bool) uint64 {
+	v0 := k0 ^ 0x736f6d6570736575
+	v1 := k1 ^ 0x646f72616e646f6d
+	v2 := k0 ^ 0x6c7967656e657261
+	v3 := k1 ^ 0x7465646279746573
+	n := len(in) &^ 7
+	for i := 0; i < n; i += 8 {
+		m := load64(in, i)
+		if nocase {
+			m = lowerWord(m)
+		}
+		v3 ^= m
+		v0, v1, v2, v3 = sipRound(v0, v1, v2, v3)
+		v0 ^= m
+	}
+	// 最后不足8字节的部分，最高字节为长度
+	b := uint64(len(in)) << 56
+	for i := len(in) - 1; i >= n; i-- {
+		c := in[i]
+		if nocase {
+			c = toLower(c)
+		}
+		b |= uint64(c) << (8 * uint(i-n))
+	}
+	v3 ^= b
+	v0, v1, v2, v3 = sipRound(v0, v1, v2, v3)
+	v0 ^= b
+	v2 ^= 0xff
+	v0, v1, v2, v3 = sipRound(v0, v1, v2, v3)
+	v0, v1, v2, v3 = sipRound(v0, v1, v2, v3)
+	v0, v1, v2, v3 = sipRound(v0, v1, v2, v3)
+	return v0 ^ v1 ^ v2 ^ v3
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"math/rand"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSipHash(t *testing.T) {
+	// SipHash-2-4论文中的测试向量，key为00..0f
+	var key [16]byte
+	for i := range key {
+		key[i] = byte(i)
+	}
+	k0 := binary.LittleEndian.Uint64(key[:8])
+	k1 := binary.LittleEndian.Uint64(key[8:])
+	in := make([]byte, 15)
+	for i := range in {
+		in[i] = byte(i)
+	}
+	assert.Equal(t, uint64(0x726fdb47dd0e0e31), sipHashRef(2, 4, k0, k1, []byte(nil), false))
+	assert.Equal(t, uint64(0xa129ca6149be45e5), sipHashRef(2, 4, k0, k1, in, false))
+	assert.Equal(t, uint64(0xa129ca6149be45e5), sipHashRef(2, 4, k0, k1, string(in), false))
+
+	// 各种长度下与参考实现一致，string与[]byte结果相同
+	long := []byte("The Quick Brown Fox Jumps Over The Lazy Dog, 0123456789")
+	for l := 0; l <= len(long); l++ {
+		assert.Equal(t, sipHashRef(1, 3, k0, k1, long[:l], false), sipHash13(k0, k1, long[:l], false))
+		assert.Equal(t, sipHashRef(1, 3, k0, k1, long[:l], true), sipHash13(k0, k1, long[:l], true))
+		assert.Equal(t, sipHash13(k0, k1, long[:l], true), sipHash13(k0, k1, string(long[:l]), true))
+	}
+
+	assert.Equal(t, siphash([]byte("Hello World")), siphash([]byte("Hello World")))
+	assert.NotEqual(t, siphash([]byte("Hello World")), siphash([]byte("hello world")))
+	assert.Equal(t, siphashNocase([]byte("Hello World")), siphashNocase([]byte("hello world")))
+	assert.Equal(t, siphash([]byte("hello world")), siphashNocase([]byte("HELLO WORLD")))
+	all := make([]byte, 256)
+	for i := range all {
+		all[i] = byte(i)
+	}
+	lower := make([]byte, 256)
+	for i := range lower {
+		lower[i] = toLower(all[i])
+	}
+	assert.Equal(t, siphash(lower), siphashNocase(all))
+
+	// 不同的种子得到不同的哈希值
+	old := hashSeed
+	h := siphash([]byte("key"))
+	SetHashSeed(key)
+	assert.NotEqual(t, h, siphash([]byte("key")))
+	hashSeed = old
+	assert.Equal(t, h, siphash([]byte("key")))
+
+	a, b := CreateObject(GSTR, "GET"), CreateObject(GSTR, "get")
+	assert.NotEqual(t, GStrHash(a), GStrHash(b))
+	assert.Equal(t, GStrCaseHash(a), GStrCaseHash(b))
+	assert.True(t, GStrCaseEqual(a, b))
+	assert.False(t, GStrEqual(a, b))
+}
+
+var benchKeys = []string{"k", "user:1000", "session:0123456789abcdef", "a-longer-key-that-spans-several-siphash-blocks:42"}
+
+func BenchmarkGStrHashSipHash(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		for _, k := range benchKeys {
+			GStrHash(&Gobj{Type_: GSTR, Val_: k})
+		}
+	}
+}
+
+func BenchmarkGStrHashFNV(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		for _, k := range benchKeys {
+			fnvHash(&Gobj{Type_: GSTR, Val_: k})
+		}
+	}
+}
+
+func fnvHash(key *Gobj) int64 {
+	hash := fnv.New64()
+	hash.Write([]byte(key.StrVal()))
+	return int64(hash.Sum64())
+}
+
+// 哈希值均匀时，按元素统计的平均查找长度为1+负载因子
+func TestSipHashSpread(t *testing.T) {
+	for _, hashFunc := range []func(key *Gobj) int64{GStrHash, fnvHash} {
+		dict := DictCreate(DictType[*Gobj, *Gobj]{HashFunc: hashFunc, EqualFunc: GStrEqual})
+		for i := 0; i < 100000; i++ {
+			dict.Add(CreateObject(GSTR, "key:"+strconv.Itoa(i)), nil)
+		}
+		for dict.isRehashing() {
+			dict.rehashStep()
+		}
+		ht := dict.hts[0]
+		var probes int64
+		for _, e := range ht.table {
+			var l int64
+			for ; e != nil; e = e.next {
+				l++
+			}
+			probes += l * (l + 1) / 2
+		}
+		load := float64(ht.used) / float64(ht.size)
+		assert.InDelta(t, 1+load/2, float64(probes)/float64(ht.used), 0.05*(1+load/2))
+	}
+}
+
+// 查找顺序与插入顺序无关，避免连续的key在FNV下落在相邻的桶中而得到更好的缓存局部性
+func benchmarkDictFind(b *testing.B, hashFunc func(key *Gobj) int64, n int) {
+	dict := DictCreate(DictType[*Gobj, *Gobj]{HashFunc: hashFunc, EqualFunc: GStrEqual})
+	keys := make([]*Gobj, n)
+	for i := range keys {
+		keys[i] = CreateObject(GSTR, "key:"+strconv.Itoa(i))
+		dict.Add(keys[i], nil)
+	}
+	for dict.isRehashing() {
+		dict.rehashStep()
+	}
+	rand.New(rand.NewSource(1)).Shuffle(n, func(i, j int) {
+		keys[i], keys[j] = keys[j], keys[i]
+	})
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		dict.Find(keys[i%n])
+	}
+}
+
+func BenchmarkDictFindSipHash(b *testing.B) {
+	for _, n := range []int{10000, 1000000} {
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			benchmarkDictFind(b, GStrHash, n)
+		})
+	}
+}
+
+func BenchmarkDictFindFNV(b *testing.B) {
+	for _, n := range []int{10000, 1000000} {
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			benchmarkDictFind(b, fnvHash, n)
+		})
+	}
+}
+
+// 轮数可变的参考实现，用论文中SipHash-2-4的测试向量校验，再与sipHash13比较
+// cRounds和dRounds分别为压缩和结束阶段的轮数
+func sipHashRef[T sipInput](cRounds, dRounds int, k0, k1 uint64, in T, nocase bool) uint64 {
+	v0 := k0 ^ 0x736f6d6570736575
+	v1 := k1 ^ 0x646f72616e646f6d
+	v2 := k0 ^ 0x6c7967656e657261
+	v3 := k1 ^ 0x7465646279746573
+	n := len(in) &^ 7
+	for i := 0; i < n; i += 8 {
+		m := load64(in, i)
+		if nocase {
+			m = lowerWord(m)
+		}
+		v3 ^= m
+		for r := 0; r < cRounds; r++ {
+			v0, v1, v2, v3 = sipRound(v0, v1, v2, v3)
+		}
+		v0 ^= m
+	}
+	// 最后不足8字节的部分，最高字节为长度
+	b := uint64(len(in)) << 56
+	for i := len(in) - 1; i >= n; i-- {
+		c := in[i]
+		if nocase {
+			c = toLower(c)
+		}
+		b |= uint64(c) << (8 * uint(i-n))
+	}
+	v3 ^= b
+	for r := 0; r < cRounds; r++ {
+		v0, v1, v2, v3 = sipRound(v0, v1, v2, v3)
+	}
+	v0 ^= b
+	v2 ^= 0xff
+	for r := 0; r < dRounds; r++ {
+		v0, v1, v2, v3 = sipRound(v0, v1, v2, v3)
+	}
+	return v0 ^ v1 ^ v2 ^ v3
+}
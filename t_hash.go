@@ -0,0 +1,307 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// 哈希类型的命令实现，value为GDICT类型的Gobj，内部是field->value的*GobjDict
+
+func createHashObject() *Gobj {
+	return CreateObject(GDICT, GobjDictCreate())
+}
+
+// 查找哈希用于写入，key不存在时创建
+func hashLookupWriteOrCreate(c *GodisClient, key *Gobj) *GobjDict {
+	hobj := c.db.findKeyWrite(key)
+	if hobj == nil {
+		hobj = createHashObject()
+		c.db.data.Set(key, hobj)
+		hobj.DecrRefCount()
+	} else if !checkType(c, hobj, GDICT) {
+		return nil
+	}
+	return hobj.Val_.(*GobjDict)
+}
+
+// 查找哈希用于读取，key不存在时回复empty
+func findHashOrReply(c *GodisClient, key *Gobj, empty string) *GobjDict {
+	hobj := c.db.findKeyRead(key)
+	if hobj == nil {
+		c.AddReplyStr(empty)
+		return nil
+	}
+	if !checkType(c, hobj, GDICT) {
+		return nil
+	}
+	return hobj.Val_.(*GobjDict)
+}
+
+func hsetCommand(c *GodisClient) {
+	if len(c.args)%2 != 0 {
+		c.AddReplyError("wrong number of arguments for 'hset' command")
+		return
+	}
+	hash := hashLookupWriteOrCreate(c, c.args[1])
+	if hash == nil {
+		return
+	}
+	var created int64
+	for i := 2; i < len(c.args); i += 2 {
+		if hash.Add(c.args[i], c.args[i+1]) == nil {
+			created++
+		} else {
+			hash.Set(c.args[i], c.args[i+1])
+		}
+	}
+	server.dirty += int64(len(c.args)-2) / 2
+	c.AddReplyInt(created)
+}
+
+func hsetnxCommand(c *GodisClient) {
+	hash := hashLookupWriteOrCreate(c, c.args[1])
+	if hash == nil {
+		return
+	}
+	if hash.Add(c.args[2], c.args[3]) == nil {
+		server.dirty++
+		c.AddReplyStr(shared.cone)
+	} else {
+		c.AddReplyStr(shared.czero)
+	}
+}
+
+func hgetCommand(c *GodisClient) {
+	hash := findHashOrReply(c, c.args[1], shared.nullBulk)
+	if hash == nil {
+		return
+	}
+	val := hash.Get(c.args[2])
+	if val == nil {
+		c.AddReplyStr(shared.nullBulk)
+	} else {
+		c.AddReplyBulk(val)
+	}
+}
+
+func hmgetCommand(c *GodisClient) {
+	hobj := c.db.findKeyRead(c.args[1])
+	if hobj != nil && !checkType(c, hobj, GDICT) {
+		return
+	}
+	fields := c.args[2:]
+	c.AddReplyArrayLen(len(fields))
+	for _, field := range fields {
+		var val *Gobj
+		if hobj != nil {
+			val = hobj.Val_.(*GobjDict).Get(field)
+		}
+		if val == nil {
+			c.AddReplyStr(shared.nullBulk)
+		} else {
+			c.AddReplyBulk(val)
+		}
+	}
+}
+
+func hdelCommand(c *GodisClient) {
+	key := c.args[1]
+	hobj := c.db.findKeyWrite(key)
+	if hobj == nil {
+		c.AddReplyStr(shared.czero)
+		return
+	}
+	if !checkType(c, hobj, GDICT) {
+		return
+	}
+	hash := hobj.Val_.(*GobjDict)
+	var deleted int64
+	for _, field := range c.args[2:] {
+		if hash.Delete(field) == nil {
+			deleted++
+		}
+	}
+	if hash.Size() == 0 {
+		c.db.deleteKey(key)
+	}
+	server.dirty += deleted
+	c.AddReplyInt(deleted)
+}
+
+func hexistsCommand(c *GodisClient) {
+	hash := findHashOrReply(c, c.args[1], shared.czero)
+	if hash == nil {
+		return
+	}
+	if hash.Find(c.args[2]) != nil {
+		c.AddReplyStr(shared.cone)
+	} else {
+		c.AddReplyStr(shared.czero)
+	}
+}
+
+func hlenCommand(c *GodisClient) {
+	hash := findHashOrReply(c, c.args[1], shared.czero)
+	if hash == nil {
+		return
+	}
+	c.AddReplyInt(hash.Size())
+}
+
+func hstrlenCommand(c *GodisClient) {
+	hash := findHashOrReply(c, c.args[1], shared.czero)
+	if hash == nil {
+		return
+	}
+	val := hash.Get(c.args[2])
+	if val == nil {
+		c.AddReplyStr(shared.czero)
+	} else {
+		c.AddReplyInt(int64(len(val.StrVal())))
+	}
+}
+
+func hkeysCommand(c *GodisClient) {
+	hgetallGenericCommand(c, true, false)
+}
+
+func hvalsCommand(c *GodisClient) {
+	hgetallGenericCommand(c, false, true)
+}
+
+func hgetallCommand(c *GodisClient) {
+	hgetallGenericCommand(c, true, true)
+}
+
+func hgetallGenericCommand(c *GodisClient, withKeys, withVals bool) {
+	hash := findHashOrReply(c, c.args[1], shared.emptyArray)
+	if hash == nil {
+		return
+	}
+	length := hash.Size()
+	if withKeys && withVals {
+		length *= 2
+	}
+	c.AddReplyArrayLen(int(length))
+	hash.forEach(func(e *GobjEntry) {
+		if withKeys {
+			c.AddReplyBulk(e.Key)
+		}
+		if withVals {
+			c.AddReplyBulk(e.Val)
+		}
+	})
+}
+
+func hincrbyCommand(c *GodisClient) {
+	incr, ok := getIntOrReply(c, c.args[3])
+	if !ok {
+		return
+	}
+	hash := hashLookupWriteOrCreate(c, c.args[1])
+	if hash == nil {
+		return
+	}
+	var val int64
+	if old := hash.Get(c.args[2]); old != nil {
+		var err error
+		if val, err = strconv.ParseInt(old.StrVal(), 10, 64); err != nil {
+			c.AddReplyError("hash value is not an integer")
+			return
+		}
+	}
+	if incrOverflow(val, incr) {
+		c.AddReplyError("increment or decrement would overflow")
+		return
+	}
+	val += incr
+	o := CreateFromInt(val)
+	hash.Set(c.args[2], o)
+	o.DecrRefCount()
+	server.dirty++
+	c.AddReplyInt(val)
+}
+
+func hincrbyfloatCommand(c *GodisClient) {
+	incr, ok := getFloatOrReply(c, c.args[3])
+	if !ok {
+		return
+	}
+	if math.IsInf(incr, 0) {
+		c.AddReplyError("value is NaN or Infinity")
+		return
+	}
+	hash := hashLookupWriteOrCreate(c, c.args[1])
+	if hash == nil {
+		return
+	}
+	var val float64
+	if old := hash.Get(c.args[2]); old != nil {
+		var err error
+		if val, err = strconv.ParseFloat(old.StrVal(), 64); err != nil {
+			c.AddReplyError("hash value is not a float")
+			return
+		}
+	}
+	val += incr
+	if math.IsNaN(val) || math.IsInf(val, 0) {
+		c.AddReplyError("increment would produce NaN or Infinity")
+		return
+	}
+	o := CreateObject(GSTR, formatFloatHuman(val))
+	hash.Set(c.args[2], o)
+	server.dirty++
+	c.AddReplyBulk(o)
+	rewriteClientCommand(c, "HSET", c.args[1].StrVal(), c.args[2].StrVal(), o.StrVal())
+	o.DecrRefCount()
+}
+
+// HRANDFIELD key [count [WITHVALUES]]
+func hrandfieldCommand(c *GodisClient) {
+	if len(c.args) == 2 {
+		hash := findHashOrReply(c, c.args[1], shared.nullBulk)
+		if hash == nil {
+			return
+		}
+		c.AddReplyBulk(hash.RandomGet().Key)
+		return
+	}
+	if len(c.args) > 4 || (len(c.args) == 4 && strings.ToLower(c.args[3].StrVal()) != "withvalues") {
+		c.AddReplyStr(shared.syntaxErr)
+		return
+	}
+	withVals := len(c.args) == 4
+	count, ok := getRangeIntOrReply(c, c.args[2], -RAND_COUNT_MAX, math.MaxInt64)
+	if !ok {
+		return
+	}
+	hash := findHashOrReply(c, c.args[1], shared.emptyArray)
+	if hash == nil {
+		return
+	}
+	var entries []*GobjEntry
+	if count >= 0 {
+		entries = hash.RandomDistinct(count)
+	} else {
+		// count为负数时允许重复
+		for i := int64(0); i < -count; i++ {
+			entries = append(entries, hash.RandomGet())
+		}
+	}
+	if withVals {
+		c.AddReplyArrayLen(len(entries) * 2)
+	} else {
+		c.AddReplyArrayLen(len(entries))
+	}
+	for _, e := range entries {
+		c.AddReplyBulk(e.Key)
+		if withVals {
+			c.AddReplyBulk(e.Val)
+		}
+	}
+}
+
+func hscanCommand(c *GodisClient) {
+	scanKeyGenericCommand(c, GDICT)
+}
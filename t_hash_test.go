@@ -0,0 +1,84 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHashSetGet(t *testing.T) {
+	client := newTestClient()
+	assert.Equal(t, ":2\r\n", execCommand(client, "hset h f1 v1 f2 v2"))
+	assert.Equal(t, ":1\r\n", execCommand(client, "hset h f1 v3 f3 v3"))
+	assert.Equal(t, "-ERR wrong number of arguments for 'hset' command\r\n", execCommand(client, "hset h f1"))
+	assert.Equal(t, "$2\r\nv3\r\n", execCommand(client, "hget h f1"))
+	assert.Equal(t, "$-1\r\n", execCommand(client, "hget h f4"))
+	assert.Equal(t, "$-1\r\n", execCommand(client, "hget nokey f1"))
+	assert.Equal(t, "*3\r\n$2\r\nv2\r\n$-1\r\n$2\r\nv3\r\n", execCommand(client, "hmget h f2 f4 f3"))
+	assert.Equal(t, "*1\r\n$-1\r\n", execCommand(client, "hmget nokey f1"))
+	assert.Equal(t, ":0\r\n", execCommand(client, "hsetnx h f1 v"))
+	assert.Equal(t, ":1\r\n", execCommand(client, "hsetnx h f4 v4"))
+	assert.Equal(t, ":4\r\n", execCommand(client, "hlen h"))
+	assert.Equal(t, ":1\r\n", execCommand(client, "hexists h f4"))
+	assert.Equal(t, ":0\r\n", execCommand(client, "hexists h f5"))
+	assert.Equal(t, ":2\r\n", execCommand(client, "hstrlen h f4"))
+	assert.Equal(t, ":0\r\n", execCommand(client, "hstrlen h f5"))
+
+	assert.Equal(t, ":2\r\n", execCommand(client, "hdel h f1 f2 f5"))
+	assert.Equal(t, ":2\r\n", execCommand(client, "hdel h f3 f4"))
+	// 哈希为空时key被删除
+	assert.Equal(t, ":0\r\n", execCommand(client, "hlen h"))
+	assert.Equal(t, "*0\r\n", execCommand(client, "hgetall h"))
+
+	execCommand(client, "hset h f v")
+	assert.Equal(t, "*2\r\n$1\r\nf\r\n$1\r\nv\r\n", execCommand(client, "hgetall h"))
+	assert.Equal(t, "*1\r\n$1\r\nf\r\n", execCommand(client, "hkeys h"))
+	assert.Equal(t, "*1\r\n$1\r\nv\r\n", execCommand(client, "hvals h"))
+
+	execCommand(client, "set s v")
+	assert.Equal(t, shared.wrongType, execCommand(client, "hset s f v"))
+	assert.Equal(t, shared.wrongType, execCommand(client, "hmget s f"))
+	assert.Equal(t, shared.wrongType, execCommand(client, "get h"))
+}
+
+func TestHashIncr(t *testing.T) {
+	client := newTestClient()
+	assert.Equal(t, ":5\r\n", execCommand(client, "hincrby h n 5"))
+	assert.Equal(t, ":2\r\n", execCommand(client, "hincrby h n -3"))
+	assert.Equal(t, shared.notInteger, execCommand(client, "hincrby h n x"))
+	execCommand(client, "hset h s abc")
+	assert.Equal(t, "-ERR hash value is not an integer\r\n", execCommand(client, "hincrby h s 1"))
+	execCommand(client, "hset h max 9223372036854775807")
+	assert.Equal(t, "-ERR increment or decrement would overflow\r\n", execCommand(client, "hincrby h max 1"))
+
+	assert.Equal(t, "$4\r\n10.5\r\n", execCommand(client, "hincrbyfloat h f 10.5"))
+	assert.Equal(t, "$22\r\n1000000000000000000000\r\n", execCommand(client, "hincrbyfloat h big 1e21"))
+	assert.Equal(t, "$9\r\n0.0000001\r\n", execCommand(client, "hincrbyfloat h small 1e-7"))
+	assert.Equal(t, "$4\r\n10.6\r\n", execCommand(client, "hincrbyfloat h f 0.1"))
+	assert.Equal(t, "$4\r\n12.6\r\n", execCommand(client, "hincrbyfloat h n 10.6"))
+	assert.Equal(t, "-ERR hash value is not a float\r\n", execCommand(client, "hincrbyfloat h s 1"))
+	assert.Equal(t, shared.notFloat, execCommand(client, "hincrbyfloat h f x"))
+}
+
+func TestHashRandField(t *testing.T) {
+	client := newTestClient()
+	assert.Equal(t, "$-1\r\n", execCommand(client, "hrandfield h"))
+	assert.Equal(t, "*0\r\n", execCommand(client, "hrandfield h 3"))
+	execCommand(client, "hset h f1 v1 f2 v2 f3 v3")
+	assert.True(t, strings.HasPrefix(execCommand(client, "hrandfield h"), "$2\r\nf"))
+	assert.True(t, strings.HasPrefix(execCommand(client, "hrandfield h 2"), "*2\r\n"))
+	assert.True(t, strings.HasPrefix(execCommand(client, "hrandfield h 10"), "*3\r\n"))
+	assert.True(t, strings.HasPrefix(execCommand(client, "hrandfield h -10"), "*10\r\n"))
+	assert.Equal(t, "-ERR value is out of range, value must between -1048576 and 9223372036854775807\r\n",
+		execCommand(client, "hrandfield h -9223372036854775808"))
+	assert.Equal(t, "-ERR value is out of range, value must between -1048576 and 9223372036854775807\r\n",
+		execCommand(client, "hrandfield h -4000000000 withvalues"))
+	assert.True(t, strings.HasPrefix(execCommand(client, "hrandfield h 2 withvalues"), "*4\r\n"))
+	assert.Equal(t, shared.syntaxErr, execCommand(client, "hrandfield h 2 foo"))
+
+	reply := execCommand(client, "hrandfield h 3")
+	for _, f := range []string{"f1", "f2", "f3"} {
+		assert.Contains(t, reply, f)
+	}
+}
@@ -0,0 +1,352 @@
+package main
+
+import "strings"
+
+// 列表类型的命令实现，value为GLIST类型的Gobj，内部是*GobjList
+
+func createListObject() *Gobj {
+	return CreateObject(GLIST, GobjListCreate())
+}
+
+func lpushCommand(c *GodisClient) {
+	pushGenericCommand(c, true, false)
+}
+
+func rpushCommand(c *GodisClient) {
+	pushGenericCommand(c, false, false)
+}
+
+func lpushxCommand(c *GodisClient) {
+	pushGenericCommand(c, true, true)
+}
+
+func rpushxCommand(c *GodisClient) {
+	pushGenericCommand(c, false, true)
+}
+
+// xx表示只有key存在时才push
+func pushGenericCommand(c *GodisClient, head bool, xx bool) {
+	key := c.args[1]
+	lobj := c.db.findKeyWrite(key)
+	if lobj != nil && !checkType(c, lobj, GLIST) {
+		return
+	}
+	if lobj == nil {
+		if xx {
+			c.AddReplyStr(shared.czero)
+			return
+		}
+		lobj = createListObject()
+		c.db.data.Set(key, lobj)
+		lobj.DecrRefCount()
+	}
+	list := lobj.Val_.(*GobjList)
+	for _, v := range c.args[2:] {
+		if head {
+			list.LPush(v)
+		} else {
+			list.Append(v)
+		}
+		v.IncrRefCount()
+	}
+	server.dirty += int64(len(c.args) - 2)
+	c.AddReplyInt(int64(list.Length()))
+}
+
+func lpopCommand(c *GodisClient) {
+	popGenericCommand(c, true)
+}
+
+func rpopCommand(c *GodisClient) {
+	popGenericCommand(c, false)
+}
+
+func popGenericCommand(c *GodisClient, head bool) {
+	if len(c.args) > 3 {
+		c.AddReplyStr(shared.syntaxErr)
+		return
+	}
+	hasCount := len(c.args) == 3
+	var count int64
+	if hasCount {
+		var ok bool
+		if count, ok = getIntOrReply(c, c.args[2]); !ok {
+			return
+		}
+		if count < 0 {
+			c.AddReplyError("value is out of range, must be positive")
+			return
+		}
+	}
+	key := c.args[1]
+	lobj := c.db.findKeyWrite(key)
+	if lobj == nil {
+		if hasCount {
+			c.AddReplyStr(shared.nullArray)
+		} else {
+			c.AddReplyStr(shared.nullBulk)
+		}
+		return
+	}
+	if !checkType(c, lobj, GLIST) {
+		return
+	}
+	list := lobj.Val_.(*GobjList)
+	if !hasCount {
+		count = 1
+	} else {
+		if count > int64(list.Length()) {
+			count = int64(list.Length())
+		}
+		c.AddReplyArrayLen(int(count))
+	}
+	for i := int64(0); i < count; i++ {
+		listPopReply(c, list, head)
+	}
+	server.dirty += count
+	if list.Length() == 0 {
+		c.db.deleteKey(key)
+	}
+}
+
+func listPopReply(c *GodisClient, list *GobjList, head bool) {
+	var n *GobjNode
+	if head {
+		n = list.First()
+	} else {
+		n = list.Last()
+	}
+	c.AddReplyBulk(n.Val)
+	list.DelNode(n)
+}
+
+// 查找列表，key不存在时回复empty
+func findListOrReply(c *GodisClient, key *Gobj, empty string) *GobjList {
+	lobj := c.db.findKeyRead(key)
+	if lobj == nil {
+		c.AddReplyStr(empty)
+		return nil
+	}
+	if !checkType(c, lobj, GLIST) {
+		return nil
+	}
+	return lobj.Val_.(*GobjList)
+}
+
+func llenCommand(c *GodisClient) {
+	list := findListOrReply(c, c.args[1], shared.czero)
+	if list == nil {
+		return
+	}
+	c.AddReplyInt(int64(list.Length()))
+}
+
+func lrangeCommand(c *GodisClient) {
+	start, ok := getIntOrReply(c, c.args[2])
+	if !ok {
+		return
+	}
+	end, ok := getIntOrReply(c, c.args[3])
+	if !ok {
+		return
+	}
+	list := findListOrReply(c, c.args[1], shared.emptyArray)
+	if list == nil {
+		return
+	}
+	llen := int64(list.Length())
+	if start < 0 {
+		start += llen
+	}
+	if end < 0 {
+		end += llen
+	}
+	if start < 0 {
+		start = 0
+	}
+	if start > end || start >= llen {
+		c.AddReplyStr(shared.emptyArray)
+		return
+	}
+	if end >= llen {
+		end = llen - 1
+	}
+	c.AddReplyArrayLen(int(end - start + 1))
+	n := list.Index(int(start))
+	for i := start; i <= end; i++ {
+		c.AddReplyBulk(n.Val)
+		n = n.next
+	}
+}
+
+func lindexCommand(c *GodisClient) {
+	idx, ok := getIntOrReply(c, c.args[2])
+	if !ok {
+		return
+	}
+	list := findListOrReply(c, c.args[1], shared.nullBulk)
+	if list == nil {
+		return
+	}
+	n := list.Index(int(idx))
+	if n == nil {
+		c.AddReplyStr(shared.nullBulk)
+	} else {
+		c.AddReplyBulk(n.Val)
+	}
+}
+
+func lsetCommand(c *GodisClient) {
+	idx, ok := getIntOrReply(c, c.args[2])
+	if !ok {
+		return
+	}
+	lobj := c.db.findKeyWrite(c.args[1])
+	if lobj == nil {
+		c.AddReplyStr(shared.noSuchKey)
+		return
+	}
+	if !checkType(c, lobj, GLIST) {
+		return
+	}
+	n := lobj.Val_.(*GobjList).Index(int(idx))
+	if n == nil {
+		c.AddReplyStr(shared.outOfRange)
+		return
+	}
+	val := c.args[3]
+	lobj.Val_.(*GobjList).SetNodeVal(n, val)
+	val.IncrRefCount()
+	server.dirty++
+	c.AddReplyStr(shared.ok)
+}
+
+func linsertCommand(c *GodisClient) {
+	var after bool
+	switch strings.ToLower(c.args[2].StrVal()) {
+	case "after":
+		after = true
+	case "before":
+		after = false
+	default:
+		c.AddReplyStr(shared.syntaxErr)
+		return
+	}
+	lobj := c.db.findKeyWrite(c.args[1])
+	if lobj == nil {
+		c.AddReplyStr(shared.czero)
+		return
+	}
+	if !checkType(c, lobj, GLIST) {
+		return
+	}
+	list := lobj.Val_.(*GobjList)
+	pivot := list.Find(c.args[3])
+	if pivot == nil {
+		c.AddReplyStr(shared.cnegone)
+		return
+	}
+	val := c.args[4]
+	list.InsertNode(pivot, val, after)
+	val.IncrRefCount()
+	server.dirty++
+	c.AddReplyInt(int64(list.Length()))
+}
+
+// count > 0从头部开始删除，count < 0从尾部开始删除，count = 0删除全部
+func lremCommand(c *GodisClient) {
+	count, ok := getIntOrReply(c, c.args[2])
+	if !ok {
+		return
+	}
+	key := c.args[1]
+	lobj := c.db.findKeyWrite(key)
+	if lobj == nil {
+		c.AddReplyStr(shared.czero)
+		return
+	}
+	if !checkType(c, lobj, GLIST) {
+		return
+	}
+	list := lobj.Val_.(*GobjList)
+	target := c.args[3]
+	var removed int64
+	fromTail := count < 0
+	n := list.First()
+	if fromTail {
+		count = -count
+		n = list.Last()
+	}
+	for n != nil {
+		next := n.next
+		if fromTail {
+			next = n.prev
+		}
+		if list.EqualFunc(n.Val, target) {
+			list.DelNode(n)
+			removed++
+			if count != 0 && removed == count {
+				break
+			}
+		}
+		n = next
+	}
+	if list.Length() == 0 {
+		c.db.deleteKey(key)
+	}
+	server.dirty += removed
+	c.AddReplyInt(removed)
+}
+
+func ltrimCommand(c *GodisClient) {
+	start, ok := getIntOrReply(c, c.args[2])
+	if !ok {
+		return
+	}
+	end, ok := getIntOrReply(c, c.args[3])
+	if !ok {
+		return
+	}
+	key := c.args[1]
+	lobj := c.db.findKeyWrite(key)
+	if lobj == nil {
+		c.AddReplyStr(shared.ok)
+		return
+	}
+	if !checkType(c, lobj, GLIST) {
+		return
+	}
+	list := lobj.Val_.(*GobjList)
+	llen := int64(list.Length())
+	if start < 0 {
+		start += llen
+	}
+	if end < 0 {
+		end += llen
+	}
+	if start < 0 {
+		start = 0
+	}
+	// ltrim为头部要删除的个数，rtrim为尾部要删除的个数
+	var ltrim, rtrim int64
+	if start > end || start >= llen {
+		ltrim = llen
+	} else {
+		if end >= llen {
+			end = llen - 1
+		}
+		ltrim = start
+		rtrim = llen - end - 1
+	}
+	for i := int64(0); i < ltrim; i++ {
+		list.DelNode(list.First())
+	}
+	for i := int64(0); i < rtrim; i++ {
+		list.DelNode(list.Last())
+	}
+	if list.Length() == 0 {
+		c.db.deleteKey(key)
+	}
+	server.dirty += ltrim + rtrim
+	c.AddReplyStr(shared.ok)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListPushPop(t *testing.T) {
+	client := newTestClient()
+	assert.Equal(t, ":0\r\n", execCommand(client, "lpushx l a"))
+	assert.Equal(t, ":2\r\n", execCommand(client, "rpush l a b"))
+	assert.Equal(t, ":4\r\n", execCommand(client, "lpush l c d"))
+	// d c a b
+	assert.Equal(t, ":5\r\n", execCommand(client, "rpushx l e"))
+	assert.Equal(t, ":5\r\n", execCommand(client, "llen l"))
+	assert.Equal(t, "$1\r\nd\r\n", execCommand(client, "lpop l"))
+	assert.Equal(t, "$1\r\ne\r\n", execCommand(client, "rpop l"))
+	assert.Equal(t, "*2\r\n$1\r\nc\r\n$1\r\na\r\n", execCommand(client, "lpop l 2"))
+	assert.Equal(t, "*1\r\n$1\r\nb\r\n", execCommand(client, "rpop l 5"))
+	// 列表为空时key被删除
+	assert.Equal(t, ":0\r\n", execCommand(client, "llen l"))
+	assert.Equal(t, "$-1\r\n", execCommand(client, "lpop l"))
+	assert.Equal(t, "*-1\r\n", execCommand(client, "lpop l 1"))
+
+	execCommand(client, "set s v")
+	assert.Equal(t, shared.wrongType, execCommand(client, "lpush s a"))
+	assert.Equal(t, shared.wrongType, execCommand(client, "llen s"))
+	execCommand(client, "rpush l a")
+	assert.Equal(t, shared.wrongType, execCommand(client, "get l"))
+}
+
+func TestListRange(t *testing.T) {
+	client := newTestClient()
+	execCommand(client, "rpush l a b c d e")
+	assert.Equal(t, "*5\r\n$1\r\na\r\n$1\r\nb\r\n$1\r\nc\r\n$1\r\nd\r\n$1\r\ne\r\n", execCommand(client, "lrange l 0 -1"))
+	assert.Equal(t, "*2\r\n$1\r\nd\r\n$1\r\ne\r\n", execCommand(client, "lrange l -2 100"))
+	assert.Equal(t, "*0\r\n", execCommand(client, "lrange l 3 1"))
+	assert.Equal(t, "$1\r\nb\r\n", execCommand(client, "lindex l 1"))
+	assert.Equal(t, "$1\r\ne\r\n", execCommand(client, "lindex l -1"))
+	assert.Equal(t, "$-1\r\n", execCommand(client, "lindex l 5"))
+	assert.Equal(t, shared.notInteger, execCommand(client, "lindex l x"))
+
+	assert.Equal(t, "+OK\r\n", execCommand(client, "lset l -1 f"))
+	assert.Equal(t, shared.outOfRange, execCommand(client, "lset l 5 f"))
+	assert.Equal(t, shared.noSuchKey, execCommand(client, "lset nokey 0 f"))
+
+	assert.Equal(t, ":6\r\n", execCommand(client, "linsert l before a x"))
+	assert.Equal(t, ":7\r\n", execCommand(client, "linsert l after f y"))
+	assert.Equal(t, ":-1\r\n", execCommand(client, "linsert l after z y"))
+	assert.Equal(t, shared.syntaxErr, execCommand(client, "linsert l middle a y"))
+	assert.Equal(t, "*7\r\n$1\r\nx\r\n$1\r\na\r\n$1\r\nb\r\n$1\r\nc\r\n$1\r\nd\r\n$1\r\nf\r\n$1\r\ny\r\n",
+		execCommand(client, "lrange l 0 -1"))
+
+	assert.Equal(t, "+OK\r\n", execCommand(client, "ltrim l 1 -2"))
+	assert.Equal(t, "*5\r\n$1\r\na\r\n$1\r\nb\r\n$1\r\nc\r\n$1\r\nd\r\n$1\r\nf\r\n", execCommand(client, "lrange l 0 -1"))
+	assert.Equal(t, "+OK\r\n", execCommand(client, "ltrim l 5 1"))
+	assert.Equal(t, ":0\r\n", execCommand(client, "llen l"))
+}
+
+func TestListRem(t *testing.T) {
+	client := newTestClient()
+	execCommand(client, "rpush l a b a c a")
+	assert.Equal(t, ":1\r\n", execCommand(client, "lrem l -1 a"))
+	assert.Equal(t, "*4\r\n$1\r\na\r\n$1\r\nb\r\n$1\r\na\r\n$1\r\nc\r\n", execCommand(client, "lrange l 0 -1"))
+	assert.Equal(t, ":1\r\n", execCommand(client, "lrem l 1 a"))
+	assert.Equal(t, ":0\r\n", execCommand(client, "lrem l 0 z"))
+	assert.Equal(t, ":1\r\n", execCommand(client, "lrem l 0 a"))
+	assert.Equal(t, "*2\r\n$1\r\nb\r\n$1\r\nc\r\n", execCommand(client, "lrange l 0 -1"))
+	execCommand(client, "lrem l 0 b")
+	execCommand(client, "lrem l 0 c")
+	assert.Equal(t, ":0\r\n", execCommand(client, "llen l"))
+}
@@ -0,0 +1,420 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"strings"
+)
+
+// 集合类型的命令实现，value为GSET类型的Gobj，内部是val为nil的*GobjDict
+
+const (
+	SET_OP_UNION int = iota
+	SET_OP_DIFF
+	SET_OP_INTER
+)
+
+func createSetObject() *Gobj {
+	return CreateObject(GSET, GobjDictCreate())
+}
+
+// 查找集合用于读取，key不存在时回复empty
+func findSetOrReply(c *GodisClient, key *Gobj, empty string) *GobjDict {
+	sobj := c.db.findKeyRead(key)
+	if sobj == nil {
+		c.AddReplyStr(empty)
+		return nil
+	}
+	if !checkType(c, sobj, GSET) {
+		return nil
+	}
+	return sobj.Val_.(*GobjDict)
+}
+
+func addReplySetMembers(c *GodisClient, set *GobjDict) {
+	c.AddReplyArrayLen(int(set.Size()))
+	set.forEach(func(e *GobjEntry) {
+		c.AddReplyBulk(e.Key)
+	})
+}
+
+func saddCommand(c *GodisClient) {
+	key := c.args[1]
+	sobj := c.db.findKeyWrite(key)
+	if sobj == nil {
+		sobj = createSetObject()
+		c.db.data.Set(key, sobj)
+		sobj.DecrRefCount()
+	} else if !checkType(c, sobj, GSET) {
+		return
+	}
+	set := sobj.Val_.(*GobjDict)
+	var added int64
+	for _, member := range c.args[2:] {
+		if set.Add(member, nil) == nil {
+			added++
+		}
+	}
+	server.dirty += added
+	c.AddReplyInt(added)
+}
+
+func sremCommand(c *GodisClient) {
+	key := c.args[1]
+	sobj := c.db.findKeyWrite(key)
+	if sobj == nil {
+		c.AddReplyStr(shared.czero)
+		return
+	}
+	if !checkType(c, sobj, GSET) {
+		return
+	}
+	set := sobj.Val_.(*GobjDict)
+	var removed int64
+	for _, member := range c.args[2:] {
+		if set.Delete(member) == nil {
+			removed++
+		}
+	}
+	if set.Size() == 0 {
+		c.db.deleteKey(key)
+	}
+	server.dirty += removed
+	c.AddReplyInt(removed)
+}
+
+func sismemberCommand(c *GodisClient) {
+	set := findSetOrReply(c, c.args[1], shared.czero)
+	if set == nil {
+		return
+	}
+	if set.Find(c.args[2]) != nil {
+		c.AddReplyStr(shared.cone)
+	} else {
+		c.AddReplyStr(shared.czero)
+	}
+}
+
+func smismemberCommand(c *GodisClient) {
+	sobj := c.db.findKeyRead(c.args[1])
+	if sobj != nil && !checkType(c, sobj, GSET) {
+		return
+	}
+	members := c.args[2:]
+	c.AddReplyArrayLen(len(members))
+	for _, member := range members {
+		if sobj != nil && sobj.Val_.(*GobjDict).Find(member) != nil {
+			c.AddReplyStr(shared.cone)
+		} else {
+			c.AddReplyStr(shared.czero)
+		}
+	}
+}
+
+func scardCommand(c *GodisClient) {
+	set := findSetOrReply(c, c.args[1], shared.czero)
+	if set == nil {
+		return
+	}
+	c.AddReplyInt(set.Size())
+}
+
+func smembersCommand(c *GodisClient) {
+	set := findSetOrReply(c, c.args[1], shared.emptyArray)
+	if set == nil {
+		return
+	}
+	addReplySetMembers(c, set)
+}
+
+// SPOP key [count]
+func spopCommand(c *GodisClient) {
+	if len(c.args) > 3 {
+		c.AddReplyStr(shared.syntaxErr)
+		return
+	}
+	key := c.args[1]
+	if len(c.args) == 2 {
+		sobj := c.db.findKeyWrite(key)
+		if sobj == nil {
+			c.AddReplyStr(shared.nullBulk)
+			return
+		}
+		if !checkType(c, sobj, GSET) {
+			return
+		}
+		set := sobj.Val_.(*GobjDict)
+		member := set.RandomGet().Key
+		c.AddReplyBulk(member)
+		// 随机弹出的元素以SREM写入AOF
+		popped := member.StrVal()
+		set.Delete(member)
+		if set.Size() == 0 {
+			c.db.deleteKey(key)
+		}
+		server.dirty++
+		rewriteClientCommand(c, "SREM", key.StrVal(), popped)
+		return
+	}
+	count, ok := getIntOrReply(c, c.args[2])
+	if !ok {
+		return
+	}
+	if count < 0 {
+		c.AddReplyError("value is out of range, must be positive")
+		return
+	}
+	sobj := c.db.findKeyWrite(key)
+	if sobj == nil {
+		c.AddReplyStr(shared.emptyArray)
+		return
+	}
+	if !checkType(c, sobj, GSET) {
+		return
+	}
+	set := sobj.Val_.(*GobjDict)
+	entries := set.RandomDistinct(count)
+	c.AddReplyArrayLen(len(entries))
+	srem := []string{"SREM", key.StrVal()}
+	for _, e := range entries {
+		member := e.Key
+		c.AddReplyBulk(member)
+		srem = append(srem, member.StrVal())
+		set.Delete(member)
+	}
+	if set.Size() == 0 {
+		c.db.deleteKey(key)
+	}
+	server.dirty += int64(len(entries))
+	if len(entries) > 0 {
+		rewriteClientCommand(c, srem...)
+	}
+}
+
+// SRANDMEMBER key [count]，count为负数时允许重复
+func srandmemberCommand(c *GodisClient) {
+	if len(c.args) > 3 {
+		c.AddReplyStr(shared.syntaxErr)
+		return
+	}
+	if len(c.args) == 2 {
+		set := findSetOrReply(c, c.args[1], shared.nullBulk)
+		if set == nil {
+			return
+		}
+		c.AddReplyBulk(set.RandomGet().Key)
+		return
+	}
+	count, ok := getRangeIntOrReply(c, c.args[2], -RAND_COUNT_MAX, math.MaxInt64)
+	if !ok {
+		return
+	}
+	set := findSetOrReply(c, c.args[1], shared.emptyArray)
+	if set == nil {
+		return
+	}
+	if count >= 0 {
+		entries := set.RandomDistinct(count)
+		c.AddReplyArrayLen(len(entries))
+		for _, e := range entries {
+			c.AddReplyBulk(e.Key)
+		}
+		return
+	}
+	c.AddReplyArrayLen(int(-count))
+	for i := int64(0); i < -count; i++ {
+		c.AddReplyBulk(set.RandomGet().Key)
+	}
+}
+
+func smoveCommand(c *GodisClient) {
+	srckey, dstkey, member := c.args[1], c.args[2], c.args[3]
+	srcobj := c.db.findKeyWrite(srckey)
+	dstobj := c.db.findKeyWrite(dstkey)
+	if srcobj == nil {
+		c.AddReplyStr(shared.czero)
+		return
+	}
+	if !checkType(c, srcobj, GSET) || (dstobj != nil && !checkType(c, dstobj, GSET)) {
+		return
+	}
+	src := srcobj.Val_.(*GobjDict)
+	if srcobj == dstobj {
+		if src.Find(member) != nil {
+			c.AddReplyStr(shared.cone)
+		} else {
+			c.AddReplyStr(shared.czero)
+		}
+		return
+	}
+	if src.Delete(member) != nil {
+		c.AddReplyStr(shared.czero)
+		return
+	}
+	if src.Size() == 0 {
+		c.db.deleteKey(srckey)
+	}
+	if dstobj == nil {
+		dstobj = createSetObject()
+		c.db.data.Set(dstkey, dstobj)
+		dstobj.DecrRefCount()
+	}
+	dstobj.Val_.(*GobjDict).Add(member, nil)
+	server.dirty++
+	c.AddReplyStr(shared.cone)
+}
+
+// 查找参与运算的集合，不存在的key对应nil，类型错误时回复错误并返回false
+func lookupSets(c *GodisClient, keys []*Gobj) ([]*GobjDict, bool) {
+	sets := make([]*GobjDict, len(keys))
+	for i, key := range keys {
+		sobj := c.db.findKeyRead(key)
+		if sobj == nil {
+			continue
+		}
+		if !checkType(c, sobj, GSET) {
+			return nil, false
+		}
+		sets[i] = sobj.Val_.(*GobjDict)
+	}
+	return sets, true
+}
+
+// 集合的交集、并集、差集运算，limit大于0时交集最多计算limit个元素
+func setOperation(sets []*GobjDict, op int, limit int64) *GobjDict {
+	dst := GobjDictCreate()
+	switch op {
+	case SET_OP_UNION:
+		for _, set := range sets {
+			if set == nil {
+				continue
+			}
+			set.forEach(func(e *GobjEntry) {
+				dst.Add(e.Key, nil)
+			})
+		}
+	case SET_OP_DIFF:
+		if sets[0] == nil {
+			break
+		}
+		sets[0].forEach(func(e *GobjEntry) {
+			for _, set := range sets[1:] {
+				if set != nil && set.Find(e.Key) != nil {
+					return
+				}
+			}
+			dst.Add(e.Key, nil)
+		})
+	case SET_OP_INTER:
+		for _, set := range sets {
+			if set == nil {
+				return dst
+			}
+		}
+		// 从最小的集合开始遍历
+		sorted := make([]*GobjDict, len(sets))
+		copy(sorted, sets)
+		sort.Slice(sorted, func(i, j int) bool {
+			return sorted[i].Size() < sorted[j].Size()
+		})
+		sorted[0].forEach(func(e *GobjEntry) {
+			if limit > 0 && dst.Size() >= limit {
+				return
+			}
+			for _, set := range sorted[1:] {
+				if set.Find(e.Key) == nil {
+					return
+				}
+			}
+			dst.Add(e.Key, nil)
+		})
+	}
+	return dst
+}
+
+func setOperationGenericCommand(c *GodisClient, keys []*Gobj, dstkey *Gobj, op int) {
+	sets, ok := lookupSets(c, keys)
+	if !ok {
+		return
+	}
+	result := setOperation(sets, op, 0)
+	if dstkey == nil {
+		addReplySetMembers(c, result)
+		return
+	}
+	if result.Size() == 0 {
+		if c.db.deleteKey(dstkey) {
+			server.dirty++
+		}
+		c.AddReplyStr(shared.czero)
+		return
+	}
+	o := CreateObject(GSET, result)
+	c.db.setKey(dstkey, o)
+	o.DecrRefCount()
+	server.dirty++
+	c.AddReplyInt(result.Size())
+}
+
+func sinterCommand(c *GodisClient) {
+	setOperationGenericCommand(c, c.args[1:], nil, SET_OP_INTER)
+}
+
+func sinterstoreCommand(c *GodisClient) {
+	setOperationGenericCommand(c, c.args[2:], c.args[1], SET_OP_INTER)
+}
+
+func sunionCommand(c *GodisClient) {
+	setOperationGenericCommand(c, c.args[1:], nil, SET_OP_UNION)
+}
+
+func sunionstoreCommand(c *GodisClient) {
+	setOperationGenericCommand(c, c.args[2:], c.args[1], SET_OP_UNION)
+}
+
+func sdiffCommand(c *GodisClient) {
+	setOperationGenericCommand(c, c.args[1:], nil, SET_OP_DIFF)
+}
+
+func sdiffstoreCommand(c *GodisClient) {
+	setOperationGenericCommand(c, c.args[2:], c.args[1], SET_OP_DIFF)
+}
+
+// SINTERCARD numkeys key [key ...] [LIMIT limit]
+func sintercardCommand(c *GodisClient) {
+	numkeys, ok := getIntOrReply(c, c.args[1])
+	if !ok {
+		return
+	}
+	if numkeys <= 0 {
+		c.AddReplyError("numkeys should be greater than 0")
+		return
+	}
+	if numkeys > int64(len(c.args)-2) {
+		c.AddReplyError("Number of keys can't be greater than number of args")
+		return
+	}
+	var limit int64
+	for i := int(numkeys) + 2; i < len(c.args); i += 2 {
+		if strings.ToLower(c.args[i].StrVal()) != "limit" || i+1 >= len(c.args) {
+			c.AddReplyStr(shared.syntaxErr)
+			return
+		}
+		if limit, ok = getIntOrReply(c, c.args[i+1]); !ok {
+			return
+		}
+		if limit < 0 {
+			c.AddReplyError("LIMIT can't be negative")
+			return
+		}
+	}
+	sets, ok := lookupSets(c, c.args[2:numkeys+2])
+	if !ok {
+		return
+	}
+	c.AddReplyInt(setOperation(sets, SET_OP_INTER, limit).Size())
+}
+
+func sscanCommand(c *GodisClient) {
+	scanKeyGenericCommand(c, GSET)
+}
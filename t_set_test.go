@@ -0,0 +1,94 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetAddRem(t *testing.T) {
+	client := newTestClient()
+	assert.Equal(t, ":3\r\n", execCommand(client, "sadd s a b c"))
+	assert.Equal(t, ":1\r\n", execCommand(client, "sadd s a d"))
+	assert.Equal(t, ":4\r\n", execCommand(client, "scard s"))
+	assert.Equal(t, ":1\r\n", execCommand(client, "sismember s a"))
+	assert.Equal(t, ":0\r\n", execCommand(client, "sismember s e"))
+	assert.Equal(t, "*3\r\n:1\r\n:0\r\n:1\r\n", execCommand(client, "smismember s a e d"))
+	assert.Equal(t, "*1\r\n:0\r\n", execCommand(client, "smismember nokey a"))
+	assert.Equal(t, []string{"a", "b", "c", "d"}, parseBulkArray(execCommand(client, "smembers s")))
+	assert.Equal(t, ":2\r\n", execCommand(client, "srem s a b e"))
+	assert.Equal(t, ":2\r\n", execCommand(client, "srem s c d"))
+	// 集合为空时key被删除
+	assert.Equal(t, ":0\r\n", execCommand(client, "scard s"))
+	assert.Equal(t, "*0\r\n", execCommand(client, "smembers s"))
+
+	execCommand(client, "set str v")
+	assert.Equal(t, shared.wrongType, execCommand(client, "sadd str a"))
+	assert.Equal(t, shared.wrongType, execCommand(client, "sinter str"))
+}
+
+func TestSetRandom(t *testing.T) {
+	client := newTestClient()
+	assert.Equal(t, "$-1\r\n", execCommand(client, "spop s"))
+	assert.Equal(t, "*0\r\n", execCommand(client, "spop s 2"))
+	assert.Equal(t, "$-1\r\n", execCommand(client, "srandmember s"))
+	execCommand(client, "sadd s a b c d e")
+	assert.True(t, strings.HasPrefix(execCommand(client, "srandmember s"), "$1\r\n"))
+	assert.Equal(t, 3, len(parseBulkArray(execCommand(client, "srandmember s 3"))))
+	assert.Equal(t, []string{"a", "b", "c", "d", "e"}, parseBulkArray(execCommand(client, "srandmember s 10")))
+	assert.Equal(t, 8, len(parseBulkArray(execCommand(client, "srandmember s -8"))))
+	assert.Equal(t, "-ERR value is out of range, value must between -1048576 and 9223372036854775807\r\n",
+		execCommand(client, "srandmember s -9223372036854775808"))
+	assert.Equal(t, "-ERR value is out of range, value must between -1048576 and 9223372036854775807\r\n",
+		execCommand(client, "srandmember s -4000000000"))
+	assert.Equal(t, ":5\r\n", execCommand(client, "scard s"))
+
+	assert.True(t, strings.HasPrefix(execCommand(client, "spop s"), "$1\r\n"))
+	assert.Equal(t, 2, len(parseBulkArray(execCommand(client, "spop s 2"))))
+	assert.Equal(t, ":2\r\n", execCommand(client, "scard s"))
+	assert.Equal(t, "-ERR value is out of range, must be positive\r\n", execCommand(client, "spop s -1"))
+	assert.Equal(t, 2, len(parseBulkArray(execCommand(client, "spop s 5"))))
+	assert.Equal(t, ":0\r\n", execCommand(client, "scard s"))
+}
+
+func TestSetMove(t *testing.T) {
+	client := newTestClient()
+	execCommand(client, "sadd src a b")
+	assert.Equal(t, ":1\r\n", execCommand(client, "smove src dst a"))
+	assert.Equal(t, ":0\r\n", execCommand(client, "smove src dst c"))
+	assert.Equal(t, ":1\r\n", execCommand(client, "smove src src b"))
+	assert.Equal(t, ":1\r\n", execCommand(client, "smove src dst b"))
+	assert.Equal(t, ":0\r\n", execCommand(client, "scard src"))
+	assert.Equal(t, []string{"a", "b"}, parseBulkArray(execCommand(client, "smembers dst")))
+	execCommand(client, "set str v")
+	assert.Equal(t, shared.wrongType, execCommand(client, "smove dst str a"))
+}
+
+func TestSetAlgebra(t *testing.T) {
+	client := newTestClient()
+	execCommand(client, "sadd s1 a b c d")
+	execCommand(client, "sadd s2 c d e")
+	execCommand(client, "sadd s3 a c e")
+	assert.Equal(t, []string{"c"}, parseBulkArray(execCommand(client, "sinter s1 s2 s3")))
+	assert.Equal(t, "*0\r\n", execCommand(client, "sinter s1 nokey"))
+	assert.Equal(t, []string{"a", "b", "c", "d", "e"}, parseBulkArray(execCommand(client, "sunion s1 s2 nokey")))
+	assert.Equal(t, []string{"b"}, parseBulkArray(execCommand(client, "sdiff s1 s2 s3")))
+	assert.Equal(t, "*0\r\n", execCommand(client, "sdiff nokey s1"))
+
+	assert.Equal(t, ":2\r\n", execCommand(client, "sinterstore dst s1 s2"))
+	assert.Equal(t, []string{"c", "d"}, parseBulkArray(execCommand(client, "smembers dst")))
+	assert.Equal(t, ":5\r\n", execCommand(client, "sunionstore dst s1 s2"))
+	assert.Equal(t, ":2\r\n", execCommand(client, "sdiffstore dst s1 s2"))
+	assert.Equal(t, []string{"a", "b"}, parseBulkArray(execCommand(client, "smembers dst")))
+	assert.Equal(t, ":0\r\n", execCommand(client, "sinterstore dst s1 nokey"))
+	assert.Equal(t, ":0\r\n", execCommand(client, "scard dst"))
+
+	assert.Equal(t, ":2\r\n", execCommand(client, "sintercard 2 s1 s2"))
+	assert.Equal(t, ":1\r\n", execCommand(client, "sintercard 2 s1 s2 limit 1"))
+	assert.Equal(t, ":2\r\n", execCommand(client, "sintercard 2 s1 s2 limit 0"))
+	assert.Equal(t, "-ERR numkeys should be greater than 0\r\n", execCommand(client, "sintercard 0 s1"))
+	assert.Equal(t, "-ERR Number of keys can't be greater than number of args\r\n", execCommand(client, "sintercard 3 s1 s2"))
+	assert.Equal(t, "-ERR LIMIT can't be negative\r\n", execCommand(client, "sintercard 2 s1 s2 limit -1"))
+	assert.Equal(t, shared.syntaxErr, execCommand(client, "sintercard 1 s1 s2"))
+}
@@ -0,0 +1,527 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// 字符串的最大长度，与redis的proto-max-bulk-len默认值一致
+const STRING_MAX_LEN = 512 * 1024 * 1024
+
+// 字符串类型的命令实现，value为GSTR类型的Gobj
+
+func incrCommand(c *GodisClient) {
+	incrDecrCommand(c, 1)
+}
+
+func decrCommand(c *GodisClient) {
+	incrDecrCommand(c, -1)
+}
+
+func incrbyCommand(c *GodisClient) {
+	incr, ok := getIntOrReply(c, c.args[2])
+	if !ok {
+		return
+	}
+	incrDecrCommand(c, incr)
+}
+
+func decrbyCommand(c *GodisClient) {
+	decr, ok := getIntOrReply(c, c.args[2])
+	if !ok {
+		return
+	}
+	if decr == math.MinInt64 {
+		c.AddReplyError("decrement would overflow")
+		return
+	}
+	incrDecrCommand(c, -decr)
+}
+
+// 修改value但保留过期时间
+func incrDecrCommand(c *GodisClient, incr int64) {
+	key := c.args[1]
+	o := c.db.findKeyRead(key)
+	if o != nil && !checkType(c, o, GSTR) {
+		return
+	}
+	var val int64
+	if o != nil {
+		var err error
+		if val, err = strconv.ParseInt(o.StrVal(), 10, 64); err != nil {
+			c.AddReplyStr(shared.notInteger)
+			return
+		}
+	}
+	if incrOverflow(val, incr) {
+		c.AddReplyError("increment or decrement would overflow")
+		return
+	}
+	val += incr
+	newObj := CreateFromInt(val)
+	c.db.data.Set(key, newObj)
+	newObj.DecrRefCount()
+	server.dirty++
+	c.AddReplyInt(val)
+}
+
+func incrbyfloatCommand(c *GodisClient) {
+	incr, ok := getFloatOrReply(c, c.args[2])
+	if !ok {
+		return
+	}
+	key := c.args[1]
+	o := c.db.findKeyRead(key)
+	if o != nil && !checkType(c, o, GSTR) {
+		return
+	}
+	var val float64
+	if o != nil {
+		var err error
+		if val, err = strconv.ParseFloat(o.StrVal(), 64); err != nil || math.IsNaN(val) {
+			c.AddReplyStr(shared.notFloat)
+			return
+		}
+	}
+	val += incr
+	if math.IsNaN(val) || math.IsInf(val, 0) {
+		c.AddReplyError("increment would produce NaN or Infinity")
+		return
+	}
+	newObj := CreateObject(GSTR, formatFloatHuman(val))
+	c.db.data.Set(key, newObj)
+	server.dirty++
+	c.AddReplyBulk(newObj)
+	// 避免重放时浮点数计算结果不同
+	rewriteClientCommand(c, "SET", key.StrVal(), newObj.StrVal(), "KEEPTTL")
+	newObj.DecrRefCount()
+}
+
+// 查找字符串用于读取，key不存在时回复empty
+func findStringOrReply(c *GodisClient, key *Gobj, empty string) *Gobj {
+	o := c.db.findKeyRead(key)
+	if o == nil {
+		c.AddReplyStr(empty)
+		return nil
+	}
+	if !checkType(c, o, GSTR) {
+		return nil
+	}
+	return o
+}
+
+func checkStringLength(c *GodisClient, size int64) bool {
+	if size > STRING_MAX_LEN {
+		c.AddReplyError("string exceeds maximum allowed size (proto-max-bulk-len)")
+		return false
+	}
+	return true
+}
+
+func appendCommand(c *GodisClient) {
+	key := c.args[1]
+	o := c.db.findKeyRead(key)
+	if o == nil {
+		c.db.data.Set(key, c.args[2])
+		server.dirty++
+		c.AddReplyInt(int64(len(c.args[2].StrVal())))
+		return
+	}
+	if !checkType(c, o, GSTR) {
+		return
+	}
+	str := o.StrVal() + c.args[2].StrVal()
+	if !checkStringLength(c, int64(len(str))) {
+		return
+	}
+	newObj := CreateObject(GSTR, str)
+	c.db.data.Set(key, newObj)
+	newObj.DecrRefCount()
+	server.dirty++
+	c.AddReplyInt(int64(len(str)))
+}
+
+func strlenCommand(c *GodisClient) {
+	o := findStringOrReply(c, c.args[1], shared.czero)
+	if o == nil {
+		return
+	}
+	c.AddReplyInt(int64(len(o.StrVal())))
+}
+
+func getrangeCommand(c *GodisClient) {
+	start, ok := getIntOrReply(c, c.args[2])
+	if !ok {
+		return
+	}
+	end, ok := getIntOrReply(c, c.args[3])
+	if !ok {
+		return
+	}
+	o := findStringOrReply(c, c.args[1], shared.emptyBulk)
+	if o == nil {
+		return
+	}
+	str := o.StrVal()
+	strlen := int64(len(str))
+	if start < 0 && end < 0 && start > end {
+		c.AddReplyStr(shared.emptyBulk)
+		return
+	}
+	if start < 0 {
+		start += strlen
+	}
+	if end < 0 {
+		end += strlen
+	}
+	if start < 0 {
+		start = 0
+	}
+	if end < 0 {
+		end = 0
+	}
+	if end >= strlen {
+		end = strlen - 1
+	}
+	if strlen == 0 || start > end {
+		c.AddReplyStr(shared.emptyBulk)
+		return
+	}
+	c.AddReplyBulkStr(str[start : end+1])
+}
+
+// 从offset开始覆盖，超出原长度的部分用0填充
+func setrangeCommand(c *GodisClient) {
+	offset, ok := getIntOrReply(c, c.args[2])
+	if !ok {
+		return
+	}
+	if offset < 0 {
+		c.AddReplyError("offset is out of range")
+		return
+	}
+	key := c.args[1]
+	value := c.args[3].StrVal()
+	o := c.db.findKeyRead(key)
+	if o != nil && !checkType(c, o, GSTR) {
+		return
+	}
+	var str string
+	if o != nil {
+		str = o.StrVal()
+	}
+	// value为空时不修改，也不会创建key
+	if len(value) == 0 {
+		c.AddReplyInt(int64(len(str)))
+		return
+	}
+	if !checkStringLength(c, offset+int64(len(value))) {
+		return
+	}
+	buf := []byte(str)
+	if need := int(offset) + len(value); need > len(buf) {
+		buf = append(buf, make([]byte, need-len(buf))...)
+	}
+	copy(buf[offset:], value)
+	newObj := CreateObject(GSTR, string(buf))
+	c.db.data.Set(key, newObj)
+	newObj.DecrRefCount()
+	server.dirty++
+	c.AddReplyInt(int64(len(buf)))
+}
+
+func getdelCommand(c *GodisClient) {
+	key := c.args[1]
+	o := findStringOrReply(c, key, shared.nullBulk)
+	if o == nil {
+		return
+	}
+	c.AddReplyBulk(o)
+	c.db.deleteKey(key)
+	server.dirty++
+}
+
+// GETEX key [EX seconds | PX milliseconds | EXAT timestamp | PXAT ms-timestamp | PERSIST]
+func getexCommand(c *GodisClient) {
+	var opt string
+	var when int64
+	for i := 2; i < len(c.args); i++ {
+		arg := strings.ToLower(c.args[i].StrVal())
+		if opt != "" {
+			c.AddReplyStr(shared.syntaxErr)
+			return
+		}
+		switch arg {
+		case "persist":
+			opt = arg
+		case "ex", "px", "exat", "pxat":
+			if i+1 >= len(c.args) {
+				c.AddReplyStr(shared.syntaxErr)
+				return
+			}
+			opt = arg
+			i++
+			var ok bool
+			if when, ok = getExpireTimeOrReply(c, c.args[i], opt); !ok {
+				return
+			}
+		default:
+			c.AddReplyStr(shared.syntaxErr)
+			return
+		}
+	}
+	key := c.args[1]
+	o := findStringOrReply(c, key, shared.nullBulk)
+	if o == nil {
+		return
+	}
+	c.AddReplyBulk(o)
+	switch {
+	case opt == "persist":
+		// 没有过期时间时不算修改
+		if c.db.expire.Delete(key) == nil {
+			server.dirty++
+			rewriteClientCommand(c, "PERSIST", key.StrVal())
+		}
+	case opt != "" && when <= GetMsTime():
+		c.db.deleteKey(key)
+		server.dirty++
+		rewriteClientCommand(c, "DEL", key.StrVal())
+	case opt != "":
+		c.db.setExpire(key, when)
+		server.dirty++
+		rewriteClientCommand(c, "PEXPIREAT", key.StrVal(), strconv.FormatInt(when, 10))
+	}
+}
+
+// 将EX/PX/EXAT/PXAT参数转换为毫秒时间戳
+func getExpireTimeOrReply(c *GodisClient, o *Gobj, unit string) (int64, bool) {
+	val, ok := getIntOrReply(c, o)
+	if !ok {
+		return 0, false
+	}
+	invalid := val <= 0
+	if unit == "ex" || unit == "exat" {
+		if val > math.MaxInt64/1000 {
+			invalid = true
+		}
+		val *= 1000
+	}
+	if unit == "ex" || unit == "px" {
+		if val > math.MaxInt64-GetMsTime() {
+			invalid = true
+		}
+		val += GetMsTime()
+	}
+	if invalid {
+		c.AddReplyError(fmt.Sprintf("invalid expire time in '%v' command", c.args[0].StrVal()))
+		return 0, false
+	}
+	return val, true
+}
+
+func getsetCommand(c *GodisClient) {
+	key := c.args[1]
+	o := c.db.findKeyRead(key)
+	if o == nil {
+		c.AddReplyStr(shared.nullBulk)
+	} else if !checkType(c, o, GSTR) {
+		return
+	} else {
+		c.AddReplyBulk(o)
+	}
+	c.db.setKey(key, c.args[2])
+	server.dirty++
+}
+
+// 不存在或类型不是字符串的key都回复nil
+func mgetCommand(c *GodisClient) {
+	keys := c.args[1:]
+	c.AddReplyArrayLen(len(keys))
+	for _, key := range keys {
+		o := c.db.findKeyRead(key)
+		if o == nil || o.Type_ != GSTR {
+			c.AddReplyStr(shared.nullBulk)
+		} else {
+			c.AddReplyBulk(o)
+		}
+	}
+}
+
+func msetCommand(c *GodisClient) {
+	msetGenericCommand(c, false)
+}
+
+func msetnxCommand(c *GodisClient) {
+	msetGenericCommand(c, true)
+}
+
+// nx为true时，只要有一个key存在就不设置任何key
+func msetGenericCommand(c *GodisClient, nx bool) {
+	if len(c.args)%2 != 1 {
+		c.AddReplyError(fmt.Sprintf("wrong number of arguments for '%v' command", strings.ToLower(c.args[0].StrVal())))
+		return
+	}
+	if nx {
+		for i := 1; i < len(c.args); i += 2 {
+			if c.db.findKeyRead(c.args[i]) != nil {
+				c.AddReplyStr(shared.czero)
+				return
+			}
+		}
+	}
+	for i := 1; i < len(c.args); i += 2 {
+		c.db.setKey(c.args[i], c.args[i+1])
+	}
+	server.dirty += int64(len(c.args) / 2)
+	if nx {
+		c.AddReplyStr(shared.cone)
+	} else {
+		c.AddReplyStr(shared.ok)
+	}
+}
+
+// LCS key1 key2 [LEN] [IDX] [MINMATCHLEN len] [WITHMATCHLEN]
+func lcsCommand(c *GodisClient) {
+	var getLen, getIdx, withMatchLen bool
+	var minMatchLen int64
+	for i := 3; i < len(c.args); i++ {
+		switch strings.ToLower(c.args[i].StrVal()) {
+		case "len":
+			getLen = true
+		case "idx":
+			getIdx = true
+		case "withmatchlen":
+			withMatchLen = true
+		case "minmatchlen":
+			if i+1 >= len(c.args) {
+				c.AddReplyStr(shared.syntaxErr)
+				return
+			}
+			i++
+			var ok bool
+			if minMatchLen, ok = getIntOrReply(c, c.args[i]); !ok {
+				return
+			}
+			if minMatchLen < 0 {
+				minMatchLen = 0
+			}
+		default:
+			c.AddReplyStr(shared.syntaxErr)
+			return
+		}
+	}
+	if getLen && getIdx {
+		c.AddReplyError("If you want both the length and indexes, please just use IDX.")
+		return
+	}
+	var strs [2]string
+	for i, key := range c.args[1:3] {
+		o := c.db.findKeyRead(key)
+		if o == nil {
+			continue
+		}
+		if o.Type_ != GSTR {
+			c.AddReplyError("The specified keys must contain string values")
+			return
+		}
+		strs[i] = o.StrVal()
+	}
+	a, b := strs[0], strs[1]
+	alen, blen := len(a), len(b)
+	// dp表的大小与两个字符串长度的乘积成正比，超过proto-max-bulk-len时拒绝，避免溢出或耗尽内存
+	dpSize := uint64(alen+1) * uint64(blen+1)
+	if dpSize/uint64(alen+1) != uint64(blen+1) || dpSize > STRING_MAX_LEN/4 {
+		c.AddReplyError("Insufficient memory, transient memory for LCS exceeds proto-max-bulk-len")
+		return
+	}
+	// dp[i][j]为a[:i]与b[:j]的最长公共子序列长度
+	dp := make([]uint32, (alen+1)*(blen+1))
+	lcs := func(i, j int) uint32 {
+		return dp[i*(blen+1)+j]
+	}
+	for i := 1; i <= alen; i++ {
+		for j := 1; j <= blen; j++ {
+			if a[i-1] == b[j-1] {
+				dp[i*(blen+1)+j] = lcs(i-1, j-1) + 1
+			} else if lcs(i-1, j) > lcs(i, j-1) {
+				dp[i*(blen+1)+j] = lcs(i-1, j)
+			} else {
+				dp[i*(blen+1)+j] = lcs(i, j-1)
+			}
+		}
+	}
+	total := int(lcs(alen, blen))
+	if getLen {
+		c.AddReplyInt(int64(total))
+		return
+	}
+	// 从尾部回溯，得到公共子序列以及每一段连续匹配的区间
+	result := make([]byte, total)
+	var matches [][4]int
+	idx := total
+	i, j := alen, blen
+	astart, aend, bstart, bend := alen, 0, 0, 0
+	for i > 0 && j > 0 {
+		emit := false
+		if a[i-1] == b[j-1] {
+			result[idx-1] = a[i-1]
+			if astart == alen {
+				astart, aend, bstart, bend = i-1, i-1, j-1, j-1
+			} else if astart == i && bstart == j {
+				astart--
+				bstart--
+			} else {
+				emit = true
+			}
+			if astart == 0 || bstart == 0 {
+				emit = true
+			}
+			idx--
+			i--
+			j--
+		} else {
+			if lcs(i-1, j) > lcs(i, j-1) {
+				i--
+			} else {
+				j--
+			}
+			if astart != alen {
+				emit = true
+			}
+		}
+		if emit {
+			if int64(aend-astart+1) >= minMatchLen {
+				matches = append(matches, [4]int{astart, aend, bstart, bend})
+			}
+			astart = alen
+		}
+	}
+	if !getIdx {
+		c.AddReplyBulkStr(string(result))
+		return
+	}
+	c.AddReplyArrayLen(4)
+	c.AddReplyBulkStr("matches")
+	c.AddReplyArrayLen(len(matches))
+	for _, m := range matches {
+		if withMatchLen {
+			c.AddReplyArrayLen(3)
+		} else {
+			c.AddReplyArrayLen(2)
+		}
+		c.AddReplyArrayLen(2)
+		c.AddReplyInt(int64(m[0]))
+		c.AddReplyInt(int64(m[1]))
+		c.AddReplyArrayLen(2)
+		c.AddReplyInt(int64(m[2]))
+		c.AddReplyInt(int64(m[3]))
+		if withMatchLen {
+			c.AddReplyInt(int64(m[1] - m[0] + 1))
+		}
+	}
+	c.AddReplyBulkStr("len")
+	c.AddReplyInt(int64(total))
+}
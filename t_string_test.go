@@ -0,0 +1,168 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIncrDecr(t *testing.T) {
+	client := newTestClient()
+	assert.Equal(t, ":1\r\n", execCommand(client, "incr n"))
+	assert.Equal(t, ":11\r\n", execCommand(client, "incrby n 10"))
+	assert.Equal(t, ":10\r\n", execCommand(client, "decr n"))
+	assert.Equal(t, ":-5\r\n", execCommand(client, "decrby n 15"))
+	assert.Equal(t, "$2\r\n-5\r\n", execCommand(client, "get n"))
+	assert.Equal(t, shared.notInteger, execCommand(client, "incrby n x"))
+
+	execCommand(client, "set s abc")
+	assert.Equal(t, shared.notInteger, execCommand(client, "incr s"))
+	execCommand(client, "set f 1.5")
+	assert.Equal(t, shared.notInteger, execCommand(client, "decr f"))
+	execCommand(client, "set max 9223372036854775807")
+	assert.Equal(t, "-ERR increment or decrement would overflow\r\n", execCommand(client, "incr max"))
+	execCommand(client, "set min -9223372036854775808")
+	assert.Equal(t, "-ERR increment or decrement would overflow\r\n", execCommand(client, "decr min"))
+	assert.Equal(t, "-ERR decrement would overflow\r\n", execCommand(client, "decrby n -9223372036854775808"))
+	execCommand(client, "rpush l a")
+	assert.Equal(t, shared.wrongType, execCommand(client, "incr l"))
+}
+
+func TestIncrByFloat(t *testing.T) {
+	client := newTestClient()
+	assert.Equal(t, "$4\r\n10.5\r\n", execCommand(client, "incrbyfloat f 10.5"))
+	assert.Equal(t, "$4\r\n10.6\r\n", execCommand(client, "incrbyfloat f 0.1"))
+	assert.Equal(t, "$4\r\n5000\r\n", execCommand(client, "incrbyfloat f 4989.4"))
+	assert.Equal(t, "$4\r\n5200\r\n", execCommand(client, "incrbyfloat f 2.0e2"))
+	assert.Equal(t, "$1\r\n0\r\n", execCommand(client, "incrbyfloat f -5200"))
+	assert.Equal(t, "$22\r\n1000000000000000000000\r\n", execCommand(client, "incrbyfloat big 1e21"))
+	assert.Equal(t, "$9\r\n0.0000001\r\n", execCommand(client, "incrbyfloat small 1e-7"))
+	assert.Equal(t, shared.notFloat, execCommand(client, "incrbyfloat f x"))
+	assert.Equal(t, "-ERR increment would produce NaN or Infinity\r\n", execCommand(client, "incrbyfloat f inf"))
+	execCommand(client, "set s abc")
+	assert.Equal(t, shared.notFloat, execCommand(client, "incrbyfloat s 1"))
+	execCommand(client, "set n 3")
+	assert.Equal(t, "$3\r\n3.5\r\n", execCommand(client, "incrbyfloat n 0.5"))
+}
+
+func TestStringRange(t *testing.T) {
+	client := newTestClient()
+	assert.Equal(t, ":5\r\n", execCommand(client, "append s hello"))
+	assert.Equal(t, ":11\r\n", execCommand(client, "append s _world"))
+	assert.Equal(t, ":11\r\n", execCommand(client, "strlen s"))
+	assert.Equal(t, ":0\r\n", execCommand(client, "strlen none"))
+	assert.Equal(t, "$5\r\nhello\r\n", execCommand(client, "getrange s 0 4"))
+	assert.Equal(t, "$5\r\nworld\r\n", execCommand(client, "getrange s -5 -1"))
+	assert.Equal(t, "$11\r\nhello_world\r\n", execCommand(client, "getrange s 0 100"))
+	assert.Equal(t, shared.emptyBulk, execCommand(client, "getrange s 5 3"))
+	assert.Equal(t, shared.emptyBulk, execCommand(client, "getrange none 0 -1"))
+
+	assert.Equal(t, ":11\r\n", execCommand(client, "setrange s 6 redis"))
+	assert.Equal(t, "$11\r\nhello_redis\r\n", execCommand(client, "get s"))
+	assert.Equal(t, ":4\r\n", execCommand(client, "setrange pad 2 ab"))
+	assert.Equal(t, "\x00\x00ab", server.dbs[0].data.Get(CreateObject(GSTR, "pad")).StrVal())
+	assert.Equal(t, "-ERR offset is out of range\r\n", execCommand(client, "setrange s -1 x"))
+	assert.Equal(t, "-ERR string exceeds maximum allowed size (proto-max-bulk-len)\r\n", execCommand(client, "setrange s 536870911 xx"))
+
+	execCommand(client, "rpush l a")
+	assert.Equal(t, shared.wrongType, execCommand(client, "append l x"))
+	assert.Equal(t, shared.wrongType, execCommand(client, "strlen l"))
+	assert.Equal(t, shared.wrongType, execCommand(client, "setrange l 0 x"))
+}
+
+func TestGetDelExSet(t *testing.T) {
+	client := newTestClient()
+	execCommand(client, "set k v")
+	assert.Equal(t, "$1\r\nv\r\n", execCommand(client, "getdel k"))
+	assert.Equal(t, shared.nullBulk, execCommand(client, "getdel k"))
+
+	assert.Equal(t, shared.nullBulk, execCommand(client, "getset k v1"))
+	execCommand(client, "expire k 100")
+	k := CreateObject(GSTR, "k")
+	assert.Equal(t, "$2\r\nv1\r\n", execCommand(client, "getset k v2"))
+	assert.Nil(t, server.dbs[0].expire.Get(k))
+
+	assert.Equal(t, "$2\r\nv2\r\n", execCommand(client, "getex k ex 100"))
+	assert.NotNil(t, server.dbs[0].expire.Get(k))
+	assert.Equal(t, "$2\r\nv2\r\n", execCommand(client, "getex k persist"))
+	assert.Nil(t, server.dbs[0].expire.Get(k))
+	execCommand(client, "getex k pxat 1")
+	assert.Equal(t, shared.nullBulk, execCommand(client, "get k"))
+
+	execCommand(client, "set k v")
+	assert.Equal(t, shared.syntaxErr, execCommand(client, "getex k ex 10 persist"))
+	assert.Equal(t, "-ERR invalid expire time in 'getex' command\r\n", execCommand(client, "getex k px 0"))
+	assert.Equal(t, shared.nullBulk, execCommand(client, "getex none ex 10"))
+}
+
+func TestLcs(t *testing.T) {
+	client := newTestClient()
+	execCommand(client, "set key1 ohmytext")
+	execCommand(client, "set key2 mynewtext")
+	assert.Equal(t, "$6\r\nmytext\r\n", execCommand(client, "lcs key1 key2"))
+	assert.Equal(t, ":6\r\n", execCommand(client, "lcs key1 key2 len"))
+	assert.Equal(t, "*4\r\n$7\r\nmatches\r\n*2\r\n*2\r\n*2\r\n:4\r\n:7\r\n*2\r\n:5\r\n:8\r\n*2\r\n*2\r\n:2\r\n:3\r\n*2\r\n:0\r\n:1\r\n$3\r\nlen\r\n:6\r\n",
+		execCommand(client, "lcs key1 key2 idx"))
+	assert.Equal(t, "*4\r\n$7\r\nmatches\r\n*1\r\n*3\r\n*2\r\n:4\r\n:7\r\n*2\r\n:5\r\n:8\r\n:4\r\n$3\r\nlen\r\n:6\r\n",
+		execCommand(client, "lcs key1 key2 idx minmatchlen 4 withmatchlen"))
+	assert.Equal(t, shared.emptyBulk, execCommand(client, "lcs key1 none"))
+	assert.Equal(t, "-ERR If you want both the length and indexes, please just use IDX.\r\n", execCommand(client, "lcs key1 key2 len idx"))
+	execCommand(client, "rpush l a")
+	assert.Equal(t, "-ERR The specified keys must contain string values\r\n", execCommand(client, "lcs key1 l"))
+	execCommand(client, "setrange big1 11999 x")
+	execCommand(client, "setrange big2 11999 y")
+	assert.Equal(t, "-ERR Insufficient memory, transient memory for LCS exceeds proto-max-bulk-len\r\n", execCommand(client, "lcs big1 big2"))
+}
+
+func TestMultiKey(t *testing.T) {
+	client := newTestClient()
+	assert.Equal(t, shared.ok, execCommand(client, "mset a 1 b 2 c 3"))
+	execCommand(client, "rpush l x")
+	assert.Equal(t, "*5\r\n$1\r\n1\r\n$1\r\n2\r\n$-1\r\n$-1\r\n$1\r\n3\r\n", execCommand(client, "mget a b none l c"))
+	assert.Equal(t, "-ERR wrong number of arguments for 'mset' command\r\n", execCommand(client, "mset a 1 b"))
+	assert.Equal(t, "-ERR wrong number of arguments for 'msetnx' command\r\n", execCommand(client, "MSETNX a 1 b"))
+
+	execCommand(client, "expire a 100")
+	execCommand(client, "mset a 10")
+	assert.Nil(t, server.dbs[0].expire.Get(CreateObject(GSTR, "a")))
+
+	assert.Equal(t, shared.czero, execCommand(client, "msetnx d 4 a 5"))
+	assert.Equal(t, "*2\r\n$-1\r\n$2\r\n10\r\n", execCommand(client, "mget d a"))
+	assert.Equal(t, shared.cone, execCommand(client, "msetnx d 4 e 5"))
+	assert.Equal(t, "*2\r\n$1\r\n4\r\n$1\r\n5\r\n", execCommand(client, "mget d e"))
+}
+
+func TestSetOptions(t *testing.T) {
+	client := newTestClient()
+	k := CreateObject(GSTR, "lock")
+	assert.Equal(t, shared.ok, execCommand(client, "set lock t1 nx px 30000"))
+	ttl := server.dbs[0].expire.Get(k).IntVal() - GetMsTime()
+	assert.True(t, ttl > 29000 && ttl <= 30000)
+	assert.Equal(t, shared.nullBulk, execCommand(client, "set lock t2 nx px 30000"))
+	assert.Equal(t, "$2\r\nt1\r\n", execCommand(client, "set lock t2 nx get"))
+	assert.Equal(t, "$2\r\nt1\r\n", execCommand(client, "get lock"))
+
+	assert.Equal(t, shared.ok, execCommand(client, "set lock t3 xx keepttl"))
+	assert.NotNil(t, server.dbs[0].expire.Get(k))
+	assert.Equal(t, "$2\r\nt3\r\n", execCommand(client, "set lock t4 get"))
+	assert.Nil(t, server.dbs[0].expire.Get(k))
+	assert.Equal(t, shared.nullBulk, execCommand(client, "set none v xx"))
+	assert.Equal(t, shared.nullBulk, execCommand(client, "get none"))
+	assert.Equal(t, shared.nullBulk, execCommand(client, "set new v get"))
+
+	assert.Equal(t, shared.ok, execCommand(client, "set lock v exat 1"))
+	assert.Equal(t, shared.nullBulk, execCommand(client, "get lock"))
+	assert.Equal(t, shared.ok, execCommand(client, "set lock v ex 100"))
+	assert.Equal(t, "$1\r\nv\r\n", execCommand(client, "get lock"))
+
+	assert.Equal(t, shared.syntaxErr, execCommand(client, "set k v nx xx"))
+	assert.Equal(t, shared.syntaxErr, execCommand(client, "set k v ex 10 px 100"))
+	assert.Equal(t, shared.syntaxErr, execCommand(client, "set k v ex 10 keepttl"))
+	assert.Equal(t, shared.syntaxErr, execCommand(client, "set k v ex"))
+	assert.Equal(t, "-ERR invalid expire time in 'set' command\r\n", execCommand(client, "set k v ex -1"))
+
+	execCommand(client, "rpush l a")
+	assert.Equal(t, shared.wrongType, execCommand(client, "set l v get"))
+	assert.Equal(t, shared.ok, execCommand(client, "set l v"))
+	assert.Equal(t, "$1\r\nv\r\n", execCommand(client, "get l"))
+}
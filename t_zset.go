@@ -0,0 +1,922 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 有序集合类型的命令实现，value为GZSET类型的Gobj，内部是*ZSet
+
+const (
+	ZRANGE_RANK int = iota
+	ZRANGE_SCORE
+	ZRANGE_LEX
+)
+
+const (
+	ZAGGREGATE_SUM int = iota
+	ZAGGREGATE_MIN
+	ZAGGREGATE_MAX
+)
+
+type zrangeSpec struct {
+	typ        int
+	rev        bool
+	withScores bool
+	start, end int64 // ZRANGE_RANK的范围
+	scoreRange ScoreRange
+	lexRange   LexRange
+	offset     int64
+	limit      int64 // 小于0表示不限制
+}
+
+func createZsetObject() *Gobj {
+	return CreateObject(GZSET, ZSetCreate())
+}
+
+// 查找有序集合用于读取，key不存在时回复empty
+func findZsetOrReply(c *GodisClient, key *Gobj, empty string) *ZSet {
+	zobj := c.db.findKeyRead(key)
+	if zobj == nil {
+		c.AddReplyStr(empty)
+		return nil
+	}
+	if !checkType(c, zobj, GZSET) {
+		return nil
+	}
+	return zobj.Val_.(*ZSet)
+}
+
+func addReplyScore(c *GodisClient, score float64) {
+	c.AddReplyBulkStr(formatFloat(score))
+}
+
+func addReplyNodes(c *GodisClient, nodes []*SkipListNode, withScores bool) {
+	if withScores {
+		c.AddReplyArrayLen(len(nodes) * 2)
+	} else {
+		c.AddReplyArrayLen(len(nodes))
+	}
+	for _, n := range nodes {
+		c.AddReplyBulk(n.Member)
+		if withScores {
+			addReplyScore(c, n.Score)
+		}
+	}
+}
+
+// 解析"(1.5"、"1.5"、"-inf"、"+inf"格式的score范围
+func parseScoreRange(min, max string) (ScoreRange, bool) {
+	var r ScoreRange
+	var err error
+	if strings.HasPrefix(min, "(") {
+		r.MinEx = true
+		min = min[1:]
+	}
+	if strings.HasPrefix(max, "(") {
+		r.MaxEx = true
+		max = max[1:]
+	}
+	if r.Min, err = strconv.ParseFloat(min, 64); err != nil || r.Min != r.Min {
+		return r, false
+	}
+	if r.Max, err = strconv.ParseFloat(max, 64); err != nil || r.Max != r.Max {
+		return r, false
+	}
+	return r, true
+}
+
+func parseLexRange(min, max string) (LexRange, bool) {
+	var r LexRange
+	var ok bool
+	if r.Min, ok = ParseLexBound(min); !ok {
+		return r, false
+	}
+	r.Max, ok = ParseLexBound(max)
+	return r, ok
+}
+
+// ZADD key [NX|XX] [GT|LT] [CH] [INCR] score member [score member ...]
+func zaddCommand(c *GodisClient) {
+	zaddGenericCommand(c, 0)
+}
+
+func zincrbyCommand(c *GodisClient) {
+	zaddGenericCommand(c, ZADD_IN_INCR)
+}
+
+func zaddGenericCommand(c *GodisClient, flags int) {
+	ch := false
+	scoreIdx := 2
+	for ; scoreIdx < len(c.args); scoreIdx++ {
+		opt := strings.ToLower(c.args[scoreIdx].StrVal())
+		if opt == "nx" {
+			flags |= ZADD_IN_NX
+		} else if opt == "xx" {
+			flags |= ZADD_IN_XX
+		} else if opt == "gt" {
+			flags |= ZADD_IN_GT
+		} else if opt == "lt" {
+			flags |= ZADD_IN_LT
+		} else if opt == "ch" {
+			ch = true
+		} else if opt == "incr" {
+			flags |= ZADD_IN_INCR
+		} else {
+			break
+		}
+	}
+	elements := len(c.args) - scoreIdx
+	if elements%2 != 0 || elements == 0 {
+		c.AddReplyStr(shared.syntaxErr)
+		return
+	}
+	elements /= 2
+	incr := flags&ZADD_IN_INCR != 0
+	nx, xx := flags&ZADD_IN_NX != 0, flags&ZADD_IN_XX != 0
+	gt, lt := flags&ZADD_IN_GT != 0, flags&ZADD_IN_LT != 0
+	if nx && xx {
+		c.AddReplyError("XX and NX options at the same time are not compatible")
+		return
+	}
+	if (gt && nx) || (lt && nx) || (gt && lt) {
+		c.AddReplyError("GT, LT, and/or NX options at the same time are not compatible")
+		return
+	}
+	if incr && elements > 1 {
+		c.AddReplyError("INCR option supports a single increment-element pair")
+		return
+	}
+	// 先解析全部score，避免执行到一半出错
+	scores := make([]float64, elements)
+	for i := 0; i < elements; i++ {
+		var ok bool
+		if scores[i], ok = getFloatOrReply(c, c.args[scoreIdx+i*2]); !ok {
+			return
+		}
+	}
+
+	key := c.args[1]
+	zobj := c.db.findKeyWrite(key)
+	if zobj == nil {
+		if xx {
+			if incr {
+				c.AddReplyStr(shared.nullBulk)
+			} else {
+				c.AddReplyStr(shared.czero)
+			}
+			return
+		}
+		zobj = createZsetObject()
+		c.db.data.Set(key, zobj)
+		zobj.DecrRefCount()
+	} else if !checkType(c, zobj, GZSET) {
+		return
+	}
+	zs := zobj.Val_.(*ZSet)
+	var added, updated int64
+	var newScore float64
+	processed := false
+	for i := 0; i < elements; i++ {
+		out, score := zs.Add(scores[i], c.args[scoreIdx+i*2+1], flags)
+		if out&ZADD_OUT_NAN != 0 {
+			c.AddReplyError("resulting score is not a number (NaN)")
+			return
+		}
+		if out&ZADD_OUT_ADDED != 0 {
+			added++
+		}
+		if out&ZADD_OUT_UPDATED != 0 {
+			updated++
+		}
+		if out&ZADD_OUT_NOP == 0 {
+			processed = true
+		}
+		newScore = score
+	}
+	server.dirty += added + updated
+	if zs.Length() == 0 {
+		c.db.deleteKey(key)
+	}
+	if incr {
+		if processed {
+			addReplyScore(c, newScore)
+		} else {
+			c.AddReplyStr(shared.nullBulk)
+		}
+	} else if ch {
+		c.AddReplyInt(added + updated)
+	} else {
+		c.AddReplyInt(added)
+	}
+}
+
+func zremCommand(c *GodisClient) {
+	key := c.args[1]
+	zobj := c.db.findKeyWrite(key)
+	if zobj == nil {
+		c.AddReplyStr(shared.czero)
+		return
+	}
+	if !checkType(c, zobj, GZSET) {
+		return
+	}
+	zs := zobj.Val_.(*ZSet)
+	var deleted int64
+	for _, member := range c.args[2:] {
+		if zs.Delete(member) {
+			deleted++
+		}
+	}
+	if zs.Length() == 0 {
+		c.db.deleteKey(key)
+	}
+	server.dirty += deleted
+	c.AddReplyInt(deleted)
+}
+
+func zscoreCommand(c *GodisClient) {
+	zs := findZsetOrReply(c, c.args[1], shared.nullBulk)
+	if zs == nil {
+		return
+	}
+	score, ok := zs.Score(c.args[2])
+	if !ok {
+		c.AddReplyStr(shared.nullBulk)
+		return
+	}
+	addReplyScore(c, score)
+}
+
+func zmscoreCommand(c *GodisClient) {
+	zobj := c.db.findKeyRead(c.args[1])
+	if zobj != nil && !checkType(c, zobj, GZSET) {
+		return
+	}
+	members := c.args[2:]
+	c.AddReplyArrayLen(len(members))
+	for _, member := range members {
+		if zobj == nil {
+			c.AddReplyStr(shared.nullBulk)
+		} else if score, ok := zobj.Val_.(*ZSet).Score(member); ok {
+			addReplyScore(c, score)
+		} else {
+			c.AddReplyStr(shared.nullBulk)
+		}
+	}
+}
+
+func zcardCommand(c *GodisClient) {
+	zs := findZsetOrReply(c, c.args[1], shared.czero)
+	if zs == nil {
+		return
+	}
+	c.AddReplyInt(zs.Length())
+}
+
+func zcountCommand(c *GodisClient) {
+	r, ok := parseScoreRange(c.args[2].StrVal(), c.args[3].StrVal())
+	if !ok {
+		c.AddReplyError("min or max is not a float")
+		return
+	}
+	zs := findZsetOrReply(c, c.args[1], shared.czero)
+	if zs == nil {
+		return
+	}
+	first := zs.zsl.FirstInRange(&r)
+	if first == nil {
+		c.AddReplyStr(shared.czero)
+		return
+	}
+	last := zs.zsl.LastInRange(&r)
+	c.AddReplyInt(zs.zsl.GetRank(last.Score, last.Member) - zs.zsl.GetRank(first.Score, first.Member) + 1)
+}
+
+func zrankCommand(c *GodisClient) {
+	zrankGenericCommand(c, false)
+}
+
+func zrevrankCommand(c *GodisClient) {
+	zrankGenericCommand(c, true)
+}
+
+// ZRANK key member [WITHSCORE]
+func zrankGenericCommand(c *GodisClient, reverse bool) {
+	if len(c.args) > 4 || (len(c.args) == 4 && strings.ToLower(c.args[3].StrVal()) != "withscore") {
+		c.AddReplyStr(shared.syntaxErr)
+		return
+	}
+	withScore := len(c.args) == 4
+	empty := shared.nullBulk
+	if withScore {
+		empty = shared.nullArray
+	}
+	zs := findZsetOrReply(c, c.args[1], empty)
+	if zs == nil {
+		return
+	}
+	rank := zs.Rank(c.args[2], reverse)
+	if rank < 0 {
+		c.AddReplyStr(empty)
+		return
+	}
+	if withScore {
+		score, _ := zs.Score(c.args[2])
+		c.AddReplyArrayLen(2)
+		c.AddReplyInt(rank)
+		addReplyScore(c, score)
+	} else {
+		c.AddReplyInt(rank)
+	}
+}
+
+// 解析range命令的参数，allowOpts为true时允许BYSCORE、BYLEX和REV
+func parseZrangeSpec(c *GodisClient, min, max *Gobj, opts []*Gobj, spec *zrangeSpec, allowOpts bool) bool {
+	spec.limit = -1
+	hasLimit := false
+	for i := 0; i < len(opts); i++ {
+		opt := strings.ToLower(opts[i].StrVal())
+		if opt == "withscores" {
+			spec.withScores = true
+		} else if opt == "limit" && i+2 < len(opts) {
+			var ok bool
+			if spec.offset, ok = getIntOrReply(c, opts[i+1]); !ok {
+				return false
+			}
+			if spec.limit, ok = getIntOrReply(c, opts[i+2]); !ok {
+				return false
+			}
+			hasLimit = true
+			i += 2
+		} else if allowOpts && opt == "byscore" && spec.typ == ZRANGE_RANK {
+			spec.typ = ZRANGE_SCORE
+		} else if allowOpts && opt == "bylex" && spec.typ == ZRANGE_RANK {
+			spec.typ = ZRANGE_LEX
+		} else if allowOpts && opt == "rev" {
+			spec.rev = true
+		} else {
+			c.AddReplyStr(shared.syntaxErr)
+			return false
+		}
+	}
+	if hasLimit && spec.typ == ZRANGE_RANK {
+		c.AddReplyError("syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX")
+		return false
+	}
+	if spec.withScores && spec.typ == ZRANGE_LEX {
+		c.AddReplyError("syntax error, WITHSCORES not supported in combination with BYLEX")
+		return false
+	}
+	// 逆序时先给出的是max
+	if spec.rev && spec.typ != ZRANGE_RANK {
+		min, max = max, min
+	}
+	var ok bool
+	switch spec.typ {
+	case ZRANGE_RANK:
+		if spec.start, ok = getIntOrReply(c, min); !ok {
+			return false
+		}
+		if spec.end, ok = getIntOrReply(c, max); !ok {
+			return false
+		}
+	case ZRANGE_SCORE:
+		if spec.scoreRange, ok = parseScoreRange(min.StrVal(), max.StrVal()); !ok {
+			c.AddReplyError("min or max is not a float")
+			return false
+		}
+	case ZRANGE_LEX:
+		if spec.lexRange, ok = parseLexRange(min.StrVal(), max.StrVal()); !ok {
+			c.AddReplyError("min or max not valid string range item")
+			return false
+		}
+	}
+	return true
+}
+
+// 按spec取出范围内的结点
+func zrangeNodes(zs *ZSet, spec *zrangeSpec) []*SkipListNode {
+	zsl := zs.zsl
+	nodes := make([]*SkipListNode, 0)
+	if spec.typ == ZRANGE_RANK {
+		llen := zsl.Length()
+		start, end := spec.start, spec.end
+		if start < 0 {
+			start += llen
+		}
+		if end < 0 {
+			end += llen
+		}
+		if start < 0 {
+			start = 0
+		}
+		if start > end || start >= llen {
+			return nodes
+		}
+		if end >= llen {
+			end = llen - 1
+		}
+		var n *SkipListNode
+		if spec.rev {
+			n = zsl.GetByRank(llen - start)
+		} else {
+			n = zsl.GetByRank(start + 1)
+		}
+		for i := start; i <= end; i++ {
+			nodes = append(nodes, n)
+			if spec.rev {
+				n = n.Prev()
+			} else {
+				n = n.Next()
+			}
+		}
+		return nodes
+	}
+
+	if spec.offset < 0 {
+		return nodes
+	}
+	var n *SkipListNode
+	var inRange func(n *SkipListNode) bool
+	if spec.typ == ZRANGE_SCORE {
+		r := &spec.scoreRange
+		if spec.rev {
+			n = zsl.LastInRange(r)
+			inRange = func(n *SkipListNode) bool { return r.gteMin(n.Score) }
+		} else {
+			n = zsl.FirstInRange(r)
+			inRange = func(n *SkipListNode) bool { return r.lteMax(n.Score) }
+		}
+	} else {
+		r := &spec.lexRange
+		if spec.rev {
+			n = zsl.LastInLexRange(r)
+			inRange = func(n *SkipListNode) bool { return r.gteMin(n.Member.StrVal()) }
+		} else {
+			n = zsl.FirstInLexRange(r)
+			inRange = func(n *SkipListNode) bool { return r.lteMax(n.Member.StrVal()) }
+		}
+	}
+	for offset := spec.offset; n != nil && offset > 0; offset-- {
+		if spec.rev {
+			n = n.Prev()
+		} else {
+			n = n.Next()
+		}
+	}
+	for n != nil && inRange(n) && (spec.limit < 0 || int64(len(nodes)) < spec.limit) {
+		nodes = append(nodes, n)
+		if spec.rev {
+			n = n.Prev()
+		} else {
+			n = n.Next()
+		}
+	}
+	return nodes
+}
+
+// ZRANGE key start stop [BYSCORE|BYLEX] [REV] [LIMIT offset count] [WITHSCORES]
+func zrangeCommand(c *GodisClient) {
+	zrangeGenericCommand(c, ZRANGE_RANK, true)
+}
+
+// ZRANGEBYSCORE key min max [WITHSCORES] [LIMIT offset count]
+func zrangebyscoreCommand(c *GodisClient) {
+	zrangeGenericCommand(c, ZRANGE_SCORE, false)
+}
+
+func zrangeGenericCommand(c *GodisClient, typ int, allowOpts bool) {
+	spec := zrangeSpec{typ: typ}
+	if !parseZrangeSpec(c, c.args[2], c.args[3], c.args[4:], &spec, allowOpts) {
+		return
+	}
+	zs := findZsetOrReply(c, c.args[1], shared.emptyArray)
+	if zs == nil {
+		return
+	}
+	addReplyNodes(c, zrangeNodes(zs, &spec), spec.withScores)
+}
+
+// ZRANGESTORE dst src min max [BYSCORE|BYLEX] [REV] [LIMIT offset count]
+func zrangestoreCommand(c *GodisClient) {
+	spec := zrangeSpec{typ: ZRANGE_RANK}
+	if !parseZrangeSpec(c, c.args[3], c.args[4], c.args[5:], &spec, true) {
+		return
+	}
+	if spec.withScores {
+		c.AddReplyStr(shared.syntaxErr)
+		return
+	}
+	zobj := c.db.findKeyRead(c.args[2])
+	if zobj != nil && !checkType(c, zobj, GZSET) {
+		return
+	}
+	dst := ZSetCreate()
+	if zobj != nil {
+		for _, n := range zrangeNodes(zobj.Val_.(*ZSet), &spec) {
+			dst.Add(n.Score, n.Member, 0)
+		}
+	}
+	storeZset(c, c.args[1], dst)
+}
+
+// 保存结果到dstkey并回复元素个数，结果为空时删除dstkey
+func storeZset(c *GodisClient, dstkey *Gobj, zs *ZSet) {
+	if zs.Length() == 0 {
+		if c.db.deleteKey(dstkey) {
+			server.dirty++
+		}
+		c.AddReplyStr(shared.czero)
+		return
+	}
+	o := CreateObject(GZSET, zs)
+	c.db.setKey(dstkey, o)
+	o.DecrRefCount()
+	server.dirty++
+	c.AddReplyInt(zs.Length())
+}
+
+// 参与聚合运算的输入，可以是集合或有序集合，集合的score都为1
+type zsetOpSrc struct {
+	set    *GobjDict
+	zs     *ZSet
+	weight float64
+}
+
+func (src *zsetOpSrc) size() int64 {
+	if src.zs != nil {
+		return src.zs.Length()
+	} else if src.set != nil {
+		return src.set.Size()
+	}
+	return 0
+}
+
+func (src *zsetOpSrc) score(member *Gobj) (float64, bool) {
+	if src.zs != nil {
+		return src.zs.Score(member)
+	} else if src.set != nil && src.set.Find(member) != nil {
+		return 1, true
+	}
+	return 0, false
+}
+
+func (src *zsetOpSrc) forEach(fn func(member *Gobj, score float64)) {
+	if src.zs != nil {
+		for n := src.zs.zsl.First(); n != nil; n = n.Next() {
+			fn(n.Member, n.Score)
+		}
+	} else if src.set != nil {
+		src.set.forEach(func(e *GobjEntry) {
+			fn(e.Key, 1)
+		})
+	}
+}
+
+// 乘以权重，inf * 0的结果为0
+func weightedScore(score, weight float64) float64 {
+	val := score * weight
+	if math.IsNaN(val) {
+		return 0
+	}
+	return val
+}
+
+func aggregateScore(aggregate int, target, val float64) float64 {
+	switch aggregate {
+	case ZAGGREGATE_MIN:
+		return math.Min(target, val)
+	case ZAGGREGATE_MAX:
+		return math.Max(target, val)
+	}
+	// inf + -inf的结果为0
+	if sum := target + val; !math.IsNaN(sum) {
+		return sum
+	}
+	return 0
+}
+
+func zunionCommand(c *GodisClient) {
+	zsetOperationGenericCommand(c, nil, 1, SET_OP_UNION)
+}
+
+func zinterCommand(c *GodisClient) {
+	zsetOperationGenericCommand(c, nil, 1, SET_OP_INTER)
+}
+
+func zdiffCommand(c *GodisClient) {
+	zsetOperationGenericCommand(c, nil, 1, SET_OP_DIFF)
+}
+
+func zunionstoreCommand(c *GodisClient) {
+	zsetOperationGenericCommand(c, c.args[1], 2, SET_OP_UNION)
+}
+
+func zinterstoreCommand(c *GodisClient) {
+	zsetOperationGenericCommand(c, c.args[1], 2, SET_OP_INTER)
+}
+
+func zdiffstoreCommand(c *GodisClient) {
+	zsetOperationGenericCommand(c, c.args[1], 2, SET_OP_DIFF)
+}
+
+// ZUNION numkeys key [key ...] [WEIGHTS weight [weight ...]] [AGGREGATE SUM|MIN|MAX] [WITHSCORES]
+// dstkey不为nil时为STORE命令，ZDIFF不支持WEIGHTS和AGGREGATE
+func zsetOperationGenericCommand(c *GodisClient, dstkey *Gobj, numkeysIdx int, op int) {
+	numkeys, ok := getIntOrReply(c, c.args[numkeysIdx])
+	if !ok {
+		return
+	}
+	if numkeys <= 0 {
+		c.AddReplyError(fmt.Sprintf("at least 1 input key is needed for '%v' command", strings.ToLower(c.args[0].StrVal())))
+		return
+	}
+	if numkeys > int64(len(c.args)-numkeysIdx-1) {
+		c.AddReplyStr(shared.syntaxErr)
+		return
+	}
+	keys := c.args[numkeysIdx+1 : numkeysIdx+1+int(numkeys)]
+	srcs := make([]*zsetOpSrc, numkeys)
+	for i, key := range keys {
+		srcs[i] = &zsetOpSrc{weight: 1}
+		o := c.db.findKeyRead(key)
+		if o == nil {
+			continue
+		}
+		if o.Type_ == GZSET {
+			srcs[i].zs = o.Val_.(*ZSet)
+		} else if o.Type_ == GSET {
+			srcs[i].set = o.Val_.(*GobjDict)
+		} else {
+			c.AddReplyStr(shared.wrongType)
+			return
+		}
+	}
+
+	aggregate := ZAGGREGATE_SUM
+	withScores := false
+	opts := c.args[numkeysIdx+1+int(numkeys):]
+	for i := 0; i < len(opts); i++ {
+		opt := strings.ToLower(opts[i].StrVal())
+		remaining := len(opts) - i - 1
+		if op != SET_OP_DIFF && opt == "weights" && remaining >= int(numkeys) {
+			for j := range srcs {
+				w, err := strconv.ParseFloat(opts[i+1+j].StrVal(), 64)
+				if err != nil || math.IsNaN(w) {
+					c.AddReplyError("weight value is not a float")
+					return
+				}
+				srcs[j].weight = w
+			}
+			i += int(numkeys)
+		} else if op != SET_OP_DIFF && opt == "aggregate" && remaining >= 1 {
+			switch strings.ToLower(opts[i+1].StrVal()) {
+			case "sum":
+				aggregate = ZAGGREGATE_SUM
+			case "min":
+				aggregate = ZAGGREGATE_MIN
+			case "max":
+				aggregate = ZAGGREGATE_MAX
+			default:
+				c.AddReplyStr(shared.syntaxErr)
+				return
+			}
+			i++
+		} else if dstkey == nil && opt == "withscores" {
+			withScores = true
+		} else {
+			c.AddReplyStr(shared.syntaxErr)
+			return
+		}
+	}
+
+	dst := zsetOperation(srcs, op, aggregate)
+	if dstkey != nil {
+		storeZset(c, dstkey, dst)
+		return
+	}
+	nodes := make([]*SkipListNode, 0, dst.Length())
+	for n := dst.zsl.First(); n != nil; n = n.Next() {
+		nodes = append(nodes, n)
+	}
+	addReplyNodes(c, nodes, withScores)
+}
+
+func zsetOperation(srcs []*zsetOpSrc, op int, aggregate int) *ZSet {
+	dst := ZSetCreate()
+	switch op {
+	case SET_OP_UNION:
+		// 先在map中聚合，最后再插入skiplist
+		scores := make(map[string]float64)
+		members := make([]*Gobj, 0)
+		for _, src := range srcs {
+			src.forEach(func(member *Gobj, score float64) {
+				score = weightedScore(score, src.weight)
+				if cur, ok := scores[member.StrVal()]; ok {
+					scores[member.StrVal()] = aggregateScore(aggregate, cur, score)
+				} else {
+					scores[member.StrVal()] = score
+					members = append(members, member)
+				}
+			})
+		}
+		for _, member := range members {
+			dst.Add(scores[member.StrVal()], member, 0)
+		}
+	case SET_OP_INTER:
+		// 从最小的输入开始遍历
+		sorted := make([]*zsetOpSrc, len(srcs))
+		copy(sorted, srcs)
+		sort.Slice(sorted, func(i, j int) bool {
+			return sorted[i].size() < sorted[j].size()
+		})
+		sorted[0].forEach(func(member *Gobj, score float64) {
+			score = weightedScore(score, sorted[0].weight)
+			for _, src := range sorted[1:] {
+				other, ok := src.score(member)
+				if !ok {
+					return
+				}
+				score = aggregateScore(aggregate, score, weightedScore(other, src.weight))
+			}
+			dst.Add(score, member, 0)
+		})
+	case SET_OP_DIFF:
+		srcs[0].forEach(func(member *Gobj, score float64) {
+			for _, src := range srcs[1:] {
+				if _, ok := src.score(member); ok {
+					return
+				}
+			}
+			dst.Add(score, member, 0)
+		})
+	}
+	return dst
+}
+
+func zremrangebyrankCommand(c *GodisClient) {
+	zremrangeGenericCommand(c, ZRANGE_RANK)
+}
+
+func zremrangebyscoreCommand(c *GodisClient) {
+	zremrangeGenericCommand(c, ZRANGE_SCORE)
+}
+
+func zremrangebylexCommand(c *GodisClient) {
+	zremrangeGenericCommand(c, ZRANGE_LEX)
+}
+
+func zremrangeGenericCommand(c *GodisClient, typ int) {
+	spec := zrangeSpec{typ: typ}
+	if !parseZrangeSpec(c, c.args[2], c.args[3], nil, &spec, false) {
+		return
+	}
+	key := c.args[1]
+	zobj := c.db.findKeyWrite(key)
+	if zobj == nil {
+		c.AddReplyStr(shared.czero)
+		return
+	}
+	if !checkType(c, zobj, GZSET) {
+		return
+	}
+	zs := zobj.Val_.(*ZSet)
+	var deleted int64
+	switch typ {
+	case ZRANGE_RANK:
+		llen := zs.Length()
+		start, end := spec.start, spec.end
+		if start < 0 {
+			start += llen
+		}
+		if end < 0 {
+			end += llen
+		}
+		if start < 0 {
+			start = 0
+		}
+		if start <= end && start < llen {
+			if end >= llen {
+				end = llen - 1
+			}
+			deleted = zs.zsl.DeleteRangeByRank(start+1, end+1, zs.dict)
+		}
+	case ZRANGE_SCORE:
+		deleted = zs.zsl.DeleteRangeByScore(&spec.scoreRange, zs.dict)
+	case ZRANGE_LEX:
+		deleted = zs.zsl.DeleteRangeByLex(&spec.lexRange, zs.dict)
+	}
+	if zs.Length() == 0 {
+		c.db.deleteKey(key)
+	}
+	server.dirty += deleted
+	c.AddReplyInt(deleted)
+}
+
+func zpopminCommand(c *GodisClient) {
+	zpopGenericCommand(c, false)
+}
+
+func zpopmaxCommand(c *GodisClient) {
+	zpopGenericCommand(c, true)
+}
+
+// ZPOPMIN key [count]
+func zpopGenericCommand(c *GodisClient, max bool) {
+	if len(c.args) > 3 {
+		c.AddReplyStr(shared.syntaxErr)
+		return
+	}
+	count := int64(1)
+	if len(c.args) == 3 {
+		var ok bool
+		if count, ok = getIntOrReply(c, c.args[2]); !ok {
+			return
+		}
+		if count < 0 {
+			c.AddReplyError("value is out of range, must be positive")
+			return
+		}
+	}
+	key := c.args[1]
+	zobj := c.db.findKeyWrite(key)
+	if zobj == nil {
+		c.AddReplyStr(shared.emptyArray)
+		return
+	}
+	if !checkType(c, zobj, GZSET) {
+		return
+	}
+	zs := zobj.Val_.(*ZSet)
+	if count > zs.Length() {
+		count = zs.Length()
+	}
+	c.AddReplyArrayLen(int(count * 2))
+	for i := int64(0); i < count; i++ {
+		var n *SkipListNode
+		if max {
+			n = zs.zsl.Last()
+		} else {
+			n = zs.zsl.First()
+		}
+		c.AddReplyBulk(n.Member)
+		addReplyScore(c, n.Score)
+		zs.Delete(n.Member)
+	}
+	server.dirty += count
+	if zs.Length() == 0 {
+		c.db.deleteKey(key)
+	}
+}
+
+// ZRANDMEMBER key [count [WITHSCORES]]，count为负数时允许重复
+func zrandmemberCommand(c *GodisClient) {
+	if len(c.args) == 2 {
+		zs := findZsetOrReply(c, c.args[1], shared.nullBulk)
+		if zs == nil {
+			return
+		}
+		c.AddReplyBulk(zs.dict.RandomGet().Key)
+		return
+	}
+	if len(c.args) > 4 || (len(c.args) == 4 && strings.ToLower(c.args[3].StrVal()) != "withscores") {
+		c.AddReplyStr(shared.syntaxErr)
+		return
+	}
+	withScores := len(c.args) == 4
+	count, ok := getRangeIntOrReply(c, c.args[2], -RAND_COUNT_MAX, math.MaxInt64)
+	if !ok {
+		return
+	}
+	zs := findZsetOrReply(c, c.args[1], shared.emptyArray)
+	if zs == nil {
+		return
+	}
+	var entries []*GobjEntry
+	if count >= 0 {
+		entries = zs.dict.RandomDistinct(count)
+	} else {
+		for i := int64(0); i < -count; i++ {
+			entries = append(entries, zs.dict.RandomGet())
+		}
+	}
+	if withScores {
+		c.AddReplyArrayLen(len(entries) * 2)
+	} else {
+		c.AddReplyArrayLen(len(entries))
+	}
+	for _, e := range entries {
+		c.AddReplyBulk(e.Key)
+		if withScores {
+			c.AddReplyBulk(e.Val)
+		}
+	}
+}
+
+func zscanCommand(c *GodisClient) {
+	scanKeyGenericCommand(c, GZSET)
+}
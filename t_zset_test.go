@@ -0,0 +1,162 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestZsetAdd(t *testing.T) {
+	client := newTestClient()
+	assert.Equal(t, ":3\r\n", execCommand(client, "zadd z 1 a 2 b 3 c"))
+	assert.Equal(t, ":0\r\n", execCommand(client, "zadd z 5 a"))
+	assert.Equal(t, ":1\r\n", execCommand(client, "zadd z ch 6 a 2 b"))
+	assert.Equal(t, ":0\r\n", execCommand(client, "zadd z nx 1 a"))
+	assert.Equal(t, ":0\r\n", execCommand(client, "zadd z xx 1 d"))
+	assert.Equal(t, ":1\r\n", execCommand(client, "zadd z gt ch 7 a"))
+	assert.Equal(t, ":0\r\n", execCommand(client, "zadd z gt ch 1 a"))
+	assert.Equal(t, ":1\r\n", execCommand(client, "zadd z lt ch 1 a"))
+	assert.Equal(t, "$3\r\n3.5\r\n", execCommand(client, "zadd z incr 2.5 a"))
+	assert.Equal(t, "$-1\r\n", execCommand(client, "zadd z nx incr 1 a"))
+	assert.Equal(t, "$1\r\n4\r\n", execCommand(client, "zincrby z 0.5 a"))
+	assert.Equal(t, "$1\r\n4\r\n", execCommand(client, "zscore z a"))
+	assert.Equal(t, "$-1\r\n", execCommand(client, "zscore z d"))
+	assert.Equal(t, "*3\r\n$1\r\n4\r\n$-1\r\n$1\r\n2\r\n", execCommand(client, "zmscore z a d b"))
+	assert.Equal(t, ":3\r\n", execCommand(client, "zcard z"))
+
+	assert.Equal(t, shared.syntaxErr, execCommand(client, "zadd z 1 a 2"))
+	assert.Equal(t, shared.notFloat, execCommand(client, "zadd z x a"))
+	assert.Equal(t, "-ERR XX and NX options at the same time are not compatible\r\n", execCommand(client, "zadd z nx xx 1 a"))
+	assert.Equal(t, "-ERR GT, LT, and/or NX options at the same time are not compatible\r\n", execCommand(client, "zadd z gt lt 1 a"))
+	assert.Equal(t, "-ERR INCR option supports a single increment-element pair\r\n", execCommand(client, "zadd z incr 1 a 2 b"))
+	execCommand(client, "zadd z inf i")
+	assert.Equal(t, "-ERR resulting score is not a number (NaN)\r\n", execCommand(client, "zincrby z -inf i"))
+
+	assert.Equal(t, ":2\r\n", execCommand(client, "zrem z a i d"))
+	assert.Equal(t, ":2\r\n", execCommand(client, "zrem z b c"))
+	assert.Equal(t, ":0\r\n", execCommand(client, "zcard z"))
+
+	execCommand(client, "set s v")
+	assert.Equal(t, shared.wrongType, execCommand(client, "zadd s 1 a"))
+	assert.Equal(t, shared.wrongType, execCommand(client, "zscore s a"))
+}
+
+func TestZsetRank(t *testing.T) {
+	client := newTestClient()
+	execCommand(client, "zadd z 1 a 2 b 3 c 4 d")
+	assert.Equal(t, ":1\r\n", execCommand(client, "zrank z b"))
+	assert.Equal(t, ":2\r\n", execCommand(client, "zrevrank z b"))
+	assert.Equal(t, "*2\r\n:0\r\n$1\r\n1\r\n", execCommand(client, "zrank z a withscore"))
+	assert.Equal(t, "$-1\r\n", execCommand(client, "zrank z e"))
+	assert.Equal(t, ":3\r\n", execCommand(client, "zcount z 2 +inf"))
+	assert.Equal(t, ":2\r\n", execCommand(client, "zcount z (1 (4"))
+	assert.Equal(t, ":0\r\n", execCommand(client, "zcount z 5 10"))
+	assert.Equal(t, "-ERR min or max is not a float\r\n", execCommand(client, "zcount z x 10"))
+}
+
+func TestZsetRange(t *testing.T) {
+	client := newTestClient()
+	execCommand(client, "zadd z 1 a 2 b 3 c 4 d 5 e")
+	assert.Equal(t, "*2\r\n$1\r\na\r\n$1\r\nb\r\n", execCommand(client, "zrange z 0 1"))
+	assert.Equal(t, "*4\r\n$1\r\nd\r\n$1\r\n4\r\n$1\r\ne\r\n$1\r\n5\r\n", execCommand(client, "zrange z -2 -1 withscores"))
+	assert.Equal(t, "*2\r\n$1\r\ne\r\n$1\r\nd\r\n", execCommand(client, "zrange z 0 1 rev"))
+	assert.Equal(t, "*0\r\n", execCommand(client, "zrange z 3 1"))
+	assert.Equal(t, "*3\r\n$1\r\nb\r\n$1\r\nc\r\n$1\r\nd\r\n", execCommand(client, "zrange z (1 4 byscore"))
+	assert.Equal(t, "*2\r\n$1\r\nd\r\n$1\r\nc\r\n", execCommand(client, "zrange z 4 (1 byscore rev limit 0 2"))
+	assert.Equal(t, "*2\r\n$1\r\nc\r\n$1\r\nd\r\n", execCommand(client, "zrange z -inf +inf byscore limit 2 2"))
+	assert.Equal(t, "*3\r\n$1\r\nb\r\n$1\r\nc\r\n$1\r\nd\r\n", execCommand(client, "zrangebyscore z 2 4"))
+	assert.Equal(t, "*2\r\n$1\r\nb\r\n$1\r\n2\r\n", execCommand(client, "zrangebyscore z 2 4 withscores limit 0 1"))
+	assert.Equal(t, "*0\r\n", execCommand(client, "zrangebyscore z 2 4 limit -1 1"))
+
+	execCommand(client, "zadd lex 0 a 0 b 0 c 0 d")
+	assert.Equal(t, "*2\r\n$1\r\nb\r\n$1\r\nc\r\n", execCommand(client, "zrange lex [b (d bylex"))
+	assert.Equal(t, "*2\r\n$1\r\nd\r\n$1\r\nc\r\n", execCommand(client, "zrange lex + (b bylex rev"))
+	assert.Equal(t, "*1\r\n$1\r\nb\r\n", execCommand(client, "zrange lex - + bylex limit 1 1"))
+	assert.Equal(t, "-ERR min or max not valid string range item\r\n", execCommand(client, "zrange lex a d bylex"))
+	assert.Equal(t, "-ERR syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX\r\n",
+		execCommand(client, "zrange z 0 1 limit 0 1"))
+	assert.Equal(t, "-ERR syntax error, WITHSCORES not supported in combination with BYLEX\r\n",
+		execCommand(client, "zrange lex - + bylex withscores"))
+	assert.Equal(t, shared.syntaxErr, execCommand(client, "zrangebyscore z 0 1 rev"))
+	assert.Equal(t, "*0\r\n", execCommand(client, "zrange nokey 0 -1"))
+}
+
+func TestZsetRemRange(t *testing.T) {
+	client := newTestClient()
+	execCommand(client, "zadd z 1 a 2 b 3 c 4 d 5 e 6 f")
+	assert.Equal(t, ":2\r\n", execCommand(client, "zremrangebyrank z 0 1"))
+	assert.Equal(t, ":2\r\n", execCommand(client, "zremrangebyscore z (3 5"))
+	assert.Equal(t, "*2\r\n$1\r\nc\r\n$1\r\nf\r\n", execCommand(client, "zrange z 0 -1"))
+	assert.Equal(t, ":1\r\n", execCommand(client, "zremrangebylex z [f +"))
+	assert.Equal(t, ":0\r\n", execCommand(client, "zremrangebyrank z 5 10"))
+	assert.Equal(t, ":1\r\n", execCommand(client, "zremrangebyrank z 0 -1"))
+	assert.Equal(t, ":0\r\n", execCommand(client, "zcard z"))
+}
+
+func TestZsetPopRand(t *testing.T) {
+	client := newTestClient()
+	assert.Equal(t, "*0\r\n", execCommand(client, "zpopmin z"))
+	execCommand(client, "zadd z 1 a 2 b 3 c 4 d")
+	assert.Equal(t, "*2\r\n$1\r\na\r\n$1\r\n1\r\n", execCommand(client, "zpopmin z"))
+	assert.Equal(t, "*4\r\n$1\r\nd\r\n$1\r\n4\r\n$1\r\nc\r\n$1\r\n3\r\n", execCommand(client, "zpopmax z 2"))
+
+	assert.Equal(t, "$1\r\nb\r\n", execCommand(client, "zrandmember z"))
+	assert.Equal(t, "*2\r\n$1\r\nb\r\n$1\r\n2\r\n", execCommand(client, "zrandmember z 5 withscores"))
+	assert.True(t, strings.HasPrefix(execCommand(client, "zrandmember z -3"), "*3\r\n"))
+	assert.Equal(t, "-ERR value is out of range, value must between -1048576 and 9223372036854775807\r\n",
+		execCommand(client, "zrandmember z -9223372036854775808"))
+	assert.Equal(t, "-ERR value is out of range, value must between -1048576 and 9223372036854775807\r\n",
+		execCommand(client, "zrandmember z -4000000000 withscores"))
+	assert.Equal(t, "*2\r\n$1\r\nb\r\n$1\r\n2\r\n", execCommand(client, "zpopmin z 10"))
+	assert.Equal(t, ":0\r\n", execCommand(client, "zcard z"))
+	assert.Equal(t, "$-1\r\n", execCommand(client, "zrandmember z"))
+}
+
+func TestZsetOperation(t *testing.T) {
+	client := newTestClient()
+	execCommand(client, "zadd z1 1 a 2 b 3 c")
+	execCommand(client, "zadd z2 4 b 5 c 6 d")
+	execCommand(client, "sadd s c d")
+	assert.Equal(t, "*8\r\n$1\r\na\r\n$1\r\n1\r\n$1\r\nb\r\n$1\r\n6\r\n$1\r\nd\r\n$1\r\n6\r\n$1\r\nc\r\n$1\r\n8\r\n",
+		execCommand(client, "zunion 2 z1 z2 withscores"))
+	assert.Equal(t, "*4\r\n$1\r\nb\r\n$1\r\n6\r\n$1\r\nc\r\n$1\r\n8\r\n", execCommand(client, "zinter 2 z1 z2 withscores"))
+	assert.Equal(t, "*2\r\n$1\r\nc\r\n$1\r\n9\r\n", execCommand(client, "zinter 3 z1 z2 s withscores"))
+	assert.Equal(t, "*4\r\n$1\r\nb\r\n$1\r\n4\r\n$1\r\nc\r\n$1\r\n5\r\n",
+		execCommand(client, "zinter 2 z1 z2 aggregate max withscores"))
+	assert.Equal(t, "*4\r\n$1\r\nb\r\n$1\r\n2\r\n$1\r\nc\r\n$3\r\n2.5\r\n",
+		execCommand(client, "zinter 2 z1 z2 weights 2 0.5 aggregate min withscores"))
+	assert.Equal(t, "*2\r\n$1\r\na\r\n$1\r\nb\r\n", execCommand(client, "zdiff 2 z1 s"))
+	assert.Equal(t, "*0\r\n", execCommand(client, "zinter 2 z1 nokey"))
+
+	assert.Equal(t, ":4\r\n", execCommand(client, "zunionstore dst 2 z1 z2 aggregate min"))
+	assert.Equal(t, "*8\r\n$1\r\na\r\n$1\r\n1\r\n$1\r\nb\r\n$1\r\n2\r\n$1\r\nc\r\n$1\r\n3\r\n$1\r\nd\r\n$1\r\n6\r\n",
+		execCommand(client, "zrange dst 0 -1 withscores"))
+	assert.Equal(t, ":2\r\n", execCommand(client, "zinterstore dst 2 z1 z2"))
+	assert.Equal(t, ":1\r\n", execCommand(client, "zdiffstore dst 2 z1 z2"))
+	assert.Equal(t, ":0\r\n", execCommand(client, "zdiffstore dst 2 z1 z1"))
+	assert.Equal(t, ":0\r\n", execCommand(client, "zcard dst"))
+
+	assert.Equal(t, "-ERR at least 1 input key is needed for 'zunionstore' command\r\n", execCommand(client, "zunionstore dst 0 z1"))
+	assert.Equal(t, shared.syntaxErr, execCommand(client, "zunion 3 z1 z2"))
+	assert.Equal(t, shared.syntaxErr, execCommand(client, "zunionstore dst 2 z1 z2 withscores"))
+	assert.Equal(t, shared.syntaxErr, execCommand(client, "zdiff 2 z1 z2 weights 1 2"))
+	assert.Equal(t, shared.syntaxErr, execCommand(client, "zunion 2 z1 z2 aggregate avg"))
+	assert.Equal(t, "-ERR weight value is not a float\r\n", execCommand(client, "zunion 2 z1 z2 weights 1 x"))
+	execCommand(client, "set str v")
+	assert.Equal(t, shared.wrongType, execCommand(client, "zunion 2 z1 str"))
+}
+
+func TestZsetRangeStore(t *testing.T) {
+	client := newTestClient()
+	execCommand(client, "zadd z 1 a 2 b 3 c 4 d")
+	assert.Equal(t, ":2\r\n", execCommand(client, "zrangestore dst z 1 2"))
+	assert.Equal(t, "*4\r\n$1\r\nb\r\n$1\r\n2\r\n$1\r\nc\r\n$1\r\n3\r\n", execCommand(client, "zrange dst 0 -1 withscores"))
+	assert.Equal(t, ":3\r\n", execCommand(client, "zrangestore dst z 4 (1 byscore rev"))
+	assert.Equal(t, ":1\r\n", execCommand(client, "zrangestore dst z [a [d bylex limit 3 5"))
+	assert.Equal(t, "*1\r\n$1\r\nd\r\n", execCommand(client, "zrange dst 0 -1"))
+	assert.Equal(t, ":0\r\n", execCommand(client, "zrangestore dst nokey 0 -1"))
+	assert.Equal(t, ":0\r\n", execCommand(client, "zcard dst"))
+	assert.Equal(t, shared.syntaxErr, execCommand(client, "zrangestore dst z 0 -1 withscores"))
+	assert.Equal(t, ":4\r\n", execCommand(client, "zrangestore z z 0 -1"))
+}
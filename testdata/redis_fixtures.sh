@@ -0,0 +1,55 @@
+#!/usr/bin/env bash
+# 用真实的redis-server保存rdb_test.go使用的RDB文件。
+#
+# 用法: testdata/redis_fixtures.sh <redis源码或安装目录>...
+# 目录下需要有redis-server和redis-cli(源码目录下在src中)，例如：
+#   testdata/redis_fixtures.sh ~/redis-5.0.14 ~/redis-7.2.4
+# 每个版本写入testdata/redis<主版本号>.rdb，5.x保存RDB v9，7.x保存RDB v10/v11。
+# 数据集要与rdb_test.go中TestRdbRedisDump的断言保持一致。
+
+set -euo pipefail
+
+HERE=$(cd "$(dirname "$0")" && pwd)
+
+populate() {
+	local cli=$1
+	$cli set str hello
+	$cli set num 12345
+	$cli set neg -1
+	$cli set int32 100000
+	$cli set lzf "$(printf 'a%.0s' $(seq 100))"
+	$cli set ttl v
+	$cli pexpireat ttl 4102444800000
+	# 元素较少时为ziplist/listpack，较多时为quicklist的多个结点
+	$cli rpush list hello 1024 -5 10000000000
+	for i in $(seq 0 599); do echo "rpush biglist element-$(printf '%020d' "$i")"; done | $cli >/dev/null
+	$cli hset hash f1 v1 f2 2
+	for i in $(seq 0 199); do echo "hset bighash field$i value$i"; done | $cli >/dev/null
+	$cli sadd intset 1 2 -3
+	$cli sadd intset64 1099511627776 -1099511627776
+	$cli sadd set a b
+	for i in $(seq 0 199); do echo "sadd bigset member$i"; done | $cli >/dev/null
+	$cli zadd zset 1 a 2.5 b -1.5 c
+	for i in $(seq 0 199); do echo "zadd bigzset $i member$i"; done | $cli >/dev/null
+	$cli -n 2 set db2key v
+}
+
+for dir in "$@"; do
+	bin=$dir
+	[ -x "$bin/src/redis-server" ] && bin=$dir/src
+	version=$("$bin/redis-server" --version | sed -n 's/.*v=\([0-9]*\)\..*/\1/p')
+	tmp=$(mktemp -d)
+	port=$((20000 + RANDOM % 10000))
+	"$bin/redis-server" --port "$port" --dir "$tmp" --dbfilename dump.rdb --save "" --daemonize no \
+		--logfile "$tmp/redis.log" &
+	pid=$!
+	cli="$bin/redis-cli -p $port"
+	until $cli ping >/dev/null 2>&1; do sleep 0.1; done
+	populate "$cli"
+	$cli save >/dev/null
+	kill "$pid"
+	wait "$pid" || true
+	cp "$tmp/dump.rdb" "$HERE/redis$version.rdb"
+	rm -rf "$tmp"
+	echo "wrote testdata/redis$version.rdb ($("$bin/redis-server" --version | sed -n 's/.*\(v=[^ ]*\).*/\1/p'))"
+done
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStringMatch(t *testing.T) {
+	cases := []struct {
+		pattern string
+		str     string
+		match   bool
+	}{
+		{"*", "", false},
+		{"*", "anything", true},
+		{"h?llo", "hello", true},
+		{"h?llo", "hllo", false},
+		{"h*llo", "heeeello", true},
+		{"h*llo", "hllo", true},
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-b]llo", "hbllo", true},
+		{"h[b-a]llo", "hallo", true},
+		{"h[a-b]llo", "hcllo", false},
+		{"h\\*llo", "h*llo", true},
+		{"h\\*llo", "hello", false},
+		{"h[\\]]llo", "h]llo", true},
+		{"user:*:name", "user:1000:name", true},
+		{"user:*:name", "user:1000:age", false},
+		{"a*", "", false},
+		{"a**", "a", true},
+		{"[abc", "a", true},
+		{"ab\\", "ab\\", true},
+	}
+	for _, tc := range cases {
+		assert.Equal(t, tc.match, stringMatch(tc.pattern, tc.str, false), "%v %v", tc.pattern, tc.str)
+	}
+	assert.True(t, stringMatch("H[A-Z]LLO", "hello", true))
+	assert.False(t, stringMatch("H[A-Z]LLO", "hello", false))
+	// 大量的*不会导致指数级回溯
+	assert.False(t, stringMatch(strings.Repeat("a*", 30)+"b", strings.Repeat("a", 60), false))
+}
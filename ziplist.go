@@ -0,0 +1,200 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"strconv"
+)
+
+// redis用于小集合的紧凑编码，godis只在加载RDB时解码，元素都转换为字符串
+
+var errBadEncoding = errors.New("bad ziplist/listpack/intset encoding")
+
+// ziplist: zlbytes(4) zltail(4) zllen(2) entry... 0xff
+// entry: prevlen(1或5) encoding data
+func ziplistEntries(zl []byte) ([]string, error) {
+	if len(zl) < 11 || binary.LittleEndian.Uint32(zl) != uint32(len(zl)) {
+		return nil, errBadEncoding
+	}
+	var entries []string
+	p := 10
+	for {
+		if p >= len(zl) {
+			return nil, errBadEncoding
+		}
+		if zl[p] == 0xff {
+			break
+		}
+		if zl[p] < 0xfe {
+			p++
+		} else {
+			p += 5
+		}
+		if p >= len(zl) {
+			return nil, errBadEncoding
+		}
+		enc := zl[p]
+		var slen, hdr int
+		var val int64
+		isInt := true
+		switch {
+		case enc>>6 == 0:
+			slen, hdr, isInt = int(enc&0x3f), 1, false
+		case enc>>6 == 1:
+			if p+2 > len(zl) {
+				return nil, errBadEncoding
+			}
+			slen, hdr, isInt = int(enc&0x3f)<<8|int(zl[p+1]), 2, false
+		case enc>>6 == 2:
+			if p+5 > len(zl) {
+				return nil, errBadEncoding
+			}
+			slen, hdr, isInt = int(binary.BigEndian.Uint32(zl[p+1:])), 5, false
+		case enc == 0xc0:
+			slen, hdr = 2, 1
+		case enc == 0xd0:
+			slen, hdr = 4, 1
+		case enc == 0xe0:
+			slen, hdr = 8, 1
+		case enc == 0xf0:
+			slen, hdr = 3, 1
+		case enc == 0xfe:
+			slen, hdr = 1, 1
+		case enc >= 0xf1 && enc <= 0xfd:
+			// 0到12的整数直接保存在encoding中
+			slen, hdr, val = 0, 1, int64(enc&0x0f)-1
+		default:
+			return nil, errBadEncoding
+		}
+		p += hdr
+		if slen < 0 || p+slen > len(zl) {
+			return nil, errBadEncoding
+		}
+		data := zl[p : p+slen]
+		p += slen
+		if !isInt {
+			entries = append(entries, string(data))
+			continue
+		}
+		if slen > 0 {
+			val = leInt(data)
+		}
+		entries = append(entries, strconv.FormatInt(val, 10))
+	}
+	return entries, nil
+}
+
+// 小端有符号整数，长度为1到8字节
+func leInt(b []byte) int64 {
+	var u uint64
+	for i := len(b) - 1; i >= 0; i-- {
+		u = u<<8 | uint64(b[i])
+	}
+	shift := 64 - 8*uint(len(b))
+	return int64(u<<shift) >> shift
+}
+
+// listpack: total(4) num(2) entry... 0xff
+// entry: encoding data backlen，backlen为encoding加data的长度，每字节保存7位
+func listpackEntries(lp []byte) ([]string, error) {
+	if len(lp) < 7 || binary.LittleEndian.Uint32(lp) != uint32(len(lp)) {
+		return nil, errBadEncoding
+	}
+	var entries []string
+	p := 6
+	for {
+		if p >= len(lp) {
+			return nil, errBadEncoding
+		}
+		enc := lp[p]
+		if enc == 0xff {
+			break
+		}
+		start := p
+		var slen, hdr, ilen int
+		var val int64
+		isInt := true
+		switch {
+		case enc&0x80 == 0:
+			hdr, val = 1, int64(enc&0x7f)
+		case enc&0xc0 == 0x80:
+			slen, hdr, isInt = int(enc&0x3f), 1, false
+		case enc&0xe0 == 0xc0:
+			// 13位有符号整数
+			if p+2 > len(lp) {
+				return nil, errBadEncoding
+			}
+			hdr, val = 2, int64(enc&0x1f)<<8|int64(lp[p+1])
+			if val >= 1<<12 {
+				val -= 1 << 13
+			}
+		case enc&0xf0 == 0xe0:
+			if p+2 > len(lp) {
+				return nil, errBadEncoding
+			}
+			slen, hdr, isInt = int(enc&0x0f)<<8|int(lp[p+1]), 2, false
+		case enc == 0xf0:
+			if p+5 > len(lp) {
+				return nil, errBadEncoding
+			}
+			slen, hdr, isInt = int(binary.LittleEndian.Uint32(lp[p+1:])), 5, false
+		case enc == 0xf1:
+			hdr, ilen = 1, 2
+		case enc == 0xf2:
+			hdr, ilen = 1, 3
+		case enc == 0xf3:
+			hdr, ilen = 1, 4
+		case enc == 0xf4:
+			hdr, ilen = 1, 8
+		default:
+			return nil, errBadEncoding
+		}
+		p += hdr
+		if slen < 0 || p+slen+ilen > len(lp) {
+			return nil, errBadEncoding
+		}
+		if isInt {
+			if ilen > 0 {
+				val = leInt(lp[p : p+ilen])
+			}
+			p += ilen
+			entries = append(entries, strconv.FormatInt(val, 10))
+		} else {
+			entries = append(entries, string(lp[p:p+slen]))
+			p += slen
+		}
+		p += listpackBacklenSize(p - start)
+	}
+	return entries, nil
+}
+
+func listpackBacklenSize(l int) int {
+	switch {
+	case l <= 127:
+		return 1
+	case l < 16383:
+		return 2
+	case l < 2097151:
+		return 3
+	case l < 268435455:
+		return 4
+	}
+	return 5
+}
+
+// intset: encoding(4) length(4) 有序的小端整数，encoding为每个整数的字节数
+func intsetEntries(is []byte) ([]string, error) {
+	if len(is) < 8 {
+		return nil, errBadEncoding
+	}
+	enc := int(binary.LittleEndian.Uint32(is))
+	n := int(binary.LittleEndian.Uint32(is[4:]))
+	if (enc != 2 && enc != 4 && enc != 8) || len(is) != 8+enc*n {
+		return nil, errBadEncoding
+	}
+	entries := make([]string, n)
+	for i := range entries {
+		entries[i] = strconv.FormatInt(leInt(is[8+i*enc:8+(i+1)*enc]), 10)
+	}
+	return entries, nil
+}
@@ -0,0 +1,558 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"strings"
+)
+
+const (
+	ZSKIPLIST_MAXLEVEL int     = 32
+	ZSKIPLIST_P        float64 = 0.25
+)
+
+// ZSet.Add的输入标志
+const (
+	ZADD_IN_INCR int = 1 << iota
+	ZADD_IN_NX
+	ZADD_IN_XX
+	ZADD_IN_GT
+	ZADD_IN_LT
+)
+
+// ZSet.Add的输出标志
+const (
+	ZADD_OUT_NOP int = 1 << iota // 没有做任何操作
+	ZADD_OUT_NAN                 // 结果为NaN
+	ZADD_OUT_ADDED
+	ZADD_OUT_UPDATED
+)
+
+type SkipListLevel struct {
+	forward *SkipListNode
+	span    int64 // 到forward结点跨越的结点数，用于计算排名
+}
+
+type SkipListNode struct {
+	Member   *Gobj
+	Score    float64
+	backward *SkipListNode
+	level    []SkipListLevel
+}
+
+type SkipList struct {
+	header *SkipListNode
+	tail   *SkipListNode
+	length int64
+	level  int
+}
+
+// 有序集合，dict保存member到score的映射，skiplist按score排序
+type ZSet struct {
+	dict *GobjDict
+	zsl  *SkipList
+}
+
+// score范围，MinEx/MaxEx表示开区间
+type ScoreRange struct {
+	Min, Max     float64
+	MinEx, MaxEx bool
+}
+
+// 字典序范围的边界，inf为-1表示"-"，为1表示"+"
+type LexBound struct {
+	val string
+	ex  bool
+	inf int
+}
+
+type LexRange struct {
+	Min, Max LexBound
+}
+
+func createSkipListNode(level int, score float64, member *Gobj) *SkipListNode {
+	return &SkipListNode{
+		Member: member,
+		Score:  score,
+		level:  make([]SkipListLevel, level),
+	}
+}
+
+func SkipListCreate() *SkipList {
+	return &SkipList{
+		header: createSkipListNode(ZSKIPLIST_MAXLEVEL, 0, nil),
+		level:  1,
+	}
+}
+
+func (zsl *SkipList) Length() int64 {
+	return zsl.length
+}
+
+func (zsl *SkipList) First() *SkipListNode {
+	return zsl.header.level[0].forward
+}
+
+func (zsl *SkipList) Last() *SkipListNode {
+	return zsl.tail
+}
+
+func (n *SkipListNode) Next() *SkipListNode {
+	return n.level[0].forward
+}
+
+func (n *SkipListNode) Prev() *SkipListNode {
+	return n.backward
+}
+
+// 层数越高概率越小
+func randomLevel() int {
+	level := 1
+	for level < ZSKIPLIST_MAXLEVEL && rand.Float64() < ZSKIPLIST_P {
+		level++
+	}
+	return level
+}
+
+// 先比较score，score相同时比较member
+func nodeLess(n *SkipListNode, score float64, member *Gobj) bool {
+	return n.Score < score || (n.Score == score && n.Member.StrVal() < member.StrVal())
+}
+
+// 调用方需要保证member不存在
+func (zsl *SkipList) Insert(score float64, member *Gobj) *SkipListNode {
+	var update [ZSKIPLIST_MAXLEVEL]*SkipListNode
+	var rank [ZSKIPLIST_MAXLEVEL]int64
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		if i != zsl.level-1 {
+			rank[i] = rank[i+1]
+		}
+		for x.level[i].forward != nil && nodeLess(x.level[i].forward, score, member) {
+			rank[i] += x.level[i].span
+			x = x.level[i].forward
+		}
+		update[i] = x
+	}
+	level := randomLevel()
+	if level > zsl.level {
+		for i := zsl.level; i < level; i++ {
+			rank[i] = 0
+			update[i] = zsl.header
+			update[i].level[i].span = zsl.length
+		}
+		zsl.level = level
+	}
+	x = createSkipListNode(level, score, member)
+	member.IncrRefCount()
+	for i := 0; i < level; i++ {
+		x.level[i].forward = update[i].level[i].forward
+		update[i].level[i].forward = x
+		x.level[i].span = update[i].level[i].span - (rank[0] - rank[i])
+		update[i].level[i].span = (rank[0] - rank[i]) + 1
+	}
+	// 更高的层跨越的结点数加一
+	for i := level; i < zsl.level; i++ {
+		update[i].level[i].span++
+	}
+	if update[0] != zsl.header {
+		x.backward = update[0]
+	}
+	if x.level[0].forward != nil {
+		x.level[0].forward.backward = x
+	} else {
+		zsl.tail = x
+	}
+	zsl.length++
+	return x
+}
+
+// update为每一层中x的前一个结点
+func (zsl *SkipList) deleteNode(x *SkipListNode, update []*SkipListNode) {
+	for i := 0; i < zsl.level; i++ {
+		if update[i].level[i].forward == x {
+			update[i].level[i].span += x.level[i].span - 1
+			update[i].level[i].forward = x.level[i].forward
+		} else {
+			update[i].level[i].span -= 1
+		}
+	}
+	if x.level[0].forward != nil {
+		x.level[0].forward.backward = x.backward
+	} else {
+		zsl.tail = x.backward
+	}
+	for zsl.level > 1 && zsl.header.level[zsl.level-1].forward == nil {
+		zsl.level--
+	}
+	zsl.length--
+}
+
+// 查找每一层中(score, member)的前一个结点
+func (zsl *SkipList) findUpdate(score float64, member *Gobj) []*SkipListNode {
+	update := make([]*SkipListNode, ZSKIPLIST_MAXLEVEL)
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && nodeLess(x.level[i].forward, score, member) {
+			x = x.level[i].forward
+		}
+		update[i] = x
+	}
+	return update
+}
+
+func (zsl *SkipList) Delete(score float64, member *Gobj) bool {
+	update := zsl.findUpdate(score, member)
+	x := update[0].level[0].forward
+	if x == nil || x.Score != score || !GStrEqual(x.Member, member) {
+		return false
+	}
+	zsl.deleteNode(x, update)
+	x.Member.DecrRefCount()
+	return true
+}
+
+// 更新score，调用方需要保证(curScore, member)存在
+func (zsl *SkipList) UpdateScore(curScore float64, member *Gobj, newScore float64) *SkipListNode {
+	update := zsl.findUpdate(curScore, member)
+	x := update[0].level[0].forward
+	// 更新后位置不变时直接修改score
+	if (x.backward == nil || x.backward.Score < newScore) &&
+		(x.level[0].forward == nil || x.level[0].forward.Score > newScore) {
+		x.Score = newScore
+		return x
+	}
+	zsl.deleteNode(x, update)
+	n := zsl.Insert(newScore, x.Member)
+	x.Member.DecrRefCount()
+	return n
+}
+
+// 返回从1开始的排名，不存在时返回0
+func (zsl *SkipList) GetRank(score float64, member *Gobj) int64 {
+	var rank int64
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && (nodeLess(x.level[i].forward, score, member) ||
+			(x.level[i].forward.Score == score && GStrEqual(x.level[i].forward.Member, member))) {
+			rank += x.level[i].span
+			x = x.level[i].forward
+		}
+		if x.Member != nil && x.Score == score && GStrEqual(x.Member, member) {
+			return rank
+		}
+	}
+	return 0
+}
+
+// rank从1开始
+func (zsl *SkipList) GetByRank(rank int64) *SkipListNode {
+	var traversed int64
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && traversed+x.level[i].span <= rank {
+			traversed += x.level[i].span
+			x = x.level[i].forward
+		}
+		if traversed == rank {
+			return x
+		}
+	}
+	return nil
+}
+
+func (r *ScoreRange) gteMin(score float64) bool {
+	if r.MinEx {
+		return score > r.Min
+	}
+	return score >= r.Min
+}
+
+func (r *ScoreRange) lteMax(score float64) bool {
+	if r.MaxEx {
+		return score < r.Max
+	}
+	return score <= r.Max
+}
+
+func (zsl *SkipList) isInRange(r *ScoreRange) bool {
+	if r.Min > r.Max || (r.Min == r.Max && (r.MinEx || r.MaxEx)) {
+		return false
+	}
+	if zsl.tail == nil || !r.gteMin(zsl.tail.Score) {
+		return false
+	}
+	first := zsl.First()
+	return first != nil && r.lteMax(first.Score)
+}
+
+func (zsl *SkipList) FirstInRange(r *ScoreRange) *SkipListNode {
+	if !zsl.isInRange(r) {
+		return nil
+	}
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && !r.gteMin(x.level[i].forward.Score) {
+			x = x.level[i].forward
+		}
+	}
+	x = x.level[0].forward
+	if !r.lteMax(x.Score) {
+		return nil
+	}
+	return x
+}
+
+func (zsl *SkipList) LastInRange(r *ScoreRange) *SkipListNode {
+	if !zsl.isInRange(r) {
+		return nil
+	}
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && r.lteMax(x.level[i].forward.Score) {
+			x = x.level[i].forward
+		}
+	}
+	if !r.gteMin(x.Score) {
+		return nil
+	}
+	return x
+}
+
+// 解析"(a"、"[a"、"-"、"+"格式的字典序边界
+func ParseLexBound(s string) (LexBound, bool) {
+	if s == "+" {
+		return LexBound{inf: 1}, true
+	} else if s == "-" {
+		return LexBound{inf: -1}, true
+	} else if strings.HasPrefix(s, "(") {
+		return LexBound{val: s[1:], ex: true}, true
+	} else if strings.HasPrefix(s, "[") {
+		return LexBound{val: s[1:]}, true
+	}
+	return LexBound{}, false
+}
+
+func (r *LexRange) gteMin(member string) bool {
+	if r.Min.inf != 0 {
+		return r.Min.inf < 0
+	}
+	cmp := strings.Compare(member, r.Min.val)
+	if r.Min.ex {
+		return cmp > 0
+	}
+	return cmp >= 0
+}
+
+func (r *LexRange) lteMax(member string) bool {
+	if r.Max.inf != 0 {
+		return r.Max.inf > 0
+	}
+	cmp := strings.Compare(member, r.Max.val)
+	if r.Max.ex {
+		return cmp < 0
+	}
+	return cmp <= 0
+}
+
+func (zsl *SkipList) isInLexRange(r *LexRange) bool {
+	if r.Min.inf > 0 || r.Max.inf < 0 {
+		return false
+	}
+	if r.Min.inf == 0 && r.Max.inf == 0 {
+		cmp := strings.Compare(r.Min.val, r.Max.val)
+		if cmp > 0 || (cmp == 0 && (r.Min.ex || r.Max.ex)) {
+			return false
+		}
+	}
+	if zsl.tail == nil || !r.gteMin(zsl.tail.Member.StrVal()) {
+		return false
+	}
+	first := zsl.First()
+	return first != nil && r.lteMax(first.Member.StrVal())
+}
+
+func (zsl *SkipList) FirstInLexRange(r *LexRange) *SkipListNode {
+	if !zsl.isInLexRange(r) {
+		return nil
+	}
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && !r.gteMin(x.level[i].forward.Member.StrVal()) {
+			x = x.level[i].forward
+		}
+	}
+	x = x.level[0].forward
+	if !r.lteMax(x.Member.StrVal()) {
+		return nil
+	}
+	return x
+}
+
+func (zsl *SkipList) LastInLexRange(r *LexRange) *SkipListNode {
+	if !zsl.isInLexRange(r) {
+		return nil
+	}
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && r.lteMax(x.level[i].forward.Member.StrVal()) {
+			x = x.level[i].forward
+		}
+	}
+	if !r.gteMin(x.Member.StrVal()) {
+		return nil
+	}
+	return x
+}
+
+// 删除update[0]之后满足inRange的连续结点，同时从dict中删除
+func (zsl *SkipList) deleteFrom(update []*SkipListNode, dict *GobjDict, inRange func(x *SkipListNode) bool) int64 {
+	var removed int64
+	x := update[0].level[0].forward
+	for x != nil && inRange(x) {
+		next := x.level[0].forward
+		zsl.deleteNode(x, update)
+		dict.Delete(x.Member)
+		x.Member.DecrRefCount()
+		removed++
+		x = next
+	}
+	return removed
+}
+
+func (zsl *SkipList) DeleteRangeByScore(r *ScoreRange, dict *GobjDict) int64 {
+	update := make([]*SkipListNode, ZSKIPLIST_MAXLEVEL)
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && !r.gteMin(x.level[i].forward.Score) {
+			x = x.level[i].forward
+		}
+		update[i] = x
+	}
+	return zsl.deleteFrom(update, dict, func(x *SkipListNode) bool {
+		return r.lteMax(x.Score)
+	})
+}
+
+func (zsl *SkipList) DeleteRangeByLex(r *LexRange, dict *GobjDict) int64 {
+	update := make([]*SkipListNode, ZSKIPLIST_MAXLEVEL)
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && !r.gteMin(x.level[i].forward.Member.StrVal()) {
+			x = x.level[i].forward
+		}
+		update[i] = x
+	}
+	return zsl.deleteFrom(update, dict, func(x *SkipListNode) bool {
+		return r.lteMax(x.Member.StrVal())
+	})
+}
+
+// start和end都从1开始，包含两端
+func (zsl *SkipList) DeleteRangeByRank(start, end int64, dict *GobjDict) int64 {
+	update := make([]*SkipListNode, ZSKIPLIST_MAXLEVEL)
+	var traversed int64
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && traversed+x.level[i].span < start {
+			traversed += x.level[i].span
+			x = x.level[i].forward
+		}
+		update[i] = x
+	}
+	traversed++
+	return zsl.deleteFrom(update, dict, func(x *SkipListNode) bool {
+		if traversed > end {
+			return false
+		}
+		traversed++
+		return true
+	})
+}
+
+func ZSetCreate() *ZSet {
+	return &ZSet{
+		dict: GobjDictCreate(),
+		zsl:  SkipListCreate(),
+	}
+}
+
+func (zs *ZSet) Length() int64 {
+	return zs.zsl.length
+}
+
+func (zs *ZSet) Score(member *Gobj) (float64, bool) {
+	o := zs.dict.Get(member)
+	if o == nil {
+		return 0, false
+	}
+	return o.FloatVal(), true
+}
+
+// 添加或更新member，返回输出标志和更新后的score
+func (zs *ZSet) Add(score float64, member *Gobj, flags int) (int, float64) {
+	incr := flags&ZADD_IN_INCR != 0
+	nx := flags&ZADD_IN_NX != 0
+	xx := flags&ZADD_IN_XX != 0
+	gt := flags&ZADD_IN_GT != 0
+	lt := flags&ZADD_IN_LT != 0
+	if math.IsNaN(score) {
+		return ZADD_OUT_NAN, 0
+	}
+	if curScore, ok := zs.Score(member); ok {
+		if nx {
+			return ZADD_OUT_NOP, curScore
+		}
+		if incr {
+			score += curScore
+			if math.IsNaN(score) {
+				return ZADD_OUT_NAN, curScore
+			}
+		}
+		if (lt && score >= curScore) || (gt && score <= curScore) {
+			return ZADD_OUT_NOP, curScore
+		}
+		if score == curScore {
+			return 0, score
+		}
+		zs.zsl.UpdateScore(curScore, member, score)
+		zs.setScore(member, score)
+		return ZADD_OUT_UPDATED, score
+	}
+	if xx {
+		return ZADD_OUT_NOP, 0
+	}
+	zs.zsl.Insert(score, member)
+	zs.setScore(member, score)
+	return ZADD_OUT_ADDED, score
+}
+
+func (zs *ZSet) setScore(member *Gobj, score float64) {
+	o := CreateObject(GSTR, formatFloat(score))
+	zs.dict.Set(member, o)
+	o.DecrRefCount()
+}
+
+func (zs *ZSet) Delete(member *Gobj) bool {
+	score, ok := zs.Score(member)
+	if !ok {
+		return false
+	}
+	// 先从skiplist删除，dict中的key和member可能是同一个对象
+	zs.zsl.Delete(score, member)
+	zs.dict.Delete(member)
+	return true
+}
+
+// 返回从0开始的排名，不存在时返回-1
+func (zs *ZSet) Rank(member *Gobj, reverse bool) int64 {
+	score, ok := zs.Score(member)
+	if !ok {
+		return -1
+	}
+	rank := zs.zsl.GetRank(score, member)
+	if reverse {
+		return zs.zsl.length - rank
+	}
+	return rank - 1
+}
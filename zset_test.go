@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSkipList(t *testing.T) {
+	zsl := SkipListCreate()
+	assert.Nil(t, zsl.First())
+	assert.Nil(t, zsl.Last())
+
+	// 按score逆序插入，score相同时按member排序
+	for i := 99; i >= 0; i-- {
+		zsl.Insert(float64(i/2), CreateObject(GSTR, fmt.Sprintf("m%02d", i)))
+	}
+	assert.Equal(t, int64(100), zsl.Length())
+	n := zsl.First()
+	for i := 0; i < 100; i++ {
+		assert.Equal(t, fmt.Sprintf("m%02d", i), n.Member.StrVal())
+		assert.Equal(t, int64(i+1), zsl.GetRank(n.Score, n.Member))
+		assert.Equal(t, n, zsl.GetByRank(int64(i+1)))
+		n = n.Next()
+	}
+	assert.Nil(t, n)
+	assert.Equal(t, "m99", zsl.Last().Member.StrVal())
+	assert.Equal(t, "m98", zsl.Last().Prev().Member.StrVal())
+	assert.Equal(t, int64(0), zsl.GetRank(1, CreateObject(GSTR, "m00")))
+	assert.Nil(t, zsl.GetByRank(101))
+
+	r := ScoreRange{Min: 10, Max: 20, MinEx: true}
+	assert.Equal(t, "m22", zsl.FirstInRange(&r).Member.StrVal())
+	assert.Equal(t, "m41", zsl.LastInRange(&r).Member.StrVal())
+	r = ScoreRange{Min: 100, Max: 200}
+	assert.Nil(t, zsl.FirstInRange(&r))
+	assert.Nil(t, zsl.LastInRange(&r))
+
+	m := CreateObject(GSTR, "m50")
+	assert.True(t, zsl.Delete(25, m))
+	assert.False(t, zsl.Delete(25, m))
+	assert.Equal(t, int64(99), zsl.Length())
+	assert.Equal(t, "m51", zsl.GetByRank(51).Member.StrVal())
+
+	// 更新后位置不变和位置改变两种情况
+	m = CreateObject(GSTR, "m51")
+	n = zsl.UpdateScore(25, m, 25.5)
+	assert.Equal(t, 25.5, n.Score)
+	assert.Equal(t, int64(51), zsl.GetRank(25.5, m))
+	zsl.UpdateScore(25.5, m, -1)
+	assert.Equal(t, "m51", zsl.First().Member.StrVal())
+	assert.Equal(t, int64(99), zsl.Length())
+}
+
+func TestSkipListDeleteRange(t *testing.T) {
+	zs := ZSetCreate()
+	for i := 0; i < 10; i++ {
+		zs.Add(float64(i), CreateObject(GSTR, fmt.Sprintf("%c", 'a'+i)), 0)
+	}
+	assert.Equal(t, int64(3), zs.zsl.DeleteRangeByRank(1, 3, zs.dict))
+	assert.Equal(t, "d", zs.zsl.First().Member.StrVal())
+	r := ScoreRange{Min: 3, Max: 5, MaxEx: true}
+	assert.Equal(t, int64(2), zs.zsl.DeleteRangeByScore(&r, zs.dict))
+	min, _ := ParseLexBound("(f")
+	max, _ := ParseLexBound("+")
+	assert.Equal(t, int64(4), zs.zsl.DeleteRangeByLex(&LexRange{Min: min, Max: max}, zs.dict))
+	assert.Equal(t, int64(1), zs.Length())
+	assert.Equal(t, int64(1), zs.dict.Size())
+	assert.Equal(t, "f", zs.zsl.Last().Member.StrVal())
+}
+
+func TestZSetAdd(t *testing.T) {
+	zs := ZSetCreate()
+	a := CreateObject(GSTR, "a")
+	out, score := zs.Add(1, a, 0)
+	assert.Equal(t, ZADD_OUT_ADDED, out)
+	assert.Equal(t, 1.0, score)
+	out, _ = zs.Add(2, a, ZADD_IN_NX)
+	assert.Equal(t, ZADD_OUT_NOP, out)
+	out, _ = zs.Add(0, a, ZADD_IN_GT)
+	assert.Equal(t, ZADD_OUT_NOP, out)
+	out, score = zs.Add(2, a, ZADD_IN_INCR)
+	assert.Equal(t, ZADD_OUT_UPDATED, out)
+	assert.Equal(t, 3.0, score)
+	out, _ = zs.Add(1, CreateObject(GSTR, "b"), ZADD_IN_XX)
+	assert.Equal(t, ZADD_OUT_NOP, out)
+	assert.Equal(t, int64(0), zs.Rank(a, false))
+	assert.Equal(t, int64(-1), zs.Rank(CreateObject(GSTR, "b"), false))
+	assert.True(t, zs.Delete(a))
+	assert.Equal(t, int64(0), zs.Length())
+}